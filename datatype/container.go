@@ -51,12 +51,14 @@ func (c *Container) Add(d ...DataType) {
 }
 
 // Generate prepends a timestamp pair and value to the list, and generates
-// a json object suitable for recording into a document store.
+// a json object suitable for recording into a document store. It can be
+// called multiple times, e.g. when a record is retried.
 func (c *Container) Generate(p io.Writer, timestamp time.Time) (int, error) {
 	ts := fmt.Sprintf(`"@timestamp":"%s"`, timestamp.Format(TimeStampFormat))
 	l := new(bytes.Buffer)
 	for _, v := range c.List() {
 		l.Write([]byte(","))
+		v.Reset()
 		_, err := l.ReadFrom(v)
 		if err != nil {
 			return 0, errors.Wrap(err, "writing item")
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/arsham/expipe/datatype"
 	"github.com/pkg/errors"
@@ -32,6 +33,25 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestGenerateTwice(t *testing.T) {
+	t.Parallel()
+	c := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("a", 1),
+		datatype.NewStringType("b", "c"),
+	})
+	now := time.Now()
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	if _, err := c.Generate(first, now); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err := c.Generate(second, now); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("second = (%s); want (%s)", second, first)
+	}
+}
+
 func TestJobResultDataTypes(t *testing.T) {
 	t.Parallel()
 	mapper := datatype.DefaultMapper()
@@ -0,0 +1,76 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Flatten calls fn with the keys and values of d, for the recorders that do
+// not write the JSON representation. Numbers are float64, strings are string
+// and lists are []float64. Byte types are in the unit they are presented in,
+// e.g. megabytes for the ByteType, and the GC lists are in microseconds
+// without the zero values. Unknown types are decoded from their JSON
+// representation, therefore their values can be of any JSON type.
+func Flatten(d DataType, fn func(key string, value interface{})) error {
+	switch v := d.(type) {
+	case *FloatType:
+		fn(v.Key, v.Value)
+	case *StringType:
+		fn(v.Key, v.Value)
+	case *ByteType:
+		fn(v.Key, v.Value/MegaByte)
+	case *KiloByteType:
+		fn(v.Key, v.Value/KiloByte)
+	case *MegaByteType:
+		fn(v.Key, v.Value/MegaByte)
+	case *FloatListType:
+		fn(v.Key, v.Value)
+	case *GCListType:
+		list := []float64{}
+		for _, p := range v.Value {
+			if p > 0 {
+				list = append(list, float64(p/1000))
+			}
+		}
+		fn(v.Key, list)
+	default:
+		d.Reset()
+		content, err := ioutil.ReadAll(d)
+		d.Reset()
+		if err != nil {
+			return fmt.Errorf("reading value: %v", err)
+		}
+		var obj map[string]interface{}
+		if err = json.Unmarshal([]byte("{"+string(content)+"}"), &obj); err != nil {
+			return fmt.Errorf("decoding value: %v", err)
+		}
+		for k, v := range obj {
+			fn(k, v)
+		}
+	}
+	return nil
+}
+
+// Summarise calls fn with the count, min, max and mean of the list by their
+// names. Only the count is given for an empty list.
+func Summarise(list []float64, fn func(name string, value float64)) {
+	fn("count", float64(len(list)))
+	if len(list) == 0 {
+		return
+	}
+	min, max, sum := list[0], list[0], 0.0
+	for _, v := range list {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		sum += v
+	}
+	fn("min", min)
+	fn("max", max)
+	fn("mean", sum/float64(len(list)))
+}
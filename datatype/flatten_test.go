@@ -0,0 +1,62 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package datatype_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+type unknownType struct {
+	*datatype.StringType
+}
+
+func TestFlatten(t *testing.T) {
+	tcs := []struct {
+		name string
+		d    datatype.DataType
+		want map[string]interface{}
+	}{
+		{"float", datatype.NewFloatType("a", 1.5), map[string]interface{}{"a": 1.5}},
+		{"string", datatype.NewStringType("a", "b"), map[string]interface{}{"a": "b"}},
+		{"byte", datatype.NewByteType("a", 2*datatype.MegaByte), map[string]interface{}{"a": 2.0}},
+		{"kilobyte", datatype.NewKiloByteType("a", 2*datatype.KiloByte), map[string]interface{}{"a": 2.0}},
+		{"megabyte", datatype.NewMegaByteType("a", 2*datatype.MegaByte), map[string]interface{}{"a": 2.0}},
+		{"float list", datatype.NewFloatListType("a", []float64{1, 2}), map[string]interface{}{"a": []float64{1, 2}}},
+		{"gc list", datatype.NewGCListType("a", []uint64{0, 2000, 4500}), map[string]interface{}{"a": []float64{2, 4}}},
+		{"empty gc list", datatype.NewGCListType("a", []uint64{0}), map[string]interface{}{"a": []float64{}}},
+		{"unknown", unknownType{datatype.NewStringType("a", "b")}, map[string]interface{}{"a": "b"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make(map[string]interface{})
+			err := datatype.Flatten(tc.d, func(key string, value interface{}) {
+				got[key] = value
+			})
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Flatten() = (%v); want (%v)", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	got := make(map[string]float64)
+	datatype.Summarise([]float64{1, 5, 3}, func(name string, v float64) { got[name] = v })
+	want := map[string]float64{"count": 3, "min": 1, "max": 5, "mean": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarise() = (%v); want (%v)", got, want)
+	}
+	got = make(map[string]float64)
+	datatype.Summarise(nil, func(name string, v float64) { got[name] = v })
+	if !reflect.DeepEqual(got, map[string]float64{"count": 0}) {
+		t.Errorf("Summarise() = (%v); want (map[count:0])", got)
+	}
+}
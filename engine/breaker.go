@@ -0,0 +1,157 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/retry"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive failures that opens
+	// a breaker, if not specified.
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is the time a breaker stays open before pinging
+	// the endpoint, if not specified.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// breakerStates holds the state of each breaker, keyed by the kind and the
+// name of the endpoint, e.g. "reader/FirstApp". The recorders are also keyed by
+// the reader of their engine, e.g. "FirstApp/recorder/main_elasticsearch".
+var breakerStates = expvar.NewMap("Breakers")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker stops calling an endpoint after threshold consecutive failures. When
+// it has been open for cooldown, it half-opens and pings the endpoint. It
+// closes if the ping succeeds, otherwise it stays open for another cooldown.
+// Only the errors caused by unavailable endpoints count as failures. A nil
+// breaker always allows the calls.
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	ping      func() error
+	log       tools.FieldLogger
+	exp       *expvar.String
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// newBreaker returns nil if the threshold is not positive.
+func newBreaker(name string, threshold int, cooldown time.Duration, ping func() error, log tools.FieldLogger) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	b := &breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		ping:      ping,
+		log:       log,
+		exp:       new(expvar.String),
+	}
+	b.exp.Set(breakerClosed.String())
+	breakerStates.Set(name, b.exp)
+	return b
+}
+
+// allow returns true if the endpoint should be called.
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerClosed {
+		return true
+	}
+	if time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.setState(breakerHalfOpen)
+	if err := b.ping(); err != nil {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+		return false
+	}
+	b.failures = 0
+	b.setState(breakerClosed)
+	return true
+}
+
+// report records the result of a call to the endpoint.
+func (b *breaker) report(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Cause(err) == nil {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+	if !retry.IsRetryable(err) {
+		return
+	}
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState logs the transitions, therefore a flapping endpoint does not flood
+// the logs.
+func (b *breaker) setState(s breakerState) {
+	if b.state == s {
+		return
+	}
+	switch {
+	case s == breakerOpen && b.state == breakerClosed:
+		b.log.Warnf("%s: breaker opened after %d failures, pausing for %s", b.name, b.failures, b.cooldown)
+	case s == breakerClosed:
+		b.log.Infof("%s: breaker closed, endpoint is back", b.name)
+	default:
+		b.log.Debugf("%s: breaker %s", b.name, s)
+	}
+	b.state = s
+	b.exp.Set(s.String())
+}
+
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
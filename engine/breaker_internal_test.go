@@ -0,0 +1,88 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+func TestNewBreakerDisabled(t *testing.T) {
+	b := newBreaker("disabled", 0, time.Second, nil, tools.DiscardLogger())
+	if b != nil {
+		t.Fatalf("b = (%v); want (nil)", b)
+	}
+	if !b.allow() {
+		t.Error("b.allow() = (false); want (true)")
+	}
+	b.report(errors.New("error")) // should not panic
+}
+
+func TestBreakerStates(t *testing.T) {
+	var pingErr error
+	var pings int
+	ping := func() error {
+		pings++
+		return pingErr
+	}
+	cooldown := 20 * time.Millisecond
+	b := newBreaker("recorder/states", 2, cooldown, ping, tools.DiscardLogger())
+	unavailable := recorder.EndpointNotAvailableError{Endpoint: "rec", Err: errors.New("down")}
+	check := func(name string, want breakerState) {
+		if s := b.current(); s != want {
+			t.Errorf("%s: state = (%s); want (%s)", name, s, want)
+		}
+		if s := breakerStates.Get("recorder/states").String(); s != `"`+want.String()+`"` {
+			t.Errorf("%s: expvar = (%s); want (%q)", name, s, want)
+		}
+	}
+
+	b.report(errors.New("bad payload"))
+	b.report(errors.New("bad payload"))
+	check("other errors", breakerClosed)
+
+	b.report(unavailable)
+	b.report(nil)
+	b.report(unavailable)
+	check("not consecutive", breakerClosed)
+
+	b.report(unavailable)
+	check("threshold", breakerOpen)
+	if b.allow() {
+		t.Error("open: b.allow() = (true); want (false)")
+	}
+	if pings != 0 {
+		t.Errorf("pings = (%d); want (0)", pings)
+	}
+
+	time.Sleep(cooldown)
+	pingErr = errors.New("still down")
+	if b.allow() {
+		t.Error("failed ping: b.allow() = (true); want (false)")
+	}
+	check("failed ping", breakerOpen)
+	if pings != 1 {
+		t.Errorf("pings = (%d); want (1)", pings)
+	}
+	if b.allow() {
+		t.Error("after failed ping: b.allow() = (true); want (false)")
+	}
+	if pings != 1 {
+		t.Errorf("pings = (%d); want (1)", pings)
+	}
+
+	time.Sleep(cooldown)
+	pingErr = nil
+	if !b.allow() {
+		t.Error("ping: b.allow() = (false); want (true)")
+	}
+	check("ping", breakerClosed)
+	b.report(unavailable)
+	check("one failure after closing", breakerClosed)
+}
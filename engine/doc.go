@@ -29,6 +29,12 @@
 //   | expRecorders         | Recorders               |
 //   | readJobs             | Read Jobs               |
 //   | recordJobs           | Record Jobs             |
+//   | retriedJobs          | Retried Jobs            |
+//   | skippedJobs          | Skipped Jobs            |
+//   | abandonedJobs        | Abandoned Jobs          |
+//   | queueDepths          | Queue Depths            |
+//   | queueDrops           | Queue Drops             |
+//   | breakerStates        | Breakers                |
 //   | datatypeObjs         | DataType Objects        |
 //   +----------------------+-------------------------+
 //
@@ -9,10 +9,16 @@ import (
 	"expvar"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/reader"
 	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
 	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/config"
+	"github.com/arsham/expipe/tools/retry"
 	"github.com/pkg/errors"
 )
 
@@ -24,6 +30,9 @@ var (
 	recordJobs        = expvar.NewInt("Record Jobs")
 	waitingRecordJobs = expvar.NewInt("Waiting Record Jobs")
 	erroredJobs       = expvar.NewInt("Error Jobs")
+	retriedJobs       = expvar.NewInt("Retried Jobs")
+	skippedJobs       = expvar.NewInt("Skipped Jobs")
+	abandonedJobs     = expvar.NewInt("Abandoned Jobs")
 )
 
 // Engine is an interface to Operator's behaviour.
@@ -40,29 +49,122 @@ type Engine interface {
 	Reader() reader.DataReader
 }
 
+// spooler is implemented by the Engines that can spool the failed jobs of
+// their recorders. It is not a part of the Engine interface to keep it tight.
+type spooler interface {
+	SetSpools(map[string]*spool.Spool)
+	Spools() map[string]*spool.Spool
+}
+
+// queuer is implemented by the Engines that can set up the queues of their
+// recorders.
+type queuer interface {
+	SetQueues(map[string]config.Queue)
+	Queues() map[string]config.Queue
+}
+
+// processable is implemented by the Engines that process the payloads before
+// they are recorded.
+type processable interface {
+	SetProcessors(map[string]processor.Processor)
+	Processors() map[string]processor.Processor
+}
+
+// retrier is implemented by the Engines that retry the failed Read and Record
+// calls.
+type retrier interface {
+	SetRetry(*retry.Policy)
+	Retry() *retry.Policy
+}
+
+// breakable is implemented by the Engines that guard their endpoints with
+// circuit breakers.
+type breakable interface {
+	SetBreaker(threshold int, cooldown time.Duration)
+	Breaker() (threshold int, cooldown time.Duration)
+}
+
+// drainer is implemented by the Engines that ship the results that are
+// already read when they are shutting down.
+type drainer interface {
+	SetDrainTimeout(time.Duration)
+	DrainTimeout() time.Duration
+}
+
+// attacher is implemented by the Engines that can take new recorders while
+// they are running.
+type attacher interface {
+	AttachRecorder(recorder.DataRecorder) error
+	setFan(*fan)
+}
+
+// monitor is implemented by the Engines that keep the statistics of their
+// reads and records.
+type monitor interface {
+	Status() Status
+	stats() *engineStats
+}
+
 // Operator represents an Engine that receives information from a reader and
 // ships them to multiple recorders.
 type Operator struct {
+	mu        sync.RWMutex // Guards the name, recorders and fan.
 	log       tools.FieldLogger
 	ctx       context.Context // Will call stop() when this context is cancelled/timed-out.
 	name      string          // Name identifier for this Engine.
 	reader    reader.DataReader
 	recorders map[string]recorder.DataRecorder // Map of active recorders name to their objects.
+	spools    map[string]*spool.Spool          // Map of recorder names to their spools, if they have one.
+	queues    map[string]config.Queue          // Map of recorder names to the settings of their queues.
+	procs     map[string]processor.Processor   // Map of recorder names to the processors of their payloads.
+	retry     *retry.Policy                    // Retry policy of the reads and records. Nil means no retries.
+	threshold int                              // Consecutive failures that open a breaker. Zero means no breakers.
+	cooldown  time.Duration                    // Time a breaker stays open before pinging the endpoint.
+	drain     time.Duration                    // Time to ship the read results after the context is done.
+	fan       *fan                             // Ships the results to the recorders, set when the Engine starts.
+	stat      *engineStats                     // Statistics of the reads and records.
 }
 
-func (o *Operator) String() string { return o.name }
+func (o *Operator) String() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.name
+}
 
 // Ctx returns the context assigned to this Engine.
-func (o Operator) Ctx() context.Context { return o.ctx }
+func (o *Operator) Ctx() context.Context { return o.ctx }
 
 // Log returns the logger assigned to this Engine.
-func (o Operator) Log() tools.FieldLogger { return o.log }
+func (o *Operator) Log() tools.FieldLogger { return o.log }
 
 // Recorders returns the recorder map.
-func (o Operator) Recorders() map[string]recorder.DataRecorder { return o.recorders }
+func (o *Operator) Recorders() map[string]recorder.DataRecorder {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.recorders
+}
 
 // Reader returns the reader.
-func (o Operator) Reader() reader.DataReader { return o.reader }
+func (o *Operator) Reader() reader.DataReader { return o.reader }
+
+// Spools returns the spools of the recorders.
+func (o *Operator) Spools() map[string]*spool.Spool { return o.spools }
+
+// Queues returns the settings of the queues of the recorders.
+func (o *Operator) Queues() map[string]config.Queue { return o.queues }
+
+// Processors returns the processors of the recorders.
+func (o *Operator) Processors() map[string]processor.Processor { return o.procs }
+
+// Retry returns the retry policy.
+func (o *Operator) Retry() *retry.Policy { return o.retry }
+
+// Breaker returns the settings of the circuit breakers.
+func (o *Operator) Breaker() (threshold int, cooldown time.Duration) { return o.threshold, o.cooldown }
+
+// DrainTimeout returns the time the Engine ships the results that are already
+// read, after its context is done.
+func (o *Operator) DrainTimeout() time.Duration { return o.drain }
 
 // SetCtx sets the context of this Engine.
 func (o *Operator) SetCtx(ctx context.Context) { o.ctx = ctx }
@@ -72,15 +174,84 @@ func (o *Operator) SetLog(log tools.FieldLogger) { o.log = log }
 
 // SetRecorders sets the recorder map.
 func (o *Operator) SetRecorders(recorders map[string]recorder.DataRecorder) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	o.recorders = recorders
 }
 
 // SetReader sets the reader.
 func (o *Operator) SetReader(reader reader.DataReader) { o.reader = reader }
 
+// SetSpools sets the spools of the recorders.
+func (o *Operator) SetSpools(spools map[string]*spool.Spool) { o.spools = spools }
+
+// SetQueues sets the settings of the queues of the recorders.
+func (o *Operator) SetQueues(queues map[string]config.Queue) { o.queues = queues }
+
+// SetProcessors sets the processors of the recorders.
+func (o *Operator) SetProcessors(procs map[string]processor.Processor) { o.procs = procs }
+
+// SetRetry sets the retry policy.
+func (o *Operator) SetRetry(policy *retry.Policy) { o.retry = policy }
+
+// SetBreaker sets the settings of the circuit breakers.
+func (o *Operator) SetBreaker(threshold int, cooldown time.Duration) {
+	o.threshold, o.cooldown = threshold, cooldown
+}
+
+// SetDrainTimeout sets the drain timeout.
+func (o *Operator) SetDrainTimeout(d time.Duration) { o.drain = d }
+
+// AttachRecorder adds the recorder to the Engine. If the Engine is running,
+// the recorder receives the results from the next read. It returns an error if
+// a recorder with the same name is already attached.
+func (o *Operator) AttachRecorder(rec recorder.DataRecorder) error {
+	if rec == nil {
+		return errors.New("nil recorder")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.recorders[rec.Name()]; ok {
+		return errors.Errorf("recorder %s is already attached", rec.Name())
+	}
+	// The map is replaced, therefore the maps returned from Recorders() are
+	// safe to read.
+	recorders := make(map[string]recorder.DataRecorder, len(o.recorders)+1)
+	for name, r := range o.recorders {
+		recorders[name] = r
+	}
+	recorders[rec.Name()] = rec
+	o.recorders = recorders
+	expRecorders.Add(1)
+	if o.reader != nil {
+		o.name = decorateName(o.reader, o.recorders)
+	}
+	if o.fan != nil {
+		o.fan.add(rec)
+	}
+	return nil
+}
+
+// Status returns the state of the Engine; the time of the last successful
+// read and records, the number of errors and the depth of the queues.
+func (o *Operator) Status() Status { return newStatus(o, o.stat) }
+
+func (o *Operator) stats() *engineStats { return o.stat }
+
+// setFan adds the recorders to the fan, and the recorders attached later are
+// added to it too.
+func (o *Operator) setFan(f *fan) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, rec := range o.recorders {
+		f.add(rec)
+	}
+	o.fan = f
+}
+
 // New generates the Engine based on the provided options.
 func New(options ...func(Engine) error) (Engine, error) {
-	e := &Operator{}
+	e := &Operator{stat: newEngineStats()}
 	for _, op := range options {
 		err := op(e)
 		if err != nil {
@@ -170,3 +341,124 @@ func WithReader(red reader.DataReader) func(Engine) error {
 		return nil
 	}
 }
+
+// WithSpools sets the spools of the recorders, keyed by the recorder names.
+// The jobs that a recorder fails to record are stored in its spool and are
+// replayed when the recorder recovers. Recorders without a spool drop the
+// failed jobs.
+func WithSpools(spools map[string]*spool.Spool) func(Engine) error {
+	return func(e Engine) error {
+		s, ok := e.(spooler)
+		if !ok {
+			return errors.New("engine does not support spools")
+		}
+		s.SetSpools(spools)
+		return nil
+	}
+}
+
+// WithQueues sets the settings of the queues of the recorders, keyed by the
+// recorder names. Each recorder has a queue of the jobs that are waiting to be
+// recorded. When the queue is full, depending on its overflow policy, the
+// reader waits for the recorder, or the oldest or the newest job is dropped.
+// The recorders that are not in the map have a queue of DefaultQueueSize jobs
+// that blocks the reader.
+func WithQueues(queues map[string]config.Queue) func(Engine) error {
+	return func(e Engine) error {
+		q, ok := e.(queuer)
+		if !ok {
+			return errors.New("engine does not support queues")
+		}
+		for name, conf := range queues {
+			if conf.Size < 0 {
+				return errors.Errorf("queue of %s: invalid size: %d", name, conf.Size)
+			}
+			switch conf.Overflow {
+			case "", config.OverflowBlock, config.OverflowDropOldest, config.OverflowDropNewest:
+			default:
+				return errors.Errorf("queue of %s: invalid overflow: %q", name, conf.Overflow)
+			}
+		}
+		q.SetQueues(queues)
+		return nil
+	}
+}
+
+// WithProcessors sets the processors of the payloads of the recorders, keyed by
+// the recorder names. The payloads are processed before they are recorded. The
+// recorders that are not in the map receive the payloads as they are read.
+func WithProcessors(procs map[string]processor.Processor) func(Engine) error {
+	return func(e Engine) error {
+		p, ok := e.(processable)
+		if !ok {
+			return errors.New("engine does not support processors")
+		}
+		for name, proc := range procs {
+			if proc == nil {
+				return errors.Errorf("nil processor for %s", name)
+			}
+		}
+		p.SetProcessors(procs)
+		return nil
+	}
+}
+
+// WithRetry sets the retry policy of the Read and Record calls. Only the
+// errors caused by unavailable endpoints are retried. A nil policy disables
+// the retries.
+func WithRetry(policy *retry.Policy) func(Engine) error {
+	return func(e Engine) error {
+		r, ok := e.(retrier)
+		if !ok {
+			return errors.New("engine does not support retries")
+		}
+		r.SetRetry(policy)
+		return nil
+	}
+}
+
+// WithBreaker guards the reader and each recorder with a circuit breaker. A
+// breaker opens after threshold consecutive failures caused by the endpoint
+// being unavailable, and the engine stops calling the endpoint. Every cooldown
+// the endpoint is pinged and the breaker closes when the ping succeeds. While
+// a recorder's breaker is open, its jobs are spooled if it has a spool,
+// otherwise they are dropped. Zero values are replaced by the defaults.
+func WithBreaker(threshold int, cooldown time.Duration) func(Engine) error {
+	return func(e Engine) error {
+		b, ok := e.(breakable)
+		if !ok {
+			return errors.New("engine does not support breakers")
+		}
+		if threshold < 0 {
+			return errors.Errorf("invalid breaker threshold: %d", threshold)
+		}
+		if cooldown < 0 {
+			return errors.Errorf("invalid breaker cooldown: %s", cooldown)
+		}
+		if threshold == 0 {
+			threshold = DefaultBreakerThreshold
+		}
+		if cooldown == 0 {
+			cooldown = DefaultBreakerCooldown
+		}
+		b.SetBreaker(threshold, cooldown)
+		return nil
+	}
+}
+
+// WithDrainTimeout sets the time the Engine ships the results that are already
+// read to the recorders, after its context is done. When the time passes, the
+// remaining jobs are spooled or abandoned. Zero abandons them immediately.
+func WithDrainTimeout(d time.Duration) func(Engine) error {
+	return func(e Engine) error {
+		dr, ok := e.(drainer)
+		if !ok {
+			return errors.New("engine does not support draining")
+		}
+		if d < 0 {
+			return errors.Errorf("invalid drain timeout: %s", d)
+		}
+		dr.SetDrainTimeout(d)
+		return nil
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -216,6 +217,42 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestAttachRecorder(t *testing.T) {
+	t.Parallel()
+	red := &rdt.Reader{MockName: "red", PingFunc: func() error { return nil }}
+	rec1 := &rct.Recorder{MockName: "rec1", PingFunc: func() error { return nil }}
+	rec2 := &rct.Recorder{MockName: "rec2", PingFunc: func() error { return nil }}
+	e, err := engine.New(
+		engine.WithCtx(context.Background()),
+		engine.WithLogger(tools.DiscardLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(rec1),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+	o := e.(*engine.Operator)
+	recs := o.Recorders()
+	if err = o.AttachRecorder(rec2); err != nil {
+		t.Errorf("AttachRecorder(): err = (%v); want (nil)", err)
+	}
+	if len(recs) != 1 {
+		t.Errorf("len(recs) = (%d); want (1)", len(recs))
+	}
+	if _, ok := o.Recorders()["rec2"]; !ok {
+		t.Errorf("Recorders() = (%v); want (rec2 in it)", o.Recorders())
+	}
+	if !strings.Contains(o.String(), "rec2") {
+		t.Errorf("String() = (%s); want (rec2 in it)", o.String())
+	}
+	if err = o.AttachRecorder(rec2); err == nil {
+		t.Error("already attached: err = (nil); want (error)")
+	}
+	if err = o.AttachRecorder(nil); err == nil {
+		t.Error("nil recorder: err = (nil); want (error)")
+	}
+}
+
 func TestSendJob(t *testing.T) {
 	t.Parallel()
 	recorderID := token.NewUID()
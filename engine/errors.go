@@ -17,6 +17,7 @@ var (
 	ErrNoRecorder = fmt.Errorf("no recorder provided")
 	ErrNoLogger   = fmt.Errorf("no logger provided")
 	ErrNoCtx      = fmt.Errorf("no ctx provided")
+	ErrNotRunning = fmt.Errorf("service is not running")
 )
 
 // PingError is the error when one of readers/recorder has a ping error.
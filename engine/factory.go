@@ -6,22 +6,61 @@ package engine
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
 	"github.com/arsham/expipe/tools"
 	"github.com/arsham/expipe/tools/config"
 	"github.com/pkg/errors"
 )
 
+// DefaultDrainTimeout is the time the engines ship the results that are
+// already read when they are shutting down, if it is not set in the app.
+const DefaultDrainTimeout = 5 * time.Second
+
+// DefaultPingInterval is the interval the Service pings the unavailable
+// endpoints in the Bootstrap.
+const DefaultPingInterval = 10 * time.Second
+
 // Service initialises Engines.
 // Configure injects the input values into the Operator by calling each function
 // on it.
+//
+// If PingInterval is set, the readers and recorders that are not available
+// when the Service starts are pinged in the background on every PingInterval.
+// An Engine whose reader or all its recorders are not available is started
+// when they are back, and the recorders are attached to their running Engines
+// when they are back. Otherwise they are left out.
+//
+// The Conf should not be changed after the Service is started, use Reload
+// instead.
 type Service struct {
-	Log       tools.FieldLogger
-	Ctx       context.Context
-	Conf      *config.ConfMap
-	Configure func(...func(Engine) error) (Engine, error)
+	Log          tools.FieldLogger
+	Ctx          context.Context
+	Conf         *config.ConfMap
+	Configure    func(...func(Engine) error) (Engine, error)
+	PingInterval time.Duration
+
+	reloadMu sync.Mutex // Only one reload at a time.
+	mu       sync.Mutex
+	routes   map[string]*routeRun // Keyed by the reader names.
+	active   int                  // The done channel is closed when it is zero.
+	stopped  bool
+	done     chan struct{}
+}
+
+// routeRun is a route that is running in an Engine, or is waiting for its
+// endpoints.
+type routeRun struct {
+	reader    string
+	recorders []string
+	cancel    context.CancelFunc
+	done      chan struct{}
+	en        Engine // Nil while waiting for the endpoints. Guarded by the Service.
 }
 
 // Start creates some Engines and returns a channel that closes it when it's
@@ -32,62 +71,349 @@ type Service struct {
 func (s *Service) Start() (chan struct{}, error) {
 	// TODO: return a slice of error
 	var (
-		wg       sync.WaitGroup
 		leastOne bool
 		err      error
 	)
 	if s.Configure == nil {
 		s.Configure = New
 	}
-	done := make(chan struct{})
 	if s.Conf == nil {
 		return nil, errors.New("confMap cannot be nil")
 	}
+	s.mu.Lock()
+	s.routes = make(map[string]*routeRun, len(s.Conf.Routes))
+	s.done = make(chan struct{})
+	s.active = 1 // Released when all routes are started.
+	s.stopped = false
+	s.mu.Unlock()
 	for reader, recorders := range s.Conf.Routes {
-		var en Engine
-
-		en, err = s.engine(reader, recorders)
-		if err != nil {
+		if rErr := s.startRoute(reader, recorders); rErr != nil {
+			err = rErr
 			s.Log.Warn(err)
 			continue
 		}
-		wg.Add(1)
 		leastOne = true
-		go func(en Engine) {
-			done := Start(en)
-			<-done
-			s.Log.Infof("Engine's work (%s) has finished", en)
-			wg.Done()
-		}(en)
 	}
 	if !leastOne {
+		s.mu.Lock()
+		s.stopped = true
+		s.mu.Unlock()
 		return nil, err
 	}
+	s.release()
+	return s.done, err
+}
+
+// Reload applies the conf to the running Service. Only the Engines whose
+// reader, recorders or settings have changed are restarted, the new routes
+// are started and the removed ones are stopped. The readers, recorders and
+// spools that have not changed are carried over to the conf, therefore the
+// other Engines keep running without any interruptions. The stopped Engines
+// drain their jobs before the new ones are started.
+//
+// The conf is compared with the running one by their Fingerprints, which
+// config.LoadYAML fills in. An Engine is restarted if any of its fingerprints
+// is missing. The conf should be loaded with config.ReloadYAML, which reuses
+// the running spools instead of opening their directories again. It returns
+// an error if the Service is not running.
+func (s *Service) Reload(conf *config.ConfMap) error {
+	if conf == nil {
+		return errors.New("confMap cannot be nil")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.Lock()
+	if s.done == nil || s.stopped {
+		s.mu.Unlock()
+		return ErrNotRunning
+	}
+	s.active++ // Keeps the Service running while the Engines are restarted.
+	old := s.Conf
+	var stop []*routeRun
+	for reader, r := range s.routes {
+		if routeChanged(old, conf, reader, r.recorders) {
+			stop = append(stop, r)
+			delete(s.routes, reader)
+		}
+	}
+	s.mu.Unlock()
+	defer s.release()
+
+	carryOver(old, conf, s.Log)
+	for _, r := range stop {
+		r.cancel()
+	}
+	for _, r := range stop {
+		<-r.done
+	}
+	closeReplaced(old, conf, s.Log)
+
+	s.mu.Lock()
+	s.Conf = conf
+	s.mu.Unlock()
+	var started int
+	for reader, recorders := range conf.Routes {
+		s.mu.Lock()
+		_, ok := s.routes[reader]
+		s.mu.Unlock()
+		if ok {
+			continue
+		}
+		if err := s.startRoute(reader, recorders); err != nil {
+			s.Log.Warn(err)
+			continue
+		}
+		started++
+	}
+	s.Log.Infof("configuration is reloaded: %d engines stopped, %d started", len(stop), started)
+	return nil
+}
+
+// startRoute starts an Engine for the route in the background. If PingInterval
+// is set and the endpoints are not available, it waits for them in the
+// background.
+func (s *Service) startRoute(reader string, recorders []string) error {
+	ctx, cancel := context.WithCancel(s.Ctx)
+	en, err := s.engine(ctx, reader, recorders)
+	wait := err != nil && s.PingInterval > 0 && isPingError(err)
+	if err != nil && !wait {
+		cancel()
+		return err
+	}
+	if wait {
+		s.Log.Warnf("%v, retrying every %s", err, s.PingInterval)
+	}
+	r := &routeRun{reader: reader, recorders: recorders, cancel: cancel, done: make(chan struct{})}
+	if !wait {
+		r.en = en
+	}
+	s.mu.Lock()
+	s.routes[reader] = r
+	s.active++
+	s.mu.Unlock()
 	go func() {
-		wg.Wait()
-		close(done)
+		defer s.release()
+		defer close(r.done)
+		defer cancel()
+		if wait {
+			if en = s.waitEngine(ctx, reader, recorders); en == nil {
+				return
+			}
+			s.mu.Lock()
+			r.en = en
+			s.mu.Unlock()
+		}
+		s.run(en, recorders)
 	}()
-	return done, err
+	return nil
+}
+
+// Statuses returns the status of the Engines of the routes, sorted by their
+// readers. The Engines that are waiting for their endpoints are not started.
+func (s *Service) Statuses() []Status {
+	s.mu.Lock()
+	routes := make([]*routeRun, 0, len(s.routes))
+	for _, r := range s.routes {
+		routes = append(routes, r)
+	}
+	ens := make([]Engine, len(routes))
+	for i, r := range routes {
+		ens[i] = r.en
+	}
+	s.mu.Unlock()
+	statuses := make([]Status, len(routes))
+	for i, r := range routes {
+		if ens[i] == nil {
+			statuses[i] = Status{Reader: r.reader}
+			for _, name := range r.recorders {
+				statuses[i].Recorders = append(statuses[i].Recorders, RecorderStatus{Name: name})
+			}
+			continue
+		}
+		statuses[i] = engineStatus(ens[i])
+	}
+	sort.Sort(byReader(statuses))
+	return statuses
+}
+
+type byReader []Status
+
+func (b byReader) Len() int           { return len(b) }
+func (b byReader) Less(i, j int) bool { return b[i].Reader < b[j].Reader }
+func (b byReader) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Ready returns true if the Engines of all routes are running with all their
+// recorders.
+func (s *Service) Ready() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil || s.stopped || s.Conf == nil {
+		return false
+	}
+	for reader := range s.Conf.Routes {
+		r, ok := s.routes[reader]
+		if !ok || r.en == nil {
+			return false
+		}
+		select {
+		case <-r.done:
+			return false
+		default:
+		}
+		if len(r.en.Recorders()) < len(r.recorders) {
+			return false
+		}
+	}
+	return true
+}
+
+// release closes the done channel when nothing is running.
+func (s *Service) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.active == 0 {
+		s.stopped = true
+		close(s.done)
+	}
+}
+
+func (s *Service) conf() *config.ConfMap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Conf
 }
 
-func (s *Service) engine(reader string, recorders []string) (Engine, error) {
-	red := s.Conf.Readers[reader]
+// Running returns the conf the Service is running with. It is safe to call
+// while the Service is being reloaded.
+func (s *Service) Running() *config.ConfMap { return s.conf() }
+
+// run starts the Engine and returns when its work has finished. The missing
+// recorders are attached when they are back.
+func (s *Service) run(en Engine, recorders []string) {
+	done := Start(en)
+	if s.PingInterval > 0 {
+		go s.attachMissing(en, recorders, done)
+	}
+	<-done
+	s.Log.Infof("Engine's work (%s) has finished", en)
+}
+
+// waitEngine creates the Engine on every PingInterval until its endpoints are
+// available. It returns nil if the context is done or the Engine can not be
+// created for any other reasons.
+func (s *Service) waitEngine(ctx context.Context, reader string, recorders []string) Engine {
+	ticker := time.NewTicker(s.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+		en, err := s.engine(ctx, reader, recorders)
+		if err == nil {
+			s.Log.Infof("starting %s, its endpoints are available", en)
+			return en
+		}
+		if !isPingError(err) {
+			s.Log.Warn(err)
+			return nil
+		}
+		s.Log.Debugf("%s: %v", reader, err)
+	}
+}
+
+// attachMissing pings the recorders of the route that are not in the Engine
+// on every PingInterval, and attaches them to the Engine when they are back.
+// It returns when all recorders are attached or the Engine is done.
+func (s *Service) attachMissing(en Engine, recorders []string, done chan struct{}) {
+	a, ok := en.(attacher)
+	if !ok {
+		return
+	}
+	var missing []recorder.DataRecorder
+	attached := en.Recorders()
+	conf := s.conf()
+	for _, name := range recorders {
+		rec := conf.Recorders[name]
+		if rec == nil {
+			continue
+		}
+		if _, ok := attached[rec.Name()]; !ok {
+			missing = append(missing, rec)
+		}
+	}
+	ticker := time.NewTicker(s.PingInterval)
+	defer ticker.Stop()
+	for len(missing) > 0 {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		var left []recorder.DataRecorder
+		for _, rec := range missing {
+			if err := rec.Ping(); err != nil {
+				s.Log.Debugf("%s: %v", rec.Name(), err)
+				left = append(left, rec)
+				continue
+			}
+			if err := a.AttachRecorder(rec); err != nil {
+				s.Log.Warnf("attaching %s: %v", rec.Name(), err)
+				continue
+			}
+			s.Log.Infof("%s is available, attached to %s", rec.Name(), en)
+		}
+		missing = left
+	}
+}
+
+func isPingError(err error) bool {
+	_, ok := errors.Cause(err).(PingError)
+	return ok
+}
+
+func (s *Service) engine(ctx context.Context, reader string, recorders []string) (Engine, error) {
+	conf := s.conf()
+	red := conf.Readers[reader]
 	if red == nil {
 		return nil, errors.New("empty reader")
 	}
 	recs := make([]recorder.DataRecorder, 0)
+	spools := make(map[string]*spool.Spool)
+	queues := make(map[string]config.Queue)
+	procs := make(map[string]processor.Processor)
 	for _, rec := range recorders {
-		if r, ok := s.Conf.Recorders[rec]; ok {
+		if r, ok := conf.Recorders[rec]; ok {
 			recs = append(recs, r)
 		}
+		if sp, ok := conf.Spools[rec]; ok {
+			spools[rec] = sp
+		}
+		if q, ok := conf.Queues[rec]; ok {
+			queues[rec] = q
+		}
+		if p, ok := conf.Processors[reader][rec]; ok {
+			procs[rec] = p
+		}
 	}
 	if len(recs) == 0 {
 		return nil, ErrNoRecorder
 	}
-	return s.Configure(
-		WithCtx(s.Ctx),
+	options := []func(Engine) error{
+		WithCtx(ctx),
 		WithReader(red),
 		WithRecorders(recs...),
+		WithSpools(spools),
+		WithQueues(queues),
+		WithProcessors(procs),
+		WithRetry(conf.Retry),
+		WithDrainTimeout(conf.DrainTimeout),
 		WithLogger(s.Log),
-	)
+	}
+	if b := conf.Breaker; b != nil {
+		options = append(options, WithBreaker(b.Threshold, b.Cooldown))
+	}
+	return s.Configure(options...)
 }
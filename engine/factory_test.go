@@ -6,15 +6,20 @@ package engine_test
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/arsham/expipe/tools"
 
+	"github.com/arsham/expipe/datatype"
 	"github.com/arsham/expipe/engine"
 	"github.com/arsham/expipe/reader"
 	rdt "github.com/arsham/expipe/reader/testing"
 	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
 	rct "github.com/arsham/expipe/recorder/testing"
 	"github.com/arsham/expipe/tools/config"
 	"github.com/arsham/expipe/tools/token"
@@ -304,3 +309,428 @@ func TestStartFinishesWhenContextIsCanceled(t *testing.T) {
 		t.Error("Service didn't quit")
 	}
 }
+
+// endpoint is a switch for the availability of the mocked endpoints.
+type endpoint int32
+
+func (e *endpoint) up() { atomic.StoreInt32((*int32)(e), 1) }
+
+func (e *endpoint) ping() error {
+	if atomic.LoadInt32((*int32)(e)) == 0 {
+		return errors.New("endpoint is down")
+	}
+	return nil
+}
+
+func recordingRecorder(name string, ep *endpoint, recorded chan string) *rct.Recorder {
+	return &rct.Recorder{
+		MockName: name,
+		PingFunc: ep.ping,
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			select {
+			case recorded <- name:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	}
+}
+
+func readingReader(name string, ep *endpoint) *rdt.Reader {
+	red := &rdt.Reader{
+		MockName:     name,
+		PingFunc:     ep.ping,
+		MockInterval: 5 * time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(`{"devil":666}`),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	return red
+}
+
+func waitForRecord(t *testing.T, recorded chan string, name string) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case n := <-recorded:
+			if n == name {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("expected %s to record, didn't happen", name)
+		}
+	}
+}
+
+func TestStartWaitsForEndpoints(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name          string
+		readerDown    bool
+		recordersDown bool
+	}{
+		{"reader", true, false},
+		{"recorders", false, true},
+		{"both", true, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var redEp, recEp endpoint
+			if !tc.readerDown {
+				redEp.up()
+			}
+			if !tc.recordersDown {
+				recEp.up()
+			}
+			recorded := make(chan string)
+			confMap := &config.ConfMap{
+				Readers:   map[string]reader.DataReader{"red": readingReader("red", &redEp)},
+				Recorders: map[string]recorder.DataRecorder{"rec": recordingRecorder("rec", &recEp, recorded)},
+				Routes:    map[string][]string{"red": {"rec"}},
+			}
+			s := &engine.Service{
+				Log: newFakeLogger(), Ctx: ctx, Conf: confMap,
+				PingInterval: 5 * time.Millisecond,
+			}
+			done, err := s.Start()
+			if err != nil {
+				t.Fatalf("Start(): err = (%v); want (nil)", err)
+			}
+			select {
+			case <-recorded:
+				t.Fatal("recorded before the endpoints are available")
+			case <-time.After(20 * time.Millisecond):
+			}
+			redEp.up()
+			recEp.up()
+			waitForRecord(t, recorded, "rec")
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Error("Service didn't quit")
+			}
+		})
+	}
+}
+
+func TestStartAttachesRecorders(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var redEp, rec1Ep, rec2Ep endpoint
+	redEp.up()
+	rec1Ep.up()
+	recorded := make(chan string)
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red": readingReader("red", &redEp)},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": recordingRecorder("rec1", &rec1Ep, recorded),
+			"rec2": recordingRecorder("rec2", &rec2Ep, recorded),
+		},
+		Routes: map[string][]string{"red": {"rec1", "rec2"}},
+	}
+	s := &engine.Service{
+		Log: newFakeLogger(), Ctx: ctx, Conf: confMap,
+		PingInterval: 5 * time.Millisecond,
+	}
+	if _, err := s.Start(); err != nil {
+		t.Fatalf("Start(): err = (%v); want (nil)", err)
+	}
+	waitForRecord(t, recorded, "rec1")
+	rec2Ep.up()
+	waitForRecord(t, recorded, "rec2")
+}
+
+func TestStartWithoutPingInterval(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var redEp, recEp endpoint
+	recEp.up()
+	confMap := &config.ConfMap{
+		Readers:   map[string]reader.DataReader{"red": readingReader("red", &redEp)},
+		Recorders: map[string]recorder.DataRecorder{"rec": recordingRecorder("rec", &recEp, make(chan string))},
+		Routes:    map[string][]string{"red": {"rec"}},
+	}
+	s := &engine.Service{Log: newFakeLogger(), Ctx: ctx, Conf: confMap}
+	done, err := s.Start()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if done != nil {
+		t.Errorf("done = (%v); want (nil)", done)
+	}
+}
+
+// closingReader is closed when it is replaced on reload.
+type closingReader struct {
+	*rdt.Reader
+	closed chan struct{}
+}
+
+func (c *closingReader) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ep endpoint
+	ep.up()
+	var pings int32
+	countingReader := func(name string) *rdt.Reader {
+		red := readingReader(name, &ep)
+		red.PingFunc = func() error {
+			atomic.AddInt32(&pings, 1)
+			return nil
+		}
+		return red
+	}
+	recorded := make(chan string)
+	red1 := countingReader("red1")
+	red2 := &closingReader{Reader: readingReader("red2", &ep), closed: make(chan struct{})}
+	rec1 := recordingRecorder("rec1", &ep, recorded)
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red1": red1, "red2": red2},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": rec1,
+			"rec2": recordingRecorder("rec2", &ep, recorded),
+		},
+		Routes: map[string][]string{"red1": {"rec1"}, "red2": {"rec2"}},
+		Fingerprints: map[string]string{
+			"settings": "", "readers.red1": "1", "readers.red2": "2",
+			"recorders.rec1": "1", "recorders.rec2": "2",
+			"processors.red1": "", "processors.red2": "",
+		},
+	}
+	s := &engine.Service{Log: newFakeLogger(), Ctx: ctx, Conf: confMap}
+	done, err := s.Start()
+	if err != nil {
+		t.Fatalf("Start(): err = (%v); want (nil)", err)
+	}
+	waitForRecord(t, recorded, "rec1")
+	waitForRecord(t, recorded, "rec2")
+	started := atomic.LoadInt32(&pings)
+
+	newConf := &config.ConfMap{
+		Readers: map[string]reader.DataReader{"red1": countingReader("red1"), "red3": readingReader("red3", &ep)},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": recordingRecorder("rec1", &ep, recorded),
+			"rec3": recordingRecorder("rec3", &ep, recorded),
+		},
+		Routes: map[string][]string{"red1": {"rec1"}, "red3": {"rec3"}},
+		Fingerprints: map[string]string{
+			"settings": "", "readers.red1": "1", "readers.red3": "3",
+			"recorders.rec1": "1", "recorders.rec3": "3",
+			"processors.red1": "", "processors.red3": "",
+		},
+	}
+	if err = s.Reload(newConf); err != nil {
+		t.Fatalf("Reload(): err = (%v); want (nil)", err)
+	}
+	select {
+	case <-red2.closed:
+	case <-time.After(time.Second):
+		t.Error("the removed reader is not closed")
+	}
+	if newConf.Readers["red1"] != red1 {
+		t.Error("the unchanged reader is not carried over")
+	}
+	if newConf.Recorders["rec1"] != rec1 {
+		t.Error("the unchanged recorder is not carried over")
+	}
+	if got := atomic.LoadInt32(&pings); got != started {
+		t.Errorf("pings = (%d); want (%d): the unchanged engine is restarted", got, started)
+	}
+	waitForRecord(t, recorded, "rec3")
+	waitForRecord(t, recorded, "rec1")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Service didn't quit")
+	}
+	if err = s.Reload(newConf); err != engine.ErrNotRunning {
+		t.Errorf("err = (%v); want (%v)", err, engine.ErrNotRunning)
+	}
+}
+
+// The jobs that are waiting in the spool of a recorder should survive the
+// reloads, and the new max size should be applied to the running spool.
+func TestReloadKeepsSpool(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sp, err := spool.New(dir, 0, tools.DiscardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		err = sp.Push(recorder.Job{
+			ID:      token.NewUID(),
+			Payload: datatype.New([]datatype.DataType{datatype.NewFloatType("queued", float64(i))}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var recEp, redEp endpoint
+	redEp.up()
+	replayed := make(chan float64, 5)
+	spoolingRecorder := func() *rct.Recorder {
+		return &rct.Recorder{
+			MockName: "rec1",
+			PingFunc: func() error { return nil },
+			RecordFunc: func(ctx context.Context, job recorder.Job) error {
+				if err := recEp.ping(); err != nil {
+					return err
+				}
+				for _, d := range job.Payload.List() {
+					if f, ok := d.(*datatype.FloatType); ok && f.Key == "queued" {
+						replayed <- f.Value
+					}
+				}
+				return nil
+			},
+		}
+	}
+	confMap := &config.ConfMap{
+		Readers:      map[string]reader.DataReader{"red1": readingReader("red1", &redEp)},
+		Recorders:    map[string]recorder.DataRecorder{"rec1": spoolingRecorder()},
+		Spools:       map[string]*spool.Spool{"rec1": sp},
+		Routes:       map[string][]string{"red1": {"rec1"}},
+		Fingerprints: map[string]string{"settings": "", "readers.red1": "1", "recorders.rec1": "1", "processors.red1": ""},
+	}
+	s := &engine.Service{Log: newFakeLogger(), Ctx: ctx, Conf: confMap}
+	done, err := s.Start()
+	if err != nil {
+		t.Fatalf("Start(): err = (%v); want (nil)", err)
+	}
+	time.Sleep(20 * time.Millisecond) // Allowing the engine to spool some jobs.
+
+	// config.ReloadYAML reuses the running spool of the same directory.
+	newConf := &config.ConfMap{
+		Readers:      map[string]reader.DataReader{"red1": readingReader("red1", &redEp)},
+		Recorders:    map[string]recorder.DataRecorder{"rec1": spoolingRecorder()},
+		Spools:       map[string]*spool.Spool{"rec1": sp},
+		SpoolSizes:   map[string]int64{"rec1": 10 << 20},
+		Routes:       map[string][]string{"red1": {"rec1"}},
+		Fingerprints: map[string]string{"settings": "", "readers.red1": "1", "recorders.rec1": "2", "processors.red1": ""},
+	}
+	if err = s.Reload(newConf); err != nil {
+		t.Fatalf("Reload(): err = (%v); want (nil)", err)
+	}
+	if sp.MaxSize() != 10<<20 {
+		t.Errorf("sp.MaxSize() = (%d); want (%d)", sp.MaxSize(), 10<<20)
+	}
+	if sp.Len() < 5 {
+		t.Errorf("sp.Len() = (%d); want (>= 5)", sp.Len())
+	}
+
+	recEp.up()
+	for i := 1; i <= 5; i++ {
+		select {
+		case n := <-replayed:
+			if n != float64(i) {
+				t.Errorf("replayed = (%v); want (%d)", n, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %d is not replayed", i)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Service didn't quit")
+	}
+}
+
+func TestReloadErrors(t *testing.T) {
+	t.Parallel()
+	s := &engine.Service{Log: newFakeLogger(), Ctx: context.Background()}
+	if err := s.Reload(nil); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := s.Reload(&config.ConfMap{}); err != engine.ErrNotRunning {
+		t.Errorf("err = (%v); want (%v)", err, engine.ErrNotRunning)
+	}
+}
+
+func TestServiceStatuses(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var upEp, downEp endpoint
+	upEp.up()
+	recorded := make(chan string)
+	confMap := &config.ConfMap{
+		Readers: map[string]reader.DataReader{
+			"red1": readingReader("red1", &upEp),
+			"red2": readingReader("red2", &downEp),
+		},
+		Recorders: map[string]recorder.DataRecorder{
+			"rec1": recordingRecorder("rec1", &upEp, recorded),
+			"rec2": recordingRecorder("rec2", &upEp, recorded),
+		},
+		Routes: map[string][]string{"red1": {"rec1"}, "red2": {"rec2"}},
+	}
+	s := &engine.Service{
+		Log: newFakeLogger(), Ctx: ctx, Conf: confMap,
+		PingInterval: 5 * time.Millisecond,
+	}
+	if s.Ready() {
+		t.Error("Ready() = (true) before starting; want (false)")
+	}
+	if _, err := s.Start(); err != nil {
+		t.Fatalf("Start(): err = (%v); want (nil)", err)
+	}
+	waitForRecord(t, recorded, "rec1")
+	if s.Ready() {
+		t.Error("Ready() = (true) while red2 is down; want (false)")
+	}
+	statuses := s.Statuses()
+	if len(statuses) != 2 {
+		t.Fatalf("len(statuses) = (%d); want (2)", len(statuses))
+	}
+	red1, red2 := statuses[0], statuses[1]
+	if red1.Reader != "red1" || !red1.Started || red1.LastRead.IsZero() {
+		t.Errorf("statuses[0] = (%+v); want (started red1 with a read)", red1)
+	}
+	if len(red1.Recorders) != 1 || red1.Recorders[0].Name != "rec1" {
+		t.Fatalf("statuses[0].Recorders = (%+v); want (rec1)", red1.Recorders)
+	}
+	if red2.Reader != "red2" || red2.Started {
+		t.Errorf("statuses[1] = (%+v); want (red2 not started)", red2)
+	}
+
+	downEp.up()
+	waitForRecord(t, recorded, "rec2")
+	if !s.Ready() {
+		t.Error("Ready() = (false); want (true)")
+	}
+	// The record is counted when the recorder returns.
+	waitForRecord(t, recorded, "rec1")
+	if rec1 := s.Statuses()[0].Recorders[0]; rec1.LastRecord.IsZero() {
+		t.Errorf("LastRecord of rec1 = (%v); want (a time)", rec1.LastRecord)
+	}
+	cancel()
+}
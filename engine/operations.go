@@ -7,49 +7,108 @@ package engine
 import (
 	"context"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/arsham/expipe/tools"
 
 	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/reader"
 	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
+	"github.com/arsham/expipe/tools/config"
+	"github.com/arsham/expipe/tools/retry"
 	"github.com/arsham/expipe/tools/token"
 	"github.com/pkg/errors"
 )
 
 var chanBuffer = 100
 
+// stopGrace is the time the engine waits for the recorders that do not return
+// when their context is cancelled.
+var stopGrace = time.Second
+
+// flusher is implemented by the recorders that buffer the jobs.
+type flusher interface {
+	Flush() error
+}
+
 // Start begins pulling data from DataReader and chip them to the DataRecorder.
-// When the context is cancelled or timed out, the engine abandons its
-// operations and returns an error if accrued.
+// When the context is cancelled or timed out, the engine stops reading and
+// ships the results that are already read to the recorders until the drain
+// timeout. Then it flushes the recorders that buffer the jobs, logs how many
+// jobs were delivered and abandoned, and closes the returned channel.
 func Start(e Engine) chan struct{} {
 	stop := make(chan struct{})
 	go func() {
-		dispatch := dispatchLoop(e.Ctx(), e.Log(), e.Recorders())
-		for {
-			if ok := iterate(e, dispatch, stop); !ok {
-				return
-			}
+		var policy *retry.Policy
+		if r, ok := e.(retrier); ok {
+			policy = r.Retry()
+		}
+		var timeout time.Duration
+		if d, ok := e.(drainer); ok {
+			timeout = d.DrainTimeout()
 		}
+		var stats *engineStats
+		if m, ok := e.(monitor); ok {
+			stats = m.stats()
+		}
+		brk := newEngineBreaker(e, "reader/"+e.Reader().Name(), e.Reader().Ping)
+		f := dispatchLoop(e, policy, stats)
+		for iterate(e, policy, brk, stats, f.dispatch) {
+		}
+		f.shutdown(timeout)
+		close(stop)
 	}()
 	go func() {
 		for {
 			numGoroutines.Set(int64(runtime.NumGoroutine()))
-			time.Sleep(50 * time.Millisecond)
+			select {
+			case <-stop:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
 		}
 	}()
 	return stop
 }
 
-func iterate(e Engine, dispatch chan *reader.Result, stop chan struct{}) bool {
+// newEngineBreaker returns a breaker for the endpoint if the engine has
+// breakers, otherwise it returns nil.
+func newEngineBreaker(e Engine, name string, ping func() error) *breaker {
+	b, ok := e.(breakable)
+	if !ok {
+		return nil
+	}
+	threshold, cooldown := b.Breaker()
+	return newBreaker(name, threshold, cooldown, ping, e.Log())
+}
+
+// iterate returns false when the context of the engine is done.
+func iterate(e Engine, policy *retry.Policy, brk *breaker, stats *engineStats, dispatch chan *reader.Result) bool {
 	timer := time.NewTimer(e.Reader().Interval())
+	defer timer.Stop()
 	select {
 	case <-timer.C:
+		if !brk.allow() {
+			skippedJobs.Add(1)
+			break
+		}
 		waitingReadJobs.Add(1)
 		defer waitingReadJobs.Add(-1)
 		job := token.New(e.Ctx())
-		res, err := e.Reader().Read(job)
+		var res *reader.Result
+		attempts, err := policy.Do(job, func() error {
+			var err error
+			res, err = e.Reader().Read(job)
+			return err
+		})
+		retriedJobs.Add(int64(attempts - 1))
+		if e.Ctx().Err() == nil {
+			brk.report(err)
+			stats.read(err)
+		}
 		if errors.Cause(err) != nil {
 			erroredJobs.Add(1)
 			e.Log().Errorf("read job: %v", err)
@@ -61,70 +120,355 @@ func iterate(e Engine, dispatch chan *reader.Result, stop chan struct{}) bool {
 			break
 		}
 		readJobs.Add(1)
-		dispatch <- res
+		select {
+		case dispatch <- res:
+		default:
+			// The recorders are blocking the reader.
+			select {
+			case dispatch <- res:
+			case <-e.Ctx().Done():
+				abandonedJobs.Add(int64(len(e.Recorders())))
+				return false
+			}
+		}
 	case <-e.Ctx().Done():
-		close(stop)
 		return false
 	}
 	return true
 }
 
+// worker ships the results to a recorder. The ctx is independent of the
+// engine's context, and is cancelled when the drain timeout passes.
+type worker struct {
+	ctx      context.Context
+	log      tools.FieldLogger
+	rec      recorder.DataRecorder
+	spool    *spool.Spool
+	policy   *retry.Policy
+	brk      *breaker
+	queue    *queue
+	proc     processor.Processor
+	stats    *recorderStats
+	recorded int // Number of the recorded jobs, including the replayed ones.
+	dropped  int // Number of the jobs that are neither recorded nor spooled.
+}
+
+// drainReport shows what happened to the jobs when the engine was shutting
+// down.
+type drainReport struct {
+	delivered int // Recorded jobs.
+	abandoned int // Dropped jobs.
+	spooled   int // Jobs left in the spools.
+}
+
+// fan starts a worker for each recorder and sends them the results. New
+// recorders can be added while it is running.
+type fan struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	log      tools.FieldLogger
+	brk      func(name string, ping func() error) *breaker
+	spools   map[string]*spool.Spool
+	queues   map[string]config.Queue
+	procs    map[string]processor.Processor
+	policy   *retry.Policy
+	stats    *engineStats
+	dispatch chan *reader.Result
+	fanned   chan struct{} // Closed when fanOut returns.
+	drain    chan struct{} // Closed when the workers should drain their queues.
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	workers []*worker
+	closed  bool
+	report  drainReport
+}
+
 // dispatchLoop starts a goroutine for each recorder and fans out the results.
-// Engine can send send the results through the returning channel.
-func dispatchLoop(ctx context.Context, log tools.FieldLogger, recs map[string]recorder.DataRecorder) chan *reader.Result {
-	dispatch := make(chan *reader.Result, len(recs)*chanBuffer)
-	ring := make([]chan *reader.Result, len(recs))
-	var i int
-	for _, rec := range recs {
-		d := make(chan *reader.Result, chanBuffer)
-		ring[i] = d
-		i++
-		go dispatchRecord(ctx, log, rec, d)
-	}
-	go fanOut(ring, dispatch)
-	return dispatch
-}
-
-func dispatchRecord(ctx context.Context, log tools.FieldLogger, rec recorder.DataRecorder, dispatch chan *reader.Result) {
-	for {
+// Engine can send send the results through the dispatch channel of the fan.
+func dispatchLoop(e Engine, policy *retry.Policy, stats *engineStats) *fan {
+	ctx, cancel := context.WithCancel(context.Background())
+	recs := e.Recorders()
+	f := &fan{
+		ctx:      ctx,
+		cancel:   cancel,
+		log:      e.Log(),
+		policy:   policy,
+		stats:    stats,
+		dispatch: make(chan *reader.Result, len(recs)*chanBuffer),
+		fanned:   make(chan struct{}),
+		drain:    make(chan struct{}),
+		brk: func(name string, ping func() error) *breaker {
+			// A recorder can be in more than one engine, each one with its
+			// own breaker.
+			return newEngineBreaker(e, e.Reader().Name()+"/recorder/"+name, ping)
+		},
+	}
+	if s, ok := e.(spooler); ok {
+		f.spools = s.Spools()
+	}
+	if q, ok := e.(queuer); ok {
+		f.queues = q.Queues()
+	}
+	if p, ok := e.(processable); ok {
+		f.procs = p.Processors()
+	}
+	if a, ok := e.(attacher); ok {
+		a.setFan(f)
+	} else {
+		for _, rec := range recs {
+			f.add(rec)
+		}
+	}
+	go f.fanOut()
+	return f
+}
+
+// add starts a worker for the recorder. It is a no-op when the fan is shutting
+// down.
+func (f *fan) add(rec recorder.DataRecorder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	q := newQueue(rec.Name(), f.queues[rec.Name()])
+	w := &worker{
+		ctx:    f.ctx,
+		log:    f.log,
+		rec:    rec,
+		spool:  f.spools[rec.Name()],
+		policy: f.policy,
+		brk:    f.brk(rec.Name(), rec.Ping),
+		queue:  q,
+		proc:   f.procs[rec.Name()],
+		stats:  f.stats.recorder(rec.Name(), q),
+	}
+	f.workers = append(f.workers, w)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		r := w.run(f.drain)
+		f.mu.Lock()
+		f.report.delivered += r.delivered
+		f.report.abandoned += r.abandoned
+		f.report.spooled += r.spooled
+		f.mu.Unlock()
+	}()
+}
+
+// fanOut sends each result from dispatch to the queues of all workers. A full
+// queue with the block policy holds up the others and the reader, until
+// there is room in it or the fan is cancelled.
+func (f *fan) fanOut() {
+	defer close(f.fanned)
+	for res := range f.dispatch {
+		f.mu.Lock()
+		workers := f.workers
+		f.mu.Unlock()
+		for _, w := range workers {
+			w.queue.push(f.ctx, res)
+		}
+	}
+}
+
+// shutdown should be called when nothing sends to the dispatch channel
+// anymore. The workers ship the queued results until the timeout, then the
+// recorders are flushed.
+func (f *fan) shutdown(timeout time.Duration) {
+	timer := time.AfterFunc(timeout, f.cancel)
+	defer timer.Stop()
+	f.mu.Lock()
+	drops := make([]int, len(f.workers))
+	for i, w := range f.workers {
+		drops[i] = w.queue.dropped()
+	}
+	f.mu.Unlock()
+	// fanOut might be waiting for a full queue, it returns when there is room
+	// or the fan is cancelled.
+	close(f.dispatch)
+	<-f.fanned
+	f.mu.Lock()
+	f.closed = true
+	for i := range drops {
+		f.report.abandoned += f.workers[i].queue.dropped() - drops[i]
+	}
+	f.mu.Unlock()
+
+	close(f.drain)
+	waited := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-f.ctx.Done():
 		select {
-		case result := <-dispatch:
-			res := make([]byte, len(result.Content))
-			copy(res, result.Content)
-			payload, err := datatype.JobResultDataTypes(res, result.Mapper.Copy())
-			if err != nil {
-				log.Errorf("error in payload: %s", err)
-				return
-			}
-			waitingRecordJobs.Add(1)
-			job := recorder.Job{
-				ID:        result.ID,
-				Payload:   payload,
-				IndexName: rec.IndexName(),
-				TypeName:  result.TypeName,
-				Time:      result.Time,
-			}
-			err = rec.Record(ctx, job)
-			if err != nil {
-				waitingRecordJobs.Add(-1)
-				log.Errorf("record error: %v", err)
+		case <-waited:
+		case <-time.After(stopGrace):
+			f.log.Warnf("some recorders did not stop %s after the drain timeout, abandoning them", stopGrace)
+		}
+	}
+	f.cancel()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, w := range f.workers {
+		if fl, ok := w.rec.(flusher); ok {
+			if err := fl.Flush(); err != nil {
+				f.log.Errorf("flushing %s: %v", w.rec.Name(), err)
 			}
-			waitingRecordJobs.Add(-1)
-			recordJobs.Add(1)
-		case <-ctx.Done():
+		}
+	}
+	abandonedJobs.Add(int64(f.report.abandoned))
+	f.log.Infof("drained: %d jobs delivered, %d abandoned, %d left in the spools",
+		f.report.delivered, f.report.abandoned, f.report.spooled)
+}
+
+// run ships the queued results until drain is closed, then it drains the
+// queue.
+func (w *worker) run(drain chan struct{}) drainReport {
+	for {
+		if res, ok := w.queue.pop(); ok {
+			w.ship(res)
+			continue
+		}
+		select {
+		case <-w.queue.ready:
+		case <-drain:
+			return w.drain()
 		}
 	}
 }
 
-// fanOut sends each job from dispatch to all ring channels.
-// It starts a goroutine for each job.
-func fanOut(ring []chan *reader.Result, dispatch chan *reader.Result) {
+// drain ships the rest of the queue. When the context is done, the remaining
+// jobs are spooled, or dropped if the recorder has no spool.
+func (w *worker) drain() drainReport {
+	recorded, dropped := w.recorded, w.dropped
 	for {
-		job := <-dispatch
-		for _, r := range ring {
-			go func(r chan *reader.Result) {
-				r <- job
-			}(r)
+		res, ok := w.queue.pop()
+		if !ok {
+			break
 		}
+		if w.ctx.Err() == nil {
+			w.ship(res)
+			continue
+		}
+		if job, ok := w.job(res); ok {
+			w.spoolOrDrop(job)
+		}
+	}
+	r := drainReport{
+		delivered: w.recorded - recorded,
+		abandoned: w.dropped - dropped,
 	}
+	if w.spool != nil {
+		r.spooled = w.spool.Len()
+	}
+	return r
+}
+
+func (w *worker) ship(res *reader.Result) {
+	if job, ok := w.job(res); ok {
+		w.record(job)
+	}
+}
+
+// job returns false if the payload of the result can not be decoded or
+// processed, or the processors remove all its values.
+func (w *worker) job(result *reader.Result) (recorder.Job, bool) {
+	res := make([]byte, len(result.Content))
+	copy(res, result.Content)
+	payload, err := datatype.JobResultDataTypes(res, result.Mapper.Copy())
+	if err != nil {
+		erroredJobs.Add(1)
+		w.dropped++
+		w.log.Errorf("error in payload: %s", err)
+		return recorder.Job{}, false
+	}
+	if w.proc != nil {
+		if payload, err = w.proc.Process(payload); err != nil {
+			erroredJobs.Add(1)
+			w.dropped++
+			w.log.Errorf("processing payload: %s", err)
+			return recorder.Job{}, false
+		}
+		if payload == nil || payload.Len() == 0 {
+			return recorder.Job{}, false
+		}
+	}
+	return recorder.Job{
+		ID:        result.ID,
+		Payload:   payload,
+		IndexName: w.rec.IndexName(),
+		TypeName:  result.TypeName,
+		Time:      result.Time,
+	}, true
+}
+
+// record ships the job to the recorder. If the recorder has a spool, the job
+// is stored in the spool when the recorder fails. While there are jobs in the
+// spool, new jobs are queued behind them and the spool is replayed, therefore
+// the recorder receives the jobs in order. While the breaker is open the
+// recorder is not called, and the job is spooled or dropped.
+func (w *worker) record(job recorder.Job) {
+	waitingRecordJobs.Add(1)
+	defer waitingRecordJobs.Add(-1)
+	if !w.brk.allow() {
+		skippedJobs.Add(1)
+		w.spoolOrDrop(job)
+		return
+	}
+	if w.spool == nil || w.spool.Len() == 0 {
+		err := w.tryRecord(job)
+		if err == nil {
+			recordJobs.Add(1)
+			w.recorded++
+			return
+		}
+		w.log.Errorf("record error: %v", err)
+		w.spoolOrDrop(job)
+		return
+	}
+	if !w.spoolJob(job) {
+		w.dropped++
+		return
+	}
+	n, err := w.spool.Replay(w.ctx, w.tryRecord)
+	recordJobs.Add(int64(n))
+	w.recorded += n
+	if n > 0 {
+		w.log.Infof("replayed %d jobs from the spool", n)
+	}
+	if err != nil {
+		w.log.Warnf("replaying the spool: %v (%d jobs waiting)", err, w.spool.Len())
+	}
+}
+
+// tryRecord records the job, and retries with the retry policy if the
+// recorder is not available.
+func (w *worker) tryRecord(job recorder.Job) error {
+	attempts, err := w.policy.Do(w.ctx, func() error {
+		return w.rec.Record(w.ctx, job)
+	})
+	retriedJobs.Add(int64(attempts - 1))
+	if w.ctx.Err() == nil {
+		w.brk.report(err)
+		w.stats.record(err)
+	}
+	return err
+}
+
+func (w *worker) spoolOrDrop(job recorder.Job) {
+	if w.spool == nil || !w.spoolJob(job) {
+		w.dropped++
+	}
+}
+
+func (w *worker) spoolJob(job recorder.Job) bool {
+	if err := w.spool.Push(job); err != nil {
+		w.log.Errorf("spooling job %s: %v", job.ID, err)
+		return false
+	}
+	return true
 }
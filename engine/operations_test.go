@@ -7,15 +7,26 @@ package engine_test
 import (
 	"bytes"
 	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/reader"
 	rdt "github.com/arsham/expipe/reader/testing"
 	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
 	rct "github.com/arsham/expipe/recorder/testing"
+	"github.com/arsham/expipe/tools/config"
+	"github.com/arsham/expipe/tools/retry"
 	"github.com/arsham/expipe/tools/token"
 
 	"github.com/arsham/expipe/engine"
@@ -211,8 +222,10 @@ func TestReadErrorBadPayload(t *testing.T) {
 	log := newFakeLogger()
 	registered := make(chan struct{})
 	recorded := make(chan struct{})
+	var once sync.Once
+	// The worker carries on with the next results.
 	log.ErrorfFunc = func(string, ...interface{}) {
-		close(registered)
+		once.Do(func() { close(registered) })
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -399,3 +412,562 @@ func TestEngineDispatchesToRecorders(t *testing.T) {
 		t.Error("expected to record, didn't happen")
 	}
 }
+
+func TestRecordSpool(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sp, err := spool.New(dir, 0, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 20
+	var read int
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		if read == total {
+			return nil, nil
+		}
+		read++
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(fmt.Sprintf(`{"n":%d}`, read)),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+
+	var (
+		calls int
+		got   []float64
+	)
+	done := make(chan struct{})
+	rec := &rct.Recorder{
+		MockName: "rec1",
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			calls++
+			if calls <= 5 {
+				return errExample
+			}
+			got = append(got, job.Payload.List()[0].(*datatype.FloatType).Value)
+			if len(got) == total {
+				close(done)
+			}
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+		engine.WithSpools(map[string]*spool.Spool{"rec1": sp}),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+
+	engine.Start(e)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("didn't record all %d jobs", total)
+	}
+	// fanOut does not keep the order of the results, therefore only the
+	// delivery of every job is checked here.
+	sort.Float64s(got)
+	for i, n := range got {
+		if n != float64(i+1) {
+			t.Fatalf("got = (%v); want every job once", got)
+		}
+	}
+	if sp.Len() != 0 {
+		t.Errorf("sp.Len() = (%d); want (0)", sp.Len())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	policy := &retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	var reads int
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		reads++
+		if reads <= 2 {
+			return nil, reader.EndpointNotAvailableError{Endpoint: "red", Err: errExample}
+		}
+		if reads > 3 {
+			return nil, nil
+		}
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(fmt.Sprintf(`{"reads":%d}`, reads)),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	var records int
+	recorded := make(chan float64)
+	rec := &rct.Recorder{
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			records++
+			if records <= 2 {
+				return recorder.EndpointNotAvailableError{Endpoint: "rec", Err: errExample}
+			}
+			recorded <- job.Payload.List()[0].(*datatype.FloatType).Value
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+		engine.WithRetry(policy),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+
+	engine.Start(e)
+	select {
+	case n := <-recorded:
+		if n != 3 {
+			t.Errorf("reads = (%v); want (3)", n)
+		}
+		if records != 3 {
+			t.Errorf("records = (%d); want (3)", records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to record, didn't happen")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reads int32
+	red := &rdt.Reader{
+		MockName:     "breaker_reader",
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		atomic.AddInt32(&reads, 1)
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(`{"devil":666}`),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	var records, pings int32
+	rec := &rct.Recorder{
+		MockName: "breaker_recorder",
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			atomic.AddInt32(&records, 1)
+			return recorder.EndpointNotAvailableError{Endpoint: "rec", Err: errExample}
+		},
+	}
+	rec.PingFunc = func() error {
+		atomic.AddInt32(&pings, 1)
+		return nil
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+		engine.WithBreaker(2, time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+	pinged := atomic.LoadInt32(&pings)
+
+	engine.Start(e)
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&reads) < 20 {
+		select {
+		case <-deadline:
+			t.Fatal("expected to read, didn't happen")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	// Allowing the dispatched jobs to reach the recorder.
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&records); n != 2 {
+		t.Errorf("records = (%d); want (2)", n)
+	}
+	if n := atomic.LoadInt32(&pings); n != pinged {
+		t.Errorf("pings = (%d); want (%d)", n, pinged)
+	}
+	// The recorder can be in other engines with their own breakers.
+	state := expvar.Get("Breakers").(*expvar.Map).Get("breaker_reader/recorder/breaker_recorder")
+	if state == nil || state.String() != `"open"` {
+		t.Errorf("breaker state = (%v); want (%q)", state, "open")
+	}
+}
+
+func TestWithBreakerErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+	}{
+		{"threshold", -1, time.Second},
+		{"cooldown", 1, -time.Second},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := engine.WithBreaker(tc.threshold, tc.cooldown)(&engine.Operator{})
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+// flushRecorder counts the Flush calls.
+type flushRecorder struct {
+	*rct.Recorder
+	flushes int32
+}
+
+func (f *flushRecorder) Flush() error {
+	atomic.AddInt32(&f.flushes, 1)
+	return nil
+}
+
+func TestShutdownDrains(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reads, records int32
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		n := atomic.AddInt32(&reads, 1)
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(fmt.Sprintf(`{"n":%d}`, n)),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	var last float64
+	rec := &flushRecorder{Recorder: &rct.Recorder{
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			// The recorder is slower than the reader, therefore the results
+			// are queued.
+			time.Sleep(3 * time.Millisecond)
+			n := job.Payload.List()[0].(*datatype.FloatType).Value
+			if n != last+1 {
+				t.Errorf("n = (%v); want (%v)", n, last+1)
+			}
+			last = n
+			atomic.AddInt32(&records, 1)
+			return nil
+		},
+	}}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(newFakeLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+		engine.WithDrainTimeout(5*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+
+	done := engine.Start(e)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the engine to quit, didn't happen")
+	}
+	r, n := atomic.LoadInt32(&reads), atomic.LoadInt32(&records)
+	if n == 0 || n != r {
+		t.Errorf("records = (%d); want (%d)", n, r)
+	}
+	if f := atomic.LoadInt32(&rec.flushes); f != 1 {
+		t.Errorf("flushes = (%d); want (1)", f)
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	t.Parallel()
+	log := newFakeLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir, err := ioutil.TempDir("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sp, err := spool.New(dir, 0, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reads int32
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		atomic.AddInt32(&reads, 1)
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(`{"devil":666}`),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	started := make(chan struct{})
+	var once sync.Once
+	rec := &rct.Recorder{
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			once.Do(func() { close(started) })
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(log),
+		engine.WithReader(red),
+		engine.WithRecorders(rec),
+		engine.WithSpools(map[string]*spool.Spool{rec.Name(): sp}),
+		engine.WithDrainTimeout(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+
+	done := engine.Start(e)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to record, didn't happen")
+	}
+	for atomic.LoadInt32(&reads) < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the engine to quit, didn't happen")
+	}
+	// None of the jobs are recorded, they should be in the spool.
+	if n, r := sp.Len(), int(atomic.LoadInt32(&reads)); n != r {
+		t.Errorf("sp.Len() = (%d); want (%d)", n, r)
+	}
+}
+
+func TestWithDrainTimeoutError(t *testing.T) {
+	t.Parallel()
+	err := engine.WithDrainTimeout(-time.Second)(&engine.Operator{})
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestQueueDoesNotHoldUpOthers(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(`{"devil":666}`),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	slow := &rct.Recorder{
+		MockName: "slow",
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	var records int32
+	fast := &rct.Recorder{
+		MockName: "fast",
+		PingFunc: func() error { return nil },
+		RecordFunc: func(ctx context.Context, job recorder.Job) error {
+			atomic.AddInt32(&records, 1)
+			return nil
+		},
+	}
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(newFakeLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(slow, fast),
+		engine.WithQueues(map[string]config.Queue{
+			"slow": {Size: 2, Overflow: config.OverflowDropOldest},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+
+	engine.Start(e)
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&records) < 20 {
+		select {
+		case <-deadline:
+			t.Fatalf("records = (%d); want (20)", atomic.LoadInt32(&records))
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWithQueuesErrors(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		name  string
+		queue config.Queue
+	}{
+		{"size", config.Queue{Size: -1}},
+		{"overflow", config.Queue{Overflow: "explode"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := engine.WithQueues(map[string]config.Queue{"rec": tc.queue})(&engine.Operator{})
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestProcessors(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	red := &rdt.Reader{
+		PingFunc:     func() error { return nil },
+		MockInterval: time.Millisecond,
+		MockMapper:   datatype.DefaultMapper(),
+	}
+	red.ReadFunc = func(job *token.Context) (*reader.Result, error) {
+		return &reader.Result{
+			ID:       job.ID(),
+			Content:  []byte(`{"devil":666,"drop_me":1}`),
+			TypeName: red.TypeName(),
+			Mapper:   red.Mapper(),
+		}, nil
+	}
+	payloads := func(name string) (*rct.Recorder, chan datatype.DataContainer) {
+		ch := make(chan datatype.DataContainer, 1)
+		return &rct.Recorder{
+			MockName: name,
+			PingFunc: func() error { return nil },
+			RecordFunc: func(ctx context.Context, job recorder.Job) error {
+				select {
+				case ch <- job.Payload:
+				default:
+				}
+				return nil
+			},
+		}, ch
+	}
+	raw, rawCh := payloads("raw")
+	processed, processedCh := payloads("processed")
+	empty, emptyCh := payloads("empty")
+	e, err := engine.New(
+		engine.WithCtx(ctx),
+		engine.WithLogger(newFakeLogger()),
+		engine.WithReader(red),
+		engine.WithRecorders(raw, processed, empty),
+		engine.WithProcessors(map[string]processor.Processor{
+			"processed": processor.Chain{processor.Drop{"drop_*"}, processor.Rename{"devil": "angel"}},
+			"empty":     processor.Drop{"*"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New(): err = (%v); want (nil)", err)
+	}
+	engine.Start(e)
+
+	check := func(name string, ch chan datatype.DataContainer, want []datatype.DataType) {
+		select {
+		case payload := <-ch:
+			got := payload.List()
+			if len(got) != len(want) {
+				t.Fatalf("%s: payload = (%v); want (%v)", name, got, want)
+			}
+			for i := range want {
+				if !got[i].Equal(want[i]) {
+					t.Errorf("%s: payload[%d] = (%v); want (%v)", name, i, got[i], want[i])
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s didn't receive a payload", name)
+		}
+	}
+	check("processed", processedCh, []datatype.DataType{datatype.NewFloatType("angel", 666)})
+	got := <-rawCh
+	if got.Len() != 2 {
+		t.Errorf("raw: payload = (%v); want (2 values)", got.List())
+	}
+	select {
+	case payload := <-emptyCh:
+		t.Errorf("empty: received (%v); want (nothing)", payload.List())
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWithProcessorsErrors(t *testing.T) {
+	t.Parallel()
+	err := engine.WithProcessors(map[string]processor.Processor{"rec": nil})(&engine.Operator{})
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
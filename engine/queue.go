@@ -0,0 +1,149 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"expvar"
+	"sync"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools/config"
+)
+
+// DefaultQueueSize is the number of the jobs that can wait for a recorder, if
+// not specified. The default overflow policy is to block the reader.
+const DefaultQueueSize = 1000
+
+var (
+	queueDepths = expvar.NewMap("Queue Depths")
+	queueDrops  = expvar.NewMap("Queue Drops")
+	queueVarsMu sync.Mutex
+)
+
+// queueVar returns the counter of the recorder in the map. The recorders that
+// are shared between the engines share their counters.
+func queueVar(m *expvar.Map, name string) *expvar.Int {
+	queueVarsMu.Lock()
+	defer queueVarsMu.Unlock()
+	if v, ok := m.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	m.Set(name, v)
+	return v
+}
+
+// queue holds the results waiting for a worker, in the order they are read.
+// When it is full, the overflow policy decides what to do with the new
+// results.
+type queue struct {
+	size     int
+	overflow string
+	depth    *expvar.Int
+	dropVar  *expvar.Int
+
+	mu    sync.Mutex
+	items []*reader.Result
+	drops int
+	ready chan struct{} // Receives a value when a result is pushed.
+	space chan struct{} // Receives a value when a result is popped.
+}
+
+func newQueue(name string, conf config.Queue) *queue {
+	q := &queue{
+		size:     conf.Size,
+		overflow: conf.Overflow,
+		depth:    queueVar(queueDepths, name),
+		dropVar:  queueVar(queueDrops, name),
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+	if q.size <= 0 {
+		q.size = DefaultQueueSize
+	}
+	if q.overflow == "" {
+		q.overflow = config.OverflowBlock
+	}
+	return q
+}
+
+// push adds the result to the queue. If the queue is full and the policy is
+// to block, it waits until there is room or the ctx is done. In which case
+// the result is dropped.
+func (q *queue) push(ctx context.Context, r *reader.Result) {
+	q.mu.Lock()
+	for len(q.items) >= q.size {
+		switch q.overflow {
+		case config.OverflowDropNewest:
+			q.drop()
+			q.mu.Unlock()
+			return
+		case config.OverflowDropOldest:
+			q.items[0] = nil
+			q.items = q.items[1:]
+			q.depth.Add(-1)
+			q.drop()
+			continue
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.drop()
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Lock()
+	}
+	q.items = append(q.items, r)
+	q.depth.Add(1)
+	q.mu.Unlock()
+	signal(q.ready)
+}
+
+// drop should be called when the lock is held.
+func (q *queue) drop() {
+	q.drops++
+	q.dropVar.Add(1)
+}
+
+// pop returns false if the queue is empty.
+func (q *queue) pop() (*reader.Result, bool) {
+	q.mu.Lock()
+	if len(q.items) == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+	r := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.depth.Add(-1)
+	q.mu.Unlock()
+	signal(q.space)
+	return r, true
+}
+
+// len returns the number of the results waiting in the queue.
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// dropped returns the number of the dropped results.
+func (q *queue) dropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.drops
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools/config"
+	"github.com/arsham/expipe/tools/token"
+)
+
+func results(n int) []*reader.Result {
+	res := make([]*reader.Result, n)
+	for i := range res {
+		res[i] = &reader.Result{ID: token.NewUID(), TypeName: string('a' + byte(i))}
+	}
+	return res
+}
+
+func popAll(q *queue) string {
+	var names string
+	for {
+		r, ok := q.pop()
+		if !ok {
+			return names
+		}
+		names += r.TypeName
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tcs := []struct {
+		overflow string
+		want     string
+	}{
+		{config.OverflowDropOldest, "cde"},
+		{config.OverflowDropNewest, "abc"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.overflow, func(t *testing.T) {
+			name := "queue_overflow_" + tc.overflow
+			q := newQueue(name, config.Queue{Size: 3, Overflow: tc.overflow})
+			drops := q.dropVar.Value()
+			for _, r := range results(5) {
+				q.push(context.Background(), r)
+			}
+			if d := q.depth.Value(); d != 3 {
+				t.Errorf("depth = (%d); want (3)", d)
+			}
+			if d := q.dropped(); d != 2 {
+				t.Errorf("q.dropped() = (%d); want (2)", d)
+			}
+			if d := q.dropVar.Value() - drops; d != 2 {
+				t.Errorf("drops = (%d); want (2)", d)
+			}
+			if got := popAll(q); got != tc.want {
+				t.Errorf("got = (%s); want (%s)", got, tc.want)
+			}
+			if d := q.depth.Value(); d != 0 {
+				t.Errorf("depth = (%d); want (0)", d)
+			}
+			if queueDepths.Get(name) != q.depth {
+				t.Errorf("queueDepths[%s] = (%v); want (%v)", name, queueDepths.Get(name), q.depth)
+			}
+		})
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	q := newQueue("queue_block", config.Queue{Size: 2})
+	res := results(4)
+	q.push(context.Background(), res[0])
+	q.push(context.Background(), res[1])
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push(context.Background(), res[2])
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push didn't block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if _, ok := q.pop(); !ok {
+		t.Fatal("q.pop(): ok = (false); want (true)")
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push didn't return after pop")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	q.push(ctx, res[3])
+	if d := q.dropped(); d != 1 {
+		t.Errorf("q.dropped() = (%d); want (1)", d)
+	}
+	if got := popAll(q); got != "bc" {
+		t.Errorf("got = (%s); want (bc)", got)
+	}
+}
+
+func TestQueueDefaults(t *testing.T) {
+	q := newQueue("queue_defaults", config.Queue{})
+	if q.size != DefaultQueueSize {
+		t.Errorf("q.size = (%d); want (%d)", q.size, DefaultQueueSize)
+	}
+	if q.overflow != config.OverflowBlock {
+		t.Errorf("q.overflow = (%s); want (%s)", q.overflow, config.OverflowBlock)
+	}
+}
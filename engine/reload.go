@@ -0,0 +1,134 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"io"
+	"sort"
+
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/config"
+)
+
+// routeChanged returns true if the Engine of the reader should be restarted
+// for the conf.
+func routeChanged(old, conf *config.ConfMap, reader string, recorders []string) bool {
+	newRecorders, ok := conf.Routes[reader]
+	if !ok || !sameNames(recorders, newRecorders) {
+		return true
+	}
+	keys := []string{"settings", "readers." + reader, "processors." + reader}
+	for _, name := range recorders {
+		keys = append(keys, "recorders."+name)
+	}
+	for _, key := range keys {
+		if !sameFingerprint(old, conf, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameFingerprint(old, conf *config.ConfMap, key string) bool {
+	a, ok := old.Fingerprints[key]
+	if !ok {
+		return false
+	}
+	b, ok := conf.Fingerprints[key]
+	return ok && a == b
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// carryOver replaces the readers and recorders of the conf that have not
+// changed with the running ones. The spools of the same directories are
+// carried over too, as only one spool should work on a directory, and the max
+// sizes of the conf are applied to them. The objects of the conf that are
+// replaced are closed.
+func carryOver(old, conf *config.ConfMap, log tools.FieldLogger) {
+	for name, red := range conf.Readers {
+		if o, ok := old.Readers[name]; ok && sameFingerprint(old, conf, "readers."+name) {
+			conf.Readers[name] = o
+			closeObject(name, red, log)
+		}
+	}
+	for name, rec := range conf.Recorders {
+		if o, ok := old.Recorders[name]; ok && sameFingerprint(old, conf, "recorders."+name) {
+			conf.Recorders[name] = o
+			closeObject(name, rec, log)
+		}
+	}
+	for name, sp := range conf.Spools {
+		for _, o := range old.Spools {
+			if o != sp && o.Dir() == sp.Dir() {
+				conf.Spools[name] = o
+				closeObject(name, sp, log)
+				break
+			}
+		}
+		size, ok := conf.SpoolSizes[name]
+		if !ok {
+			continue
+		}
+		if err := conf.Spools[name].SetMaxSize(size); err != nil {
+			log.Warnf("spool of %s: %v", name, err)
+		}
+	}
+}
+
+// closeReplaced closes the readers, recorders and spools of the old conf that
+// are not in the conf. It should be called when their Engines are stopped.
+func closeReplaced(old, conf *config.ConfMap, log tools.FieldLogger) {
+	inUse := make(map[interface{}]bool)
+	for _, red := range conf.Readers {
+		inUse[red] = true
+	}
+	for _, rec := range conf.Recorders {
+		inUse[rec] = true
+	}
+	for _, sp := range conf.Spools {
+		inUse[sp] = true
+	}
+	for name, red := range old.Readers {
+		if !inUse[red] {
+			closeObject(name, red, log)
+		}
+	}
+	for name, rec := range old.Recorders {
+		if !inUse[rec] {
+			closeObject(name, rec, log)
+		}
+	}
+	for name, sp := range old.Spools {
+		if !inUse[sp] {
+			closeObject(name, sp, log)
+		}
+	}
+}
+
+// closeObject closes the obj if it is an io.Closer.
+func closeObject(name string, obj interface{}, log tools.FieldLogger) {
+	c, ok := obj.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		log.Warnf("closing %s: %v", name, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is a snapshot of the state of an Engine.
+type Status struct {
+	Name       string           `json:"name"`
+	Reader     string           `json:"reader"`
+	Started    bool             `json:"started"` // False while waiting for the endpoints.
+	LastRead   time.Time        `json:"last_read"`
+	ReadErrors int64            `json:"read_errors"`
+	Recorders  []RecorderStatus `json:"recorders"`
+}
+
+// RecorderStatus is a snapshot of the state of a recorder in an Engine.
+type RecorderStatus struct {
+	Name       string    `json:"name"`
+	LastRecord time.Time `json:"last_record"`
+	Errors     int64     `json:"errors"`
+	QueueDepth int       `json:"queue_depth"`
+}
+
+// engineStats keeps the time of the last successful read and record, and the
+// number of the errors of an Engine. A nil engineStats ignores them.
+type engineStats struct {
+	mu         sync.Mutex
+	lastRead   time.Time
+	readErrors int64
+	recorders  map[string]*recorderStats
+}
+
+type recorderStats struct {
+	parent     *engineStats
+	lastRecord time.Time
+	errors     int64
+	queue      *queue
+}
+
+func newEngineStats() *engineStats {
+	return &engineStats{recorders: make(map[string]*recorderStats)}
+}
+
+func (s *engineStats) read(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errors.Cause(err) != nil {
+		s.readErrors++
+		return
+	}
+	s.lastRead = time.Now()
+}
+
+// recorder returns the stats of the recorder, whose jobs wait in q.
+func (s *engineStats) recorder(name string, q *queue) *recorderStats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.recorders[name]
+	if !ok {
+		r = &recorderStats{parent: s}
+		s.recorders[name] = r
+	}
+	r.queue = q
+	return r
+}
+
+func (r *recorderStats) record(err error) {
+	if r == nil {
+		return
+	}
+	r.parent.mu.Lock()
+	defer r.parent.mu.Unlock()
+	if errors.Cause(err) != nil {
+		r.errors++
+		return
+	}
+	r.lastRecord = time.Now()
+}
+
+// status fills in the stats of the reader and the named recorders.
+func (s *engineStats) status(st *Status, recorders []string) {
+	sort.Strings(recorders)
+	for _, name := range recorders {
+		st.Recorders = append(st.Recorders, RecorderStatus{Name: name})
+	}
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st.LastRead = s.lastRead
+	st.ReadErrors = s.readErrors
+	for i := range st.Recorders {
+		r, ok := s.recorders[st.Recorders[i].Name]
+		if !ok {
+			continue
+		}
+		st.Recorders[i].LastRecord = r.lastRecord
+		st.Recorders[i].Errors = r.errors
+		if r.queue != nil {
+			st.Recorders[i].QueueDepth = r.queue.len()
+		}
+	}
+}
+
+// newStatus returns the status of the Engine with the stats.
+func newStatus(en Engine, stats *engineStats) Status {
+	st := Status{
+		Name:    en.String(),
+		Reader:  en.Reader().Name(),
+		Started: true,
+	}
+	var recorders []string
+	for name := range en.Recorders() {
+		recorders = append(recorders, name)
+	}
+	stats.status(&st, recorders)
+	return st
+}
+
+// engineStatus returns the status of the Engine. The Engines that do not keep
+// statistics only show their names.
+func engineStatus(en Engine) Status {
+	if m, ok := en.(monitor); ok {
+		return m.Status()
+	}
+	return newStatus(en, nil)
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools/config"
+	"github.com/pkg/errors"
+)
+
+func TestEngineStats(t *testing.T) {
+	var nilStats *engineStats
+	nilStats.read(nil) // should not panic
+	nilStats.recorder("rec", nil).record(nil)
+
+	s := newEngineStats()
+	s.read(errors.New("read error"))
+	s.read(errors.New("read error"))
+	q := newQueue("stats_rec", config.Queue{})
+	q.push(context.Background(), &reader.Result{})
+	r := s.recorder("rec", q)
+	r.record(errors.New("record error"))
+
+	var st Status
+	s.status(&st, []string{"rec", "other"})
+	if !st.LastRead.IsZero() || st.ReadErrors != 2 {
+		t.Errorf("st = (%+v); want (2 read errors and no reads)", st)
+	}
+	if len(st.Recorders) != 2 {
+		t.Fatalf("len(st.Recorders) = (%d); want (2)", len(st.Recorders))
+	}
+	if other := st.Recorders[0]; other.Name != "other" || other.Errors != 0 {
+		t.Errorf("st.Recorders[0] = (%+v); want (other without stats)", other)
+	}
+	rec := st.Recorders[1]
+	if rec.Errors != 1 || rec.QueueDepth != 1 || !rec.LastRecord.IsZero() {
+		t.Errorf("st.Recorders[1] = (%+v); want (1 error and 1 queued job)", rec)
+	}
+
+	s.read(nil)
+	r.record(nil)
+	st = Status{}
+	s.status(&st, []string{"rec"})
+	if st.LastRead.IsZero() || st.Recorders[0].LastRecord.IsZero() {
+		t.Errorf("st = (%+v); want (the times of the last read and record)", st)
+	}
+}
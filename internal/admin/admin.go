@@ -0,0 +1,130 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package admin contains the HTTP server that shows the health and the state
+// of the app. It serves these paths:
+//
+//   /healthz     200 while the app is running.
+//   /readyz      200 when all engines are started and their recorders are
+//                pinged, otherwise 503.
+//   /debug/vars  the expvar variables.
+//   /engines     the status of each engine in JSON.
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/engine"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Service is the source of the readiness and the status of the engines.
+// engine.Service implements it.
+type Service interface {
+	Ready() bool
+	Statuses() []engine.Status
+}
+
+// Server serves the admin endpoints on the Endpoint address. If Timeout is
+// not set, 5 seconds is used for reading the requests and writing the
+// responses.
+type Server struct {
+	Endpoint string
+	Service  Service
+	Log      tools.FieldLogger
+	Timeout  time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	server   *http.Server
+}
+
+// Handler returns the handler of the admin endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", s.ready)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/engines", s.engines)
+	return mux
+}
+
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if !s.Service.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+func (s *Server) engines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.Service.Statuses()); err != nil {
+		s.Log.Errorf("writing the status of the engines: %v", err)
+	}
+}
+
+// Start starts listening on the Endpoint and serves the requests in the
+// background. It returns an error if the address can not be listened on.
+func (s *Server) Start() error {
+	if s.Service == nil {
+		return errors.New("nil service")
+	}
+	if s.Log == nil {
+		s.Log = tools.GetLogger("error")
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return errors.New("server is already started")
+	}
+	l, err := net.Listen("tcp", s.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "admin server")
+	}
+	server := &http.Server{Handler: s.Handler(), ReadTimeout: timeout, WriteTimeout: timeout}
+	s.listener, s.server = l, server
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.Log.Errorf("admin server: %v", err)
+		}
+	}()
+	s.Log.Infof("admin server is listening on %s", l.Addr())
+	return nil
+}
+
+// Addr returns the address the server is listening on, or nil if it is not
+// started. It is useful when the port is chosen by the system.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	s.server, s.listener = nil, nil
+	return err
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package admin_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arsham/expipe/engine"
+	"github.com/arsham/expipe/internal/admin"
+	"github.com/arsham/expipe/tools"
+)
+
+type service struct {
+	ready    bool
+	statuses []engine.Status
+}
+
+func (s *service) Ready() bool               { return s.ready }
+func (s *service) Statuses() []engine.Status { return s.statuses }
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	svc := &service{
+		statuses: []engine.Status{{
+			Name:      "( red >->> rec )",
+			Reader:    "red",
+			Started:   true,
+			Recorders: []engine.RecorderStatus{{Name: "rec", Errors: 2, QueueDepth: 3}},
+		}},
+	}
+	h := (&admin.Server{Service: svc, Log: tools.DiscardLogger()}).Handler()
+
+	if w := get(t, h, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz: code = (%d); want (%d)", w.Code, http.StatusOK)
+	}
+	if w := get(t, h, "/readyz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz: code = (%d); want (%d)", w.Code, http.StatusServiceUnavailable)
+	}
+	svc.ready = true
+	if w := get(t, h, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("/readyz: code = (%d); want (%d)", w.Code, http.StatusOK)
+	}
+	if w := get(t, h, "/debug/vars"); !strings.Contains(w.Body.String(), `"memstats"`) {
+		t.Errorf("/debug/vars: body = (%s); want (expvars)", w.Body.String())
+	}
+
+	w := get(t, h, "/engines")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = (%s); want (application/json)", ct)
+	}
+	var got []engine.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !reflect.DeepEqual(got, svc.statuses) {
+		t.Errorf("statuses = (%+v); want (%+v)", got, svc.statuses)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := &admin.Server{Endpoint: "127.0.0.1:0", Service: &service{ready: true}, Log: tools.DiscardLogger()}
+	if s.Addr() != nil {
+		t.Errorf("s.Addr() = (%v); want (nil)", s.Addr())
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer s.Close()
+	if err := s.Start(); err == nil {
+		t.Error("second start: err = (nil); want (error)")
+	}
+	resp, err := http.Get("http://" + s.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ready\n" {
+		t.Errorf("/readyz = (%d %q); want (200 \"ready\\n\")", resp.StatusCode, body)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if s.Addr() != nil {
+		t.Errorf("s.Addr() = (%v); want (nil)", s.Addr())
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := &admin.Server{Endpoint: "127.0.0.1:0"}
+	if err := s.Start(); err == nil {
+		t.Error("nil service: err = (nil); want (error)")
+	}
+	s = &admin.Server{Endpoint: "bad address", Service: &service{}, Log: tools.DiscardLogger()}
+	if err := s.Start(); err == nil {
+		t.Error("bad address: err = (nil); want (error)")
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/arsham/expipe/datatype"
 	"github.com/arsham/expipe/engine"
+	"github.com/arsham/expipe/internal/admin"
 	"github.com/arsham/expipe/reader"
 	"github.com/arsham/expipe/reader/expvar"
 	"github.com/arsham/expipe/recorder"
@@ -24,6 +25,10 @@ import (
 	"github.com/spf13/viper"
 )
 
+// flushTimeout is the time the app waits for the recorders to flush after the
+// engines have drained their jobs.
+const flushTimeout = 5 * time.Second
+
 // TODO: change the log to FieldLogger
 
 var (
@@ -41,10 +46,15 @@ var Opts struct {
 	TypeName  string        `long:"type" env:"TYPE" default:"expipe" description:"Elasticsearch type name"`
 	Interval  time.Duration `long:"int" env:"INT" default:"1s" description:"Interval between pulls from the target"`
 	Timeout   time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"Communication time-outs to both reader and recorder"`
+	Watch     time.Duration `long:"watch" env:"WATCH" default:"0" description:"Interval of checking the configuration file for changes. Zero disables it"`
+	Admin     string        `long:"admin" env:"ADMIN" default:"" description:"Address of the admin HTTP server. It overrides the admin_endpoint of the configuration file"`
 }
 
 // Main is the entrypoint of the application. It is been called from main.main.
-// It captures SIGINT or SIGTERM signals to terminate the app.
+// It captures SIGINT or SIGTERM signals to terminate the app. If the app is
+// set up from a configuration file, it is reloaded on the SIGHUP signal, or
+// when the file changes if the watch flag is set. If an admin endpoint is
+// set, the admin server is started on it.
 func Main() {
 	_, conf, err := Config()
 	if err != nil {
@@ -53,9 +63,31 @@ func Main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if conf.DrainTimeout == 0 {
+		conf.DrainTimeout = engine.DefaultDrainTimeout
+	}
 	sigCh := make(chan os.Signal, 1)
-	CaptureSignals(cancel, sigCh, os.Exit, 1*time.Second)
-	Bootstrap(ctx, log, conf)
+	CaptureSignals(cancel, sigCh, os.Exit, conf.DrainTimeout+flushTimeout)
+	s := newService(ctx, log, conf)
+	if Opts.Admin != "" {
+		conf.AdminEndpoint = Opts.Admin
+	}
+	if conf.AdminEndpoint != "" {
+		a := &admin.Server{Endpoint: conf.AdminEndpoint, Service: s, Log: log}
+		if err = a.Start(); err != nil {
+			log.Fatalf(err.Error())
+		}
+		defer a.Close()
+	}
+	if Opts.ConfFile != "" {
+		hupCh := make(chan os.Signal, 1)
+		load := func() (*config.ConfMap, error) { return reloadConfig(s.Running()) }
+		HandleReloads(ctx, hupCh, load, s.Reload, log)
+		if Opts.Watch > 0 {
+			WatchConfig(ctx, configFile, hupCh, Opts.Watch)
+		}
+	}
+	start(log, s)
 }
 
 // Config returns the ConfMap from a file if it was set in the command flags.
@@ -67,19 +99,27 @@ func Config() (*tools.Logger, *config.ConfMap, error) {
 		conf, err := fromFlags()
 		return log, conf, err
 	}
-	conf, err := fromConfig(Opts.ConfFile)
+	conf, err := fromConfig(Opts.ConfFile, nil)
 	return log, conf, err
 }
 
 // Bootstrap sets up an instance of the Service and starts it. It waits until
 // the Service signals its work has been finished.
 func Bootstrap(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap) {
-	s := engine.Service{
-		Ctx:  ctx,
-		Log:  log,
-		Conf: conf,
+	start(log, newService(ctx, log, conf))
+}
+
+func newService(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap) *engine.Service {
+	return &engine.Service{
+		Ctx:          ctx,
+		Log:          log,
+		Conf:         conf,
+		PingInterval: engine.DefaultPingInterval,
 	}
+}
 
+// start starts the Service and waits until its work has been finished.
+func start(log tools.FieldLogger, s *engine.Service) {
 	done, err := s.Start()
 	if err != nil {
 		log.Fatalf(err.Error())
@@ -88,8 +128,12 @@ func Bootstrap(ctx context.Context, log tools.FieldLogger, conf *config.ConfMap)
 	<-done
 }
 
-// setting up from config file
-func fromConfig(confFile string) (*config.ConfMap, error) {
+// configFile is the path of the configuration file, set when it is read.
+var configFile string
+
+// setting up from config file. The spools of the running conf are reused, and
+// it can be nil.
+func fromConfig(confFile string, running *config.ConfMap) (*config.ConfMap, error) {
 	v := viper.New()
 	v.SetConfigName(confFile)
 	v.SetConfigType("yaml") // PLAN: Also read from toml, json etcd, consul, etc.
@@ -98,14 +142,28 @@ func fromConfig(confFile string) (*config.ConfMap, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %s", err)
 	}
+	configFile = v.ConfigFileUsed()
 
-	confSlice, err := config.LoadYAML(log, v)
+	confSlice, err := config.ReloadYAML(log, v, running)
 	if err != nil {
 		return nil, err
 	}
 	return confSlice, nil
 }
 
+// reloadConfig reads the configuration file again. The spools of the running
+// conf are reused. The log level is not changed if the file is not valid.
+func reloadConfig(running *config.ConfMap) (*config.ConfMap, error) {
+	conf, err := fromConfig(Opts.ConfFile, running)
+	if err != nil {
+		return nil, err
+	}
+	if conf.DrainTimeout == 0 {
+		conf.DrainTimeout = engine.DefaultDrainTimeout
+	}
+	return conf, nil
+}
+
 // setting up from command flags
 func fromFlags() (*config.ConfMap, error) {
 	var err error
@@ -143,15 +201,73 @@ func fromFlags() (*config.ConfMap, error) {
 }
 
 // CaptureSignals cancels the context if receives the SIGINT or SIGTERM signal
-// through sigCh, and exits with calling exit(130).
+// through sigCh, therefore the engines can drain their jobs and return. If the
+// app is still running after the timeout, or on the second signal, it exits
+// with calling exit(130).
 func CaptureSignals(cancel context.CancelFunc, sigCh chan os.Signal, exit func(int), timeout time.Duration) {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigCh
-		go func() {
-			<-time.After(timeout)
-			exit(130)
-		}()
 		cancel()
+		select {
+		case <-sigCh:
+		case <-time.After(timeout):
+		}
+		exit(130)
+	}()
+}
+
+// HandleReloads loads the configuration with load and applies it with reload
+// every time it receives the SIGHUP signal through sigCh, until the ctx is
+// done. If the configuration can not be loaded, the running one is kept.
+func HandleReloads(ctx context.Context, sigCh chan os.Signal, load func() (*config.ConfMap, error), reload func(*config.ConfMap) error, log tools.FieldLogger) {
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-sigCh:
+			case <-ctx.Done():
+				return
+			}
+			log.Info("reloading the configuration")
+			conf, err := load()
+			if err != nil {
+				log.Errorf("reloading the configuration: %v, keeping the running one", err)
+				continue
+			}
+			if err = reload(conf); err != nil {
+				log.Errorf("reloading the configuration: %v", err)
+			}
+		}
+	}()
+}
+
+// WatchConfig checks the file on every interval, and sends the SIGHUP signal
+// to sigCh when its modification time or size changes, until the ctx is done.
+func WatchConfig(ctx context.Context, file string, sigCh chan os.Signal, interval time.Duration) {
+	last, _ := os.Stat(file)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+			select {
+			case sigCh <- syscall.SIGHUP:
+			default: // A reload is already pending.
+			}
+		}
 	}()
 }
@@ -275,6 +275,102 @@ func TestCaptureSignals(t *testing.T) {
 	}
 }
 
+func TestCaptureSignalsSecondSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal)
+	exitCh := make(chan int)
+	exit := func(code int) {
+		exitCh <- code
+	}
+	app.CaptureSignals(cancel, sigCh, exit, time.Hour)
+	sigCh <- syscall.SIGINT
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("context wasn't cancelled")
+	}
+	select {
+	case code := <-exitCh:
+		t.Errorf("exited with (%d) before the second signal", code)
+	case <-time.After(10 * time.Millisecond):
+	}
+	sigCh <- syscall.SIGTERM
+	select {
+	case code := <-exitCh:
+		if code != 130 {
+			t.Errorf("want to exit with code (130), got (%d)", code)
+		}
+	case <-time.After(time.Second):
+		t.Error("exit function wasn't called")
+	}
+}
+
+func TestHandleReloads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal)
+	loadErrs := make(chan error, 1)
+	want := &config.ConfMap{}
+	load := func() (*config.ConfMap, error) {
+		if err := <-loadErrs; err != nil {
+			return nil, err
+		}
+		return want, nil
+	}
+	reloaded := make(chan *config.ConfMap)
+	reload := func(conf *config.ConfMap) error {
+		reloaded <- conf
+		return nil
+	}
+	app.HandleReloads(ctx, sigCh, load, reload, tools.DiscardLogger())
+
+	loadErrs <- errors.New("invalid config")
+	sigCh <- syscall.SIGHUP
+	select {
+	case <-reloaded:
+		t.Error("reloaded with an invalid configuration")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	loadErrs <- nil
+	sigCh <- syscall.SIGHUP
+	select {
+	case conf := <-reloaded:
+		if conf != want {
+			t.Errorf("conf = (%v); want (%v)", conf, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("configuration wasn't reloaded")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	file, err := ioutil.TempFile("", "expipe")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	sigCh := make(chan os.Signal, 1)
+	app.WatchConfig(ctx, file.Name(), sigCh, 5*time.Millisecond)
+	select {
+	case <-sigCh:
+		t.Error("signalled before the file is changed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	file.WriteString("settings: {}")
+	select {
+	case sig := <-sigCh:
+		if sig != syscall.SIGHUP {
+			t.Errorf("sig = (%v); want (%v)", sig, syscall.SIGHUP)
+		}
+	case <-time.After(time.Second):
+		t.Error("the change wasn't noticed")
+	}
+}
+
 func TestConfigReadSampleYAML(t *testing.T) {
 	filename, teardown := setup(readFixtures(t, "config_read_sample_yaml.txt")[0])
 	defer teardown()
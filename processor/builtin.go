@@ -0,0 +1,175 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package processor
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+// Types of the values that Cast converts to.
+const (
+	CastFloat    = "float"  // FloatType
+	CastString   = "string" // StringType
+	CastByte     = "byte"   // ByteType, the value is in bytes.
+	CastKiloByte = "kb"     // KiloByteType, the value is in bytes.
+	CastMegaByte = "mb"     // MegaByteType, the value is in bytes.
+)
+
+// Rename renames the values. The keys of the map are the current names and
+// the values are the new ones.
+type Rename map[string]string
+
+// Process returns a container with the values renamed.
+func (r Rename) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	list := make([]datatype.DataType, 0, c.Len())
+	for _, d := range c.List() {
+		if k, ok := key(d); ok {
+			if to, ok := r[k]; ok {
+				d = withKey(d, to)
+			}
+		}
+		list = append(list, d)
+	}
+	return datatype.New(list), nil
+}
+
+// Drop removes the values whose keys match any of the glob patterns.
+type Drop []string
+
+// Process returns a container without the matching values.
+func (dr Drop) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	return filter(c, func(k string) bool { return !match(dr, k) }), nil
+}
+
+// Keep removes the values whose keys do not match any of the glob patterns.
+type Keep []string
+
+// Process returns a container with only the matching values.
+func (kp Keep) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	return filter(c, func(k string) bool { return match(kp, k) }), nil
+}
+
+// Add adds static values to the payloads. The values with the same keys are
+// replaced.
+type Add struct {
+	Strings map[string]string
+	Floats  map[string]float64
+}
+
+// Process returns a container with the values added to the end.
+func (a Add) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	c = filter(c, func(k string) bool {
+		_, str := a.Strings[k]
+		_, flt := a.Floats[k]
+		return !str && !flt
+	})
+	// New DataTypes are made for each payload as they are not safe to be read
+	// concurrently.
+	list := c.List()
+	keys := make([]string, 0, len(a.Strings))
+	for k := range a.Strings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = append(list, datatype.NewStringType(k, a.Strings[k]))
+	}
+	keys = keys[:0]
+	for k := range a.Floats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = append(list, datatype.NewFloatType(k, a.Floats[k]))
+	}
+	return datatype.New(list), nil
+}
+
+// Scale multiplies the numeric values whose keys match any of the glob
+// patterns by the Factor. The lists are scaled item by item. The GC lists and
+// strings are not changed.
+type Scale struct {
+	Keys   []string
+	Factor float64
+}
+
+// Process returns a container with the matching values scaled.
+func (s Scale) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	return mapValues(c, s.Keys, func(d datatype.DataType) datatype.DataType {
+		switch v := d.(type) {
+		case *datatype.FloatType:
+			return datatype.NewFloatType(v.Key, v.Value*s.Factor)
+		case *datatype.ByteType:
+			return datatype.NewByteType(v.Key, v.Value*s.Factor)
+		case *datatype.KiloByteType:
+			return datatype.NewKiloByteType(v.Key, v.Value*s.Factor)
+		case *datatype.MegaByteType:
+			return datatype.NewMegaByteType(v.Key, v.Value*s.Factor)
+		case *datatype.FloatListType:
+			list := make([]float64, len(v.Value))
+			for i, f := range v.Value {
+				list[i] = f * s.Factor
+			}
+			return datatype.NewFloatListType(v.Key, list)
+		}
+		return d
+	}), nil
+}
+
+// Cast converts the values whose keys match any of the glob patterns to the
+// type of To, which is one of the Cast constants. The strings that are not
+// finite numbers, e.g. "NaN" or "Inf", and the lists are not changed.
+type Cast struct {
+	Keys []string
+	To   string
+}
+
+// Process returns a container with the matching values converted.
+func (ct Cast) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	return mapValues(c, ct.Keys, func(d datatype.DataType) datatype.DataType {
+		var (
+			k     string
+			value float64
+		)
+		switch v := d.(type) {
+		case *datatype.FloatType:
+			k, value = v.Key, v.Value
+		case *datatype.ByteType:
+			k, value = v.Key, v.Value
+		case *datatype.KiloByteType:
+			k, value = v.Key, v.Value
+		case *datatype.MegaByteType:
+			k, value = v.Key, v.Value
+		case *datatype.StringType:
+			if ct.To == CastString {
+				return d
+			}
+			f, err := strconv.ParseFloat(v.Value, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return d
+			}
+			k, value = v.Key, f
+		default:
+			return d
+		}
+		switch ct.To {
+		case CastFloat:
+			return datatype.NewFloatType(k, value)
+		case CastString:
+			return datatype.NewStringType(k, strconv.FormatFloat(value, 'f', -1, 64))
+		case CastByte:
+			return datatype.NewByteType(k, value)
+		case CastKiloByte:
+			return datatype.NewKiloByteType(k, value)
+		case CastMegaByte:
+			return datatype.NewMegaByteType(k, value)
+		}
+		return d
+	}), nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package processor
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a Chain from a
+// processors section of a configuration file. The section is a list of the
+// processors, which run in order:
+//
+//    processors:
+//        - type: rename
+//          keys: {memstats.Alloc: alloc}
+//        - type: drop                 # or keep
+//          keys: ["memstats.BySize*"]
+//        - type: add
+//          fields: {env: prod, dc: 2}
+//        - type: scale
+//          keys: ["*_ms"]
+//          factor: 0.001
+//        - type: cast
+//          keys: [alloc]
+//          to: mb                     # float, string, byte, kb or mb
+type Config struct {
+	chain Chain
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Chain returns the processors of the configuration.
+func (c *Config) Chain() Chain { return c.chain }
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error if any of the processors are invalid.
+func WithViper(v unmarshaller, key string) Conf {
+	return func(c *Config) error {
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+		var list []map[string]interface{}
+		if err := v.UnmarshalKey(key, &list); err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		for i, section := range list {
+			p, err := parse(section)
+			if err != nil {
+				return errors.Wrapf(err, "processor %d", i+1)
+			}
+			c.chain = append(c.chain, p)
+		}
+		return nil
+	}
+}
+
+// parse returns the processor of a section of the list.
+func parse(section map[string]interface{}) (Processor, error) {
+	typ, _ := section["type"].(string)
+	switch typ {
+	case "rename":
+		keys, err := stringMap(section["keys"])
+		if err != nil {
+			return nil, errors.Wrap(err, "rename keys")
+		}
+		return Rename(keys), nil
+	case "drop", "keep":
+		keys, err := patterns(section["keys"])
+		if err != nil {
+			return nil, errors.Wrap(err, typ+" keys")
+		}
+		if typ == "drop" {
+			return Drop(keys), nil
+		}
+		return Keep(keys), nil
+	case "add":
+		return parseAdd(section["fields"])
+	case "scale":
+		keys, err := patterns(section["keys"])
+		if err != nil {
+			return nil, errors.Wrap(err, "scale keys")
+		}
+		factor, ok := number(section["factor"])
+		if !ok {
+			return nil, fmt.Errorf("scale factor should be a number: %v", section["factor"])
+		}
+		return Scale{Keys: keys, Factor: factor}, nil
+	case "cast":
+		keys, err := patterns(section["keys"])
+		if err != nil {
+			return nil, errors.Wrap(err, "cast keys")
+		}
+		to, _ := section["to"].(string)
+		switch to {
+		case CastFloat, CastString, CastByte, CastKiloByte, CastMegaByte:
+		default:
+			return nil, fmt.Errorf("cannot cast to %q", to)
+		}
+		return Cast{Keys: keys, To: to}, nil
+	}
+	return nil, fmt.Errorf("unknown type: %q", typ)
+}
+
+func parseAdd(fields interface{}) (Processor, error) {
+	m, ok := toMap(fields)
+	if !ok || len(m) == 0 {
+		return nil, errors.New("add fields should be a map")
+	}
+	a := Add{Strings: make(map[string]string), Floats: make(map[string]float64)}
+	for key, v := range m {
+		if s, ok := v.(string); ok {
+			a.Strings[key] = s
+			continue
+		}
+		f, ok := number(v)
+		if !ok {
+			return nil, fmt.Errorf("add field %s should be a string or a number: %v", key, v)
+		}
+		a.Floats[key] = f
+	}
+	return a, nil
+}
+
+func stringMap(value interface{}) (map[string]string, error) {
+	m, ok := toMap(value)
+	if !ok || len(m) == 0 {
+		return nil, errors.New("should be a map")
+	}
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v should be a string", v)
+		}
+		ret[k] = s
+	}
+	return ret, nil
+}
+
+// toMap converts the maps decoded from YAML, whose keys are interfaces.
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ret[fmt.Sprint(k)] = v
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+// patterns returns the glob patterns of a list, or an error if any of them
+// are malformed.
+func patterns(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New("should be a list")
+	}
+	ret := make([]string, len(list))
+	for i, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v should be a string", v)
+		}
+		ret[i] = s
+	}
+	if err := validatePatterns(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package processor_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/arsham/expipe/processor"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func readConfig(section string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBuffer([]byte(`
+    routes:
+        route1:
+            processors:
+                ` + section + `
+    `)))
+	return v
+}
+
+func TestWithViperErrors(t *testing.T) {
+	c := new(processor.Config)
+	if err := processor.WithViper(viper.New(), "")(c); err == nil {
+		t.Error("no key: err = (nil); want (error)")
+	}
+	if err := processor.WithViper(nil, "key")(c); err == nil {
+		t.Error("no viper: err = (nil); want (error)")
+	}
+	if err := processor.WithViper(&badMarshaller{}, "key")(c); err == nil {
+		t.Error("bad marshaller: err = (nil); want (error)")
+	}
+	for _, section := range []string{
+		"- type: unknown",
+		"- keys: [alloc]",
+		"- type: rename",
+		"- {type: rename, keys: {alloc: 1}}",
+		"- {type: drop, keys: alloc}",
+		"- {type: keep, keys: []}",
+		"- {type: drop, keys: [1]}",
+		`- {type: drop, keys: ["["]}`,
+		"- {type: add, fields: env}",
+		"- {type: add, fields: {env: [prod]}}",
+		"- {type: scale, keys: [alloc], factor: much}",
+		"- {type: scale, factor: 2}",
+		"- {type: cast, keys: [alloc], to: gb}",
+		"- {type: cast, to: mb}",
+	} {
+		c = new(processor.Config)
+		if err := processor.WithViper(readConfig(section), "routes.route1.processors")(c); err == nil {
+			t.Errorf("err = (nil); want (error): %s", section)
+		}
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := readConfig(`- type: rename
+                  keys: {memstats.Alloc: alloc}
+                - type: drop
+                  keys: ["memstats.*"]
+                - type: keep
+                  keys: [alloc, env]
+                - type: add
+                  fields: {env: prod, dc: 2}
+                - type: scale
+                  keys: [alloc]
+                  factor: 0.5
+                - type: cast
+                  keys: [alloc]
+                  to: mb`)
+	c, err := processor.NewConfig(processor.WithViper(v, "routes.route1.processors"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := processor.Chain{
+		processor.Rename{"memstats.Alloc": "alloc"},
+		processor.Drop{"memstats.*"},
+		processor.Keep{"alloc", "env"},
+		processor.Add{Strings: map[string]string{"env": "prod"}, Floats: map[string]float64{"dc": 2}},
+		processor.Scale{Keys: []string{"alloc"}, Factor: 0.5},
+		processor.Cast{Keys: []string{"alloc"}, To: processor.CastMegaByte},
+	}
+	if !reflect.DeepEqual(c.Chain(), want) {
+		t.Errorf("c.Chain() = (%v); want (%v)", c.Chain(), want)
+	}
+
+	c, err = processor.NewConfig(processor.WithViper(viper.New(), "routes.route1.processors"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(c.Chain()) != 0 {
+		t.Errorf("c.Chain() = (%v); want (empty)", c.Chain())
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package processor contains the processors that transform the payloads of
+// the jobs after they are read and before they are recorded. Each recorder of
+// an engine has its own chain of processors, which is made of the processors
+// of the route followed by the ones of the recorder.
+//
+// You can implement the Processor interface, or use the Func adapter, to
+// write your own processors. The processors should not change the DataTypes of
+// the container they receive, instead they should return a new container with
+// new DataTypes for the values they change.
+//
+// The keys of the values are matched against the glob patterns of the
+// path.Match function, for example "memstats.*" or "Heap?nuse".
+package processor
+
+import (
+	"path"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+// Processor transforms the payload of a job. It returns an error if the
+// payload can not be processed, in which case the job is dropped.
+type Processor interface {
+	Process(datatype.DataContainer) (datatype.DataContainer, error)
+}
+
+// Func is an adapter to use an ordinary function as a Processor.
+type Func func(datatype.DataContainer) (datatype.DataContainer, error)
+
+// Process calls f(c).
+func (f Func) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	return f(c)
+}
+
+// Chain runs the processors in order, and passes the result of each one to the
+// next. It stops at the first error.
+type Chain []Processor
+
+// Process runs the processors of the chain.
+func (ch Chain) Process(c datatype.DataContainer) (datatype.DataContainer, error) {
+	var err error
+	for _, p := range ch {
+		if c, err = p.Process(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// key returns the key of the DataType. It returns false if the type is not
+// known, for example when it is defined outside of the datatype package.
+func key(d datatype.DataType) (string, bool) {
+	switch v := d.(type) {
+	case *datatype.FloatType:
+		return v.Key, true
+	case *datatype.StringType:
+		return v.Key, true
+	case *datatype.FloatListType:
+		return v.Key, true
+	case *datatype.GCListType:
+		return v.Key, true
+	case *datatype.ByteType:
+		return v.Key, true
+	case *datatype.KiloByteType:
+		return v.Key, true
+	case *datatype.MegaByteType:
+		return v.Key, true
+	}
+	return "", false
+}
+
+// withKey returns a copy of the DataType with the new key.
+func withKey(d datatype.DataType, key string) datatype.DataType {
+	switch v := d.(type) {
+	case *datatype.FloatType:
+		return datatype.NewFloatType(key, v.Value)
+	case *datatype.StringType:
+		return datatype.NewStringType(key, v.Value)
+	case *datatype.FloatListType:
+		return datatype.NewFloatListType(key, v.Value)
+	case *datatype.GCListType:
+		return datatype.NewGCListType(key, v.Value)
+	case *datatype.ByteType:
+		return datatype.NewByteType(key, v.Value)
+	case *datatype.KiloByteType:
+		return datatype.NewKiloByteType(key, v.Value)
+	case *datatype.MegaByteType:
+		return datatype.NewMegaByteType(key, v.Value)
+	}
+	return d
+}
+
+// match returns true if the key matches any of the patterns.
+func match(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePatterns returns an error if any of the glob patterns are malformed.
+func validatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filter returns a new container with the values that keep returns true for.
+// The values with unknown types are kept.
+func filter(c datatype.DataContainer, keep func(key string) bool) datatype.DataContainer {
+	list := make([]datatype.DataType, 0, c.Len())
+	for _, d := range c.List() {
+		if k, ok := key(d); ok && !keep(k) {
+			continue
+		}
+		list = append(list, d)
+	}
+	return datatype.New(list)
+}
+
+// mapValues returns a new container with the values that match the patterns
+// replaced by the result of fn.
+func mapValues(c datatype.DataContainer, patterns []string, fn func(datatype.DataType) datatype.DataType) datatype.DataContainer {
+	list := make([]datatype.DataType, 0, c.Len())
+	for _, d := range c.List() {
+		if k, ok := key(d); ok && match(patterns, k) {
+			d = fn(d)
+		}
+		list = append(list, d)
+	}
+	return datatype.New(list)
+}
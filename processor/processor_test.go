@@ -0,0 +1,170 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/processor"
+	"github.com/pkg/errors"
+)
+
+type unknownType struct{ datatype.DataType }
+
+func (unknownType) Equal(other datatype.DataType) bool { _, ok := other.(unknownType); return ok }
+
+func payload() datatype.DataContainer {
+	return datatype.New([]datatype.DataType{
+		datatype.NewFloatType("alloc", 2048),
+		datatype.NewStringType("name", "app"),
+		datatype.NewByteType("heap.sys", 1024),
+		datatype.NewFloatListType("heap.pauses", []float64{1, 2}),
+		unknownType{},
+	})
+}
+
+func checkList(t *testing.T, c datatype.DataContainer, want []datatype.DataType) {
+	t.Helper()
+	got := c.List()
+	if len(got) != len(want) {
+		t.Fatalf("len(List()) = (%d); want (%d): %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("List()[%d] = (%v); want (%v)", i, got[i], want[i])
+		}
+	}
+}
+
+func TestProcessors(t *testing.T) {
+	tcs := []struct {
+		name string
+		p    processor.Processor
+		want []datatype.DataType
+	}{
+		{"rename", processor.Rename{"alloc": "memory", "missing": "other"}, []datatype.DataType{
+			datatype.NewFloatType("memory", 2048),
+			datatype.NewStringType("name", "app"),
+			datatype.NewByteType("heap.sys", 1024),
+			datatype.NewFloatListType("heap.pauses", []float64{1, 2}),
+			unknownType{},
+		}},
+		{"drop", processor.Drop{"heap.*", "name"}, []datatype.DataType{
+			datatype.NewFloatType("alloc", 2048),
+			unknownType{},
+		}},
+		{"keep", processor.Keep{"heap.*"}, []datatype.DataType{
+			datatype.NewByteType("heap.sys", 1024),
+			datatype.NewFloatListType("heap.pauses", []float64{1, 2}),
+			unknownType{},
+		}},
+		{"add", processor.Add{
+			Strings: map[string]string{"name": "other", "env": "prod"},
+			Floats:  map[string]float64{"dc": 2},
+		}, []datatype.DataType{
+			datatype.NewFloatType("alloc", 2048),
+			datatype.NewByteType("heap.sys", 1024),
+			datatype.NewFloatListType("heap.pauses", []float64{1, 2}),
+			unknownType{},
+			datatype.NewStringType("env", "prod"),
+			datatype.NewStringType("name", "other"),
+			datatype.NewFloatType("dc", 2),
+		}},
+		{"scale", processor.Scale{Keys: []string{"*"}, Factor: 0.5}, []datatype.DataType{
+			datatype.NewFloatType("alloc", 1024),
+			datatype.NewStringType("name", "app"),
+			datatype.NewByteType("heap.sys", 512),
+			datatype.NewFloatListType("heap.pauses", []float64{0.5, 1}),
+			unknownType{},
+		}},
+		{"cast", processor.Cast{Keys: []string{"alloc", "heap.*"}, To: processor.CastKiloByte}, []datatype.DataType{
+			datatype.NewKiloByteType("alloc", 2048),
+			datatype.NewStringType("name", "app"),
+			datatype.NewKiloByteType("heap.sys", 1024),
+			datatype.NewFloatListType("heap.pauses", []float64{1, 2}),
+			unknownType{},
+		}},
+		{"chain", processor.Chain{
+			processor.Keep{"alloc"},
+			processor.Rename{"alloc": "memory"},
+			processor.Cast{Keys: []string{"memory"}, To: processor.CastString},
+		}, []datatype.DataType{
+			datatype.NewStringType("memory", "2048"),
+			unknownType{},
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := payload()
+			got, err := tc.p.Process(c)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			checkList(t, got, tc.want)
+			checkList(t, c, payload().List())
+		})
+	}
+}
+
+func TestCastStrings(t *testing.T) {
+	c := datatype.New([]datatype.DataType{
+		datatype.NewStringType("number", "1.5"),
+		datatype.NewStringType("text", "app"),
+		datatype.NewStringType("nan", "NaN"),
+		datatype.NewStringType("inf", "-Inf"),
+	})
+	got, err := processor.Cast{Keys: []string{"*"}, To: processor.CastFloat}.Process(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	checkList(t, got, []datatype.DataType{
+		datatype.NewFloatType("number", 1.5),
+		datatype.NewStringType("text", "app"),
+		datatype.NewStringType("nan", "NaN"),
+		datatype.NewStringType("inf", "-Inf"),
+	})
+}
+
+func TestAddGenerate(t *testing.T) {
+	// The values are added to every payload.
+	p := processor.Add{Strings: map[string]string{"env": "prod"}}
+	for i := 0; i < 2; i++ {
+		got, err := p.Process(datatype.New(nil))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := got.Generate(buf, time.Now()); err != nil {
+			t.Fatalf("Generate(): err = (%v); want (nil)", err)
+		}
+		if !bytes.Contains(buf.Bytes(), []byte(`"env":"prod"`)) {
+			t.Errorf("Generate() = (%s); want (%s)", buf.String(), `"env":"prod"`)
+		}
+	}
+}
+
+func TestFuncAndChainErrors(t *testing.T) {
+	called := false
+	failing := processor.Func(func(c datatype.DataContainer) (datatype.DataContainer, error) {
+		return nil, errors.New("failed")
+	})
+	next := processor.Func(func(c datatype.DataContainer) (datatype.DataContainer, error) {
+		called = true
+		return c, nil
+	})
+	got, err := processor.Chain{failing, next}.Process(payload())
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if got != nil {
+		t.Errorf("got = (%v); want (nil)", got)
+	}
+	if called {
+		t.Error("the chain continued after the error")
+	}
+}
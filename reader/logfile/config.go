@@ -0,0 +1,190 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// jsonFormat is the value of the format in the configuration file for reading
+// JSON lines.
+const jsonFormat = "json"
+
+// Config holds the necessary configuration for setting up a log file reader.
+// Format can be either "regex" (default) or "json". If MapFile is provided, the
+// data will be mapped, otherwise it uses the DefaultMapper.
+type Config struct {
+	log              tools.FieldLogger
+	LogTypeName      string `mapstructure:"type_name"`
+	LogPath          string `mapstructure:"path"`
+	LogFormat        string `mapstructure:"format"`
+	LogPattern       string `mapstructure:"pattern"`
+	LogOffsetFile    string `mapstructure:"offset_file"`
+	LogFromBeginning bool   `mapstructure:"from_beginning"`
+	LogInterval      string `mapstructure:"interval"`
+	LogTimeout       string `mapstructure:"timeout"`
+	MapFile          string `mapstructure:"map_file"`
+	LogName          string
+	ConfInterval     time.Duration
+	ConfTimeout      time.Duration
+	mapper           datatype.Mapper
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig returns an instance of the log file reader.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if obj.mapper == nil {
+		obj.mapper = datatype.DefaultMapper()
+	}
+	return obj, nil
+}
+
+// Reader implements the ReaderConf interface.
+func (c *Config) Reader() (reader.DataReader, error) {
+	options := []func(reader.Constructor) error{
+		reader.WithLogger(c.Logger()),
+		WithPath(c.Endpoint()),
+		reader.WithMapper(c.mapper),
+		reader.WithName(c.Name()),
+		reader.WithTypeName(c.LogTypeName),
+		reader.WithInterval(c.Interval()),
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, reader.WithTimeout(c.Timeout()))
+	}
+	if c.LogFormat == jsonFormat {
+		options = append(options, WithJSONLines())
+	} else {
+		options = append(options, WithPattern(c.LogPattern))
+	}
+	if c.LogOffsetFile != "" {
+		options = append(options, WithOffsetFile(c.LogOffsetFile))
+	}
+	if c.LogFromBeginning {
+		options = append(options, WithFromBeginning())
+	}
+	return New(options...)
+}
+
+// Name returns name from the config file.
+func (c *Config) Name() string { return c.LogName }
+
+// TypeName returns type name from the config file.
+func (c *Config) TypeName() string { return c.LogTypeName }
+
+// Endpoint returns the path to the log file.
+func (c *Config) Endpoint() string { return c.LogPath }
+
+// Interval returns interval after reading from the config file.
+func (c *Config) Interval() time.Duration { return c.ConfInterval }
+
+// Timeout returns timeout after reading from the config file.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger returns logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// Mapper returns the mapper assigned to this object.
+func (c *Config) Mapper() datatype.Mapper { return c.mapper }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+// WithViper produces an error any of the inputs are empty. The timeout is
+// optional, as the reader does not make any network calls.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil || v.AllKeys() == nil {
+			return errors.Wrap(err, "decoding config")
+		}
+
+		var interval, timeout time.Duration
+		if interval, err = time.ParseDuration(c.LogInterval); err != nil {
+			return errors.Wrapf(err, "parse interval (%v)", c.LogInterval)
+		}
+		c.ConfInterval = interval
+
+		if c.LogTimeout != "" {
+			if timeout, err = time.ParseDuration(c.LogTimeout); err != nil {
+				return errors.Wrapf(err, "parse timeout (%v)", c.LogTimeout)
+			}
+		}
+		if c.LogTypeName == "" {
+			return fmt.Errorf("type_name cannot be empty: %s", c.LogTypeName)
+		}
+		if c.LogPath == "" {
+			return fmt.Errorf("path cannot be empty: %s", c.LogPath)
+		}
+		switch c.LogFormat {
+		case "", "regex":
+			if c.LogPattern == "" {
+				return fmt.Errorf("pattern cannot be empty in regex format: %s", c.LogPattern)
+			}
+		case jsonFormat:
+		default:
+			return fmt.Errorf("unknown format: %s", c.LogFormat)
+		}
+		c.ConfTimeout = timeout
+		c.LogName = name
+		return WithMapFile(c.MapFile)(c)
+	}
+}
+
+// WithMapFile returns any errors on reading the file. If the mapFile is empty,
+// it does nothing and returns nil.
+func WithMapFile(mapFile string) Conf {
+	return func(c *Config) error {
+		if mapFile == "" {
+			return nil
+		}
+		extension := filepath.Ext(mapFile)
+		filename := mapFile[0 : len(mapFile)-len(extension)]
+		v := viper.New()
+		v.SetConfigName(filename)
+		v.SetConfigType("yaml")
+		v.AddConfigPath(".")
+		err := v.ReadInConfig()
+		if err != nil {
+			return err
+		}
+		c.mapper = datatype.MapsFromViper(v)
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader/logfile"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(logfile.Config)
+	err := logfile.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = logfile.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+func TestWithViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	c := new(logfile.Config)
+	input := `
+    readers:
+        reader1:
+            path: /var/log/app.log
+            pattern: (?P<duration>\d+)ms
+            type_name: %s
+            map_file: noway
+            timeout: 10s
+            interval: 1s
+    `
+
+	in := bytes.NewBufferString(fmt.Sprintf(input, ""))
+	v.ReadConfig(in)
+	err := logfile.WithViper(v, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): empty typeName")
+	}
+
+	in = bytes.NewBufferString(fmt.Sprintf(input, ""))
+	v.ReadConfig(in)
+	err = logfile.WithViper(v, "name", "")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): empty key")
+	}
+
+	in = bytes.NewBufferString(fmt.Sprintf(input, "example_type"))
+	v.ReadConfig(in)
+	err = logfile.WithViper(v, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): map file does not exist")
+	}
+
+	err = logfile.WithViper(nil, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): nil viper")
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            path: /var/log/app.log
+            pattern: (?P<duration>\d+)ms
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+    `))
+	v.ReadConfig(input)
+	c := new(logfile.Config)
+	err := logfile.WithViper(v, "reader1", "readers.reader1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != "/var/log/app.log" {
+		t.Errorf("c.Endpoint() = (%s); want (/var/log/app.log)", c.Endpoint())
+	}
+	if c.TypeName() != "example_type" {
+		t.Errorf("c.TypeName() = (%s); want (example_type)", c.TypeName())
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+func (badMarshaller) AllKeys() []string                                 { return []string{} }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	c := new(logfile.Config)
+	tcs := []struct {
+		name  string
+		input *bytes.Buffer
+	}{
+		{
+			name: "timeout",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                path: app.log
+                pattern: (?P<a>.*)
+                timeout: abc
+                interval: 1s
+    `)),
+		},
+		{
+			name: "bad format",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                path: app.log
+                format: xml
+                interval: 1s
+    `)),
+		},
+		{
+			name: "no pattern",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                path: app.log
+                interval: 1s
+    `)),
+		},
+		{
+			name: "no path",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                format: json
+                interval: 1s
+    `)),
+		},
+		{
+			name: "bad interval",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                path: app.log
+                pattern: (?P<a>.*)
+                timeout: 1s
+                interval: def
+    `)),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v.ReadConfig(tc.input)
+			err := logfile.WithViper(v, "reader1", "readers.reader1")(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+
+	err := logfile.WithViper(&badMarshaller{}, "reader1", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := logfile.NewConfig(
+		logfile.WithLogger(log),
+	)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	if c.Mapper() != datatype.DefaultMapper() {
+		t.Errorf("c.Mapper() = (%v); want (%v)", c.Mapper(), datatype.DefaultMapper())
+	}
+}
+
+func TestNewConfigErrors(t *testing.T) {
+	c, err := logfile.NewConfig(
+		logfile.WithLogger(nil),
+	)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestWithMapFile(t *testing.T) {
+	c := new(logfile.Config)
+	err := logfile.WithMapFile("")(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	cwd, _ := os.Getwd()
+	file, err := ioutil.TempFile(cwd, "yaml")
+	if err != nil {
+		panic(err)
+	}
+	oldName := file.Name() //required for viper
+	newName := file.Name() + ".yml"
+	os.Rename(oldName, newName)
+	defer os.Remove(newName)
+
+	err = logfile.WithMapFile(path.Base(file.Name()))(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	err = logfile.WithMapFile("this file does not exist")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigReader(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := logfile.NewConfig(
+		logfile.WithLogger(log),
+	)
+	c.LogName = "name"
+	c.LogTypeName = "name"
+	c.LogPath = "app.log"
+	c.ConfInterval = time.Second
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := c.Reader()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if e.(*logfile.Reader) != nil {
+		t.Errorf("e = (%v); want (nil)", e)
+	}
+	c.LogPattern = "(?P<duration>\\d+)ms"
+	e, err = c.Reader()
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if e.(*logfile.Reader) == nil {
+		t.Error("e.(*logfile.Reader) = (nil); want (Reader)")
+	}
+	c.LogFormat = "json"
+	c.LogPattern = ""
+	c.ConfTimeout = time.Second
+	c.LogOffsetFile = "app.offset"
+	c.LogFromBeginning = true
+	e, err = c.Reader()
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if e.Timeout() != time.Second {
+		t.Errorf("e.Timeout() = (%v); want (1s)", e.Timeout())
+	}
+}
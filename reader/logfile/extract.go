@@ -0,0 +1,131 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// extract returns the fields found in the line. The values are either float64
+// or string, and the non-finite numbers are left out. It returns false if the line does not match the pattern or is not
+// a valid JSON object.
+func (r *Reader) extract(line string) (map[string]interface{}, bool) {
+	if r.jsonLines {
+		return extractJSON(line)
+	}
+	m := r.pattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := make(map[string]interface{})
+	for i, name := range r.pattern.SubexpNames() {
+		if i == 0 || name == "" || m[i] == "" {
+			continue
+		}
+		if f, err := strconv.ParseFloat(m[i], 64); err == nil {
+			// the non-finite values, e.g. nan and inf, cannot be encoded.
+			if !math.IsNaN(f) && !math.IsInf(f, 0) {
+				fields[name] = f
+			}
+			continue
+		}
+		fields[name] = m[i]
+	}
+	return fields, true
+}
+
+func extractJSON(line string) (map[string]interface{}, bool) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]interface{})
+	flatten("", obj, fields)
+	return fields, true
+}
+
+// flatten puts the numeric and string values of the nested objects into fields
+// with their keys joined by dots. Other values are ignored.
+func flatten(prefix string, obj map[string]interface{}, fields map[string]interface{}) {
+	for k, v := range obj {
+		switch val := v.(type) {
+		case float64, string:
+			fields[prefix+k] = val
+		case map[string]interface{}:
+			flatten(prefix+k+".", val, fields)
+		}
+	}
+}
+
+// stats holds the statistics of a numeric field over an interval.
+type stats struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Last  float64 `json:"last"`
+}
+
+func (s *stats) add(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	s.Last = v
+}
+
+// aggregate collects the fields of the lines read in one interval.
+type aggregate struct {
+	lines     int
+	unmatched int
+	numbers   map[string]*stats
+	strings   map[string]string
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{
+		numbers: make(map[string]*stats),
+		strings: make(map[string]string),
+	}
+}
+
+func (a *aggregate) add(fields map[string]interface{}) {
+	a.lines++
+	for k, v := range fields {
+		switch val := v.(type) {
+		case float64:
+			s, ok := a.numbers[k]
+			if !ok {
+				s = &stats{}
+				a.numbers[k] = s
+			}
+			s.add(val)
+		case string:
+			a.strings[k] = val
+		}
+	}
+}
+
+// result returns the object to be presented to the mapper. The lines and
+// unmatched keys are always present and take precedence over the extracted
+// fields with the same names.
+func (a *aggregate) result() map[string]interface{} {
+	res := make(map[string]interface{}, len(a.numbers)+len(a.strings)+2)
+	for k, v := range a.strings {
+		res[k] = v
+	}
+	for k, v := range a.numbers {
+		res[k] = v
+	}
+	res["lines"] = a.lines
+	res["unmatched"] = a.unmatched
+	return res
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	r := &Reader{pattern: regexp.MustCompile(`(?P<status>\w+) code=(?P<code>\d+)(?: size=(?P<size>\d+))?`)}
+	fields, ok := r.extract("ok code=200")
+	if !ok {
+		t.Fatal("ok = (false); want (true)")
+	}
+	if fields["status"] != "ok" {
+		t.Errorf(`fields["status"] = (%v); want (ok)`, fields["status"])
+	}
+	if fields["code"] != 200.0 {
+		t.Errorf(`fields["code"] = (%v); want (200)`, fields["code"])
+	}
+	if _, ok := fields["size"]; ok {
+		t.Error("empty groups should not be extracted")
+	}
+	if _, ok = r.extract("!!!"); ok {
+		t.Error("ok = (true); want (false)")
+	}
+	for _, v := range []string{"nan", "inf", "-Infinity"} {
+		fields, ok = r.extract(v + " code=200 size=1")
+		if !ok {
+			t.Fatal("ok = (false); want (true)")
+		}
+		if _, ok := fields["status"]; ok {
+			t.Errorf(`fields["status"] = (%v); want (none)`, fields["status"])
+		}
+	}
+
+	r = &Reader{jsonLines: true}
+	fields, ok = r.extract(`{"a":{"b":1,"c":[1,2]},"d":true,"e":"f"}`)
+	if !ok {
+		t.Fatal("ok = (false); want (true)")
+	}
+	if len(fields) != 2 || fields["a.b"] != 1.0 || fields["e"] != "f" {
+		t.Errorf("fields = (%v); want (map[a.b:1 e:f])", fields)
+	}
+	if _, ok = r.extract(`[1, 2]`); ok {
+		t.Error("ok = (true); want (false)")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	a := newAggregate()
+	a.add(map[string]interface{}{"lines": 10.0, "v": -1.0, "s": "a"})
+	a.add(map[string]interface{}{"v": 3.0, "s": "b"})
+	a.add(nil)
+	res := a.result()
+	if res["lines"] != 3 {
+		t.Errorf(`res["lines"] = (%v); want (3)`, res["lines"])
+	}
+	if res["s"] != "b" {
+		t.Errorf(`res["s"] = (%v); want (b)`, res["s"])
+	}
+	s := res["v"].(*stats)
+	want := stats{Count: 2, Sum: 2, Min: -1, Max: 3, Last: 3}
+	if *s != want {
+		t.Errorf(`res["v"] = (%v); want (%v)`, *s, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"regexp"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoExtractor is returned when neither a pattern nor the JSON-lines mode
+	// is provided.
+	ErrNoExtractor = errors.New("either a pattern or json lines mode should be provided")
+
+	// ErrNoNamedGroup is returned when the pattern has no named groups.
+	ErrNoNamedGroup = errors.New("pattern should have at least one named group")
+
+	errIncompatible = errors.New("incompatible reader")
+)
+
+// WithPath sets the path to the log file. Unlike reader.WithEndpoint, it does
+// not expect a URL.
+func WithPath(path string) func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		if path == "" {
+			return reader.ErrEmptyEndpoint
+		}
+		e.SetEndpoint(path)
+		return nil
+	}
+}
+
+// WithPattern sets the regular expression used for extracting the fields. Only
+// named groups are extracted, e.g. `took (?P<duration>\d+)ms`.
+func WithPattern(pattern string) func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		r, ok := e.(*Reader)
+		if !ok {
+			return errIncompatible
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrap(err, "compiling pattern")
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				named = true
+				break
+			}
+		}
+		if !named {
+			return ErrNoNamedGroup
+		}
+		r.pattern = re
+		return nil
+	}
+}
+
+// WithJSONLines sets the reader to decode each line as a JSON object.
+func WithJSONLines() func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		r, ok := e.(*Reader)
+		if !ok {
+			return errIncompatible
+		}
+		r.jsonLines = true
+		return nil
+	}
+}
+
+// WithOffsetFile sets the file the reader stores its position in, so it can
+// continue from where it left off after a restart.
+func WithOffsetFile(path string) func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		r, ok := e.(*Reader)
+		if !ok {
+			return errIncompatible
+		}
+		r.offsetFile = path
+		return nil
+	}
+}
+
+// WithFromBeginning sets the reader to read the file from the beginning when
+// there is no stored offset. By default the reader starts at the end of the
+// file.
+func WithFromBeginning() func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		r, ok := e.(*Reader)
+		if !ok {
+			return errIncompatible
+		}
+		r.fromStart = true
+		return nil
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package logfile contains logic to tail a log file and extract metrics from
+// its lines. Each line is either matched against a regular expression with
+// named groups, or decoded as a JSON object when the JSON-lines mode is
+// selected. Every time the engine issues a job, the lines written since the
+// last read are aggregated and returned as one JSON object.
+//
+// Numeric fields are presented with their statistics over the interval, and
+// string fields with the last seen value. For example with this pattern:
+//
+//    (?P<method>[A-Z]+) (?P<path>\S+) took (?P<duration>[\d.]+)ms
+//
+// the result would look like:
+//
+//    {
+//        "lines": 3,
+//        "unmatched": 0,
+//        "method": "GET",
+//        "path": "/users",
+//        "duration": {"count": 3, "sum": 42, "min": 9, "max": 20, "last": 13}
+//    }
+//
+// The reader follows the file when it is rotated or truncated. If an offset
+// file is provided, the position of the last read line is stored there so the
+// lines are not counted twice after a restart.
+package logfile
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// Reader tails a log file and extracts fields from its lines. It implements
+// DataReader interface.
+type Reader struct {
+	name       string
+	endpoint   string
+	log        tools.FieldLogger
+	mapper     datatype.Mapper
+	typeName   string
+	interval   time.Duration
+	timeout    time.Duration
+	pattern    *regexp.Regexp
+	jsonLines  bool
+	offsetFile string
+	fromStart  bool
+
+	mu     sync.Mutex
+	pinged bool
+	file   *os.File
+	offset int64
+}
+
+// New generates the Reader based on the provided options. The endpoint is the
+// path to the log file, and should be set with the WithPath option. Either
+// WithPattern or WithJSONLines should be provided.
+func New(options ...func(reader.Constructor) error) (*Reader, error) {
+	r := &Reader{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+
+	if r.name == "" {
+		return nil, reader.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, reader.ErrEmptyEndpoint
+	}
+	if r.pattern == nil && !r.jsonLines {
+		return nil, ErrNoExtractor
+	}
+	if r.mapper == nil {
+		r.mapper = datatype.DefaultMapper()
+	}
+	if r.typeName == "" {
+		r.typeName = r.name
+	}
+	if r.interval == 0 {
+		r.interval = time.Second
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "logfile")
+	return r, nil
+}
+
+// Ping opens the log file and returns an EndpointNotAvailableError if it cannot
+// be opened. On the first successful call it restores the offset from the
+// offset file, or positions at the end of the file unless WithFromBeginning is
+// used.
+func (r *Reader) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		if _, err := os.Stat(r.endpoint); err != nil {
+			return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		return nil
+	}
+	f, err := os.Open(r.endpoint)
+	if err != nil {
+		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	offset, ok := r.loadOffset()
+	switch {
+	case ok && offset <= info.Size():
+	case ok:
+		r.log.Warnf("%s: file is smaller than the stored offset, reading from the beginning", r.name)
+		offset = 0
+	case r.fromStart:
+		offset = 0
+	default:
+		offset = info.Size()
+	}
+	r.file = f
+	r.offset = offset
+	r.pinged = true
+	return nil
+}
+
+// Read reads the lines written since the last call and returns their
+// aggregated fields.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pinged {
+		return nil, reader.ErrPingNotCalled
+	}
+	if err := job.Err(); err != nil {
+		return nil, err
+	}
+	lines, err := r.tail()
+	if err != nil {
+		r.log.WithField("reader", "logfile").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID()).
+			Debugf("%s: error reading file: %v", r.name, err)
+		return nil, reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	agg := newAggregate()
+	for _, line := range lines {
+		fields, ok := r.extract(line)
+		if !ok {
+			agg.unmatched++
+		}
+		agg.add(fields)
+	}
+	content, err := json.Marshal(agg.result())
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding fields")
+	}
+	if err = r.saveOffset(); err != nil {
+		r.log.Warnf("%s: error saving offset: %v", r.name, err)
+	}
+	res := &reader.Result{
+		ID:       job.ID(),
+		Time:     time.Now(), // It is sensible to record the time now
+		Content:  content,
+		TypeName: r.TypeName(),
+		Mapper:   r.Mapper(),
+	}
+	return res, nil
+}
+
+// Close closes the file and stores the offset.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.saveOffset()
+	r.file.Close()
+	r.file = nil
+	r.pinged = false
+	return err
+}
+
+// Offset returns the position of the last line read.
+func (r *Reader) Offset() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.offset
+}
+
+// Name shows the name identifier for this reader.
+func (r *Reader) Name() string { return r.name }
+
+// SetName sets the name of the reader.
+func (r *Reader) SetName(name string) { r.name = name }
+
+// Endpoint returns the path to the log file.
+func (r *Reader) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the path to the log file.
+func (r *Reader) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// TypeName shows the typeName the recorder should record as.
+func (r *Reader) TypeName() string { return r.typeName }
+
+// SetTypeName sets the type name of the reader.
+func (r *Reader) SetTypeName(typeName string) { r.typeName = typeName }
+
+// Mapper returns the mapper object.
+func (r *Reader) Mapper() datatype.Mapper { return r.mapper }
+
+// SetMapper sets the mapper of the reader.
+func (r *Reader) SetMapper(mapper datatype.Mapper) { r.mapper = mapper }
+
+// Interval returns the interval.
+func (r *Reader) Interval() time.Duration { return r.interval }
+
+// SetInterval sets the interval of the reader.
+func (r *Reader) SetInterval(interval time.Duration) { r.interval = interval }
+
+// Timeout returns the time-out.
+func (r *Reader) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the reader.
+func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the reader.
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
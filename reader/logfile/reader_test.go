@@ -0,0 +1,301 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/reader/logfile"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+const pattern = `(?P<method>[A-Z]+) (?P<path>\S+) took (?P<duration>[\d.]+)ms`
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func appendFile(t *testing.T, name, content string) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+}
+
+func newReader(t *testing.T, path string, options ...func(reader.Constructor) error) *logfile.Reader {
+	options = append([]func(reader.Constructor) error{
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("app"),
+		logfile.WithPath(path),
+	}, options...)
+	red, err := logfile.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return red
+}
+
+func read(t *testing.T, red *logfile.Reader) map[string]interface{} {
+	res, err := red.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = datatype.JobResultDataTypes(res.Content, red.Mapper()); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	var got map[string]interface{}
+	if err = json.Unmarshal(res.Content, &got); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return got
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(reader.Constructor) error
+		err     error
+	}{
+		{"no name", []func(reader.Constructor) error{logfile.WithPath("a.log"), logfile.WithJSONLines()}, reader.ErrEmptyName},
+		{"no path", []func(reader.Constructor) error{reader.WithName("a"), logfile.WithJSONLines()}, reader.ErrEmptyEndpoint},
+		{"no extractor", []func(reader.Constructor) error{reader.WithName("a"), logfile.WithPath("a.log")}, logfile.ErrNoExtractor},
+		{"no named group", []func(reader.Constructor) error{logfile.WithPattern(`\d+`)}, logfile.ErrNoNamedGroup},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			red, err := logfile.New(tc.options...)
+			if errors.Cause(err) != tc.err {
+				t.Errorf("err = (%v); want (%v)", err, tc.err)
+			}
+			if red != nil {
+				t.Errorf("red = (%v); want (nil)", red)
+			}
+		})
+	}
+	_, err := logfile.New(logfile.WithPattern(`(?P<a>`))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestPing(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	red, err := logfile.New(
+		reader.WithName("app"),
+		logfile.WithPath(name),
+		logfile.WithJSONLines(),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = red.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+	err = red.Ping()
+	if _, ok := errors.Cause(err).(reader.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%T); want (reader.EndpointNotAvailableError)", err)
+	}
+	appendFile(t, name, "")
+	if err = red.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestReadPattern(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, "GET /old took 1000ms\n")
+	red := newReader(t, name, logfile.WithPattern(pattern))
+	defer red.Close()
+
+	got := read(t, red)
+	if got["lines"] != 0.0 {
+		t.Errorf(`got["lines"] = (%v); want (0): should start from the end`, got["lines"])
+	}
+
+	appendFile(t, name, "GET /users took 9ms\nPOST /login took 20ms\nnot a request\nGET /users took 13ms\nPOST /half")
+	got = read(t, red)
+	if got["lines"] != 4.0 {
+		t.Errorf(`got["lines"] = (%v); want (4)`, got["lines"])
+	}
+	if got["unmatched"] != 1.0 {
+		t.Errorf(`got["unmatched"] = (%v); want (1)`, got["unmatched"])
+	}
+	if got["path"] != "/users" {
+		t.Errorf(`got["path"] = (%v); want (/users)`, got["path"])
+	}
+	duration, ok := got["duration"].(map[string]interface{})
+	if !ok {
+		t.Fatalf(`got["duration"] = (%v); want (map)`, got["duration"])
+	}
+	want := map[string]float64{"count": 3, "sum": 42, "min": 9, "max": 20, "last": 13}
+	for k, v := range want {
+		if duration[k] != v {
+			t.Errorf("duration[%s] = (%v); want (%v)", k, duration[k], v)
+		}
+	}
+
+	appendFile(t, name, " took 5ms\n")
+	got = read(t, red)
+	if got["lines"] != 1.0 {
+		t.Errorf(`got["lines"] = (%v); want (1): unfinished line should be read later`, got["lines"])
+	}
+	if got["path"] != "/half" {
+		t.Errorf(`got["path"] = (%v); want (/half)`, got["path"])
+	}
+}
+
+func TestReadNonFinite(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, "")
+	red := newReader(t, name, logfile.WithPattern(`(?P<path>\S+) took (?P<duration>\S+)ms`))
+	defer red.Close()
+
+	appendFile(t, name, "/a took NaNms\n/b took infms\n/c took 2ms\n")
+	got := read(t, red)
+	if got["lines"] != 3.0 {
+		t.Errorf(`got["lines"] = (%v); want (3)`, got["lines"])
+	}
+	duration, ok := got["duration"].(map[string]interface{})
+	if !ok {
+		t.Fatalf(`got["duration"] = (%v); want (map)`, got["duration"])
+	}
+	if duration["count"] != 1.0 || duration["sum"] != 2.0 {
+		t.Errorf("duration = (%v); want (count 1 and sum 2)", duration)
+	}
+}
+
+func TestReadJSONLines(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, `{"level":"info","latency":3,"db":{"queries":2}}`+"\n")
+	red := newReader(t, name, logfile.WithJSONLines(), logfile.WithFromBeginning())
+	defer red.Close()
+
+	appendFile(t, name, "{bad json\n"+`{"level":"warn","latency":5,"db":{"queries":4}}`+"\n")
+	got := read(t, red)
+	if got["lines"] != 3.0 {
+		t.Errorf(`got["lines"] = (%v); want (3)`, got["lines"])
+	}
+	if got["unmatched"] != 1.0 {
+		t.Errorf(`got["unmatched"] = (%v); want (1)`, got["unmatched"])
+	}
+	if got["level"] != "warn" {
+		t.Errorf(`got["level"] = (%v); want (warn)`, got["level"])
+	}
+	queries, ok := got["db.queries"].(map[string]interface{})
+	if !ok {
+		t.Fatalf(`got["db.queries"] = (%v); want (map)`, got["db.queries"])
+	}
+	if queries["sum"] != 6.0 {
+		t.Errorf(`queries["sum"] = (%v); want (6)`, queries["sum"])
+	}
+}
+
+func TestReadRotation(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, "")
+	red := newReader(t, name, logfile.WithPattern(pattern))
+	defer red.Close()
+
+	appendFile(t, name, "GET /a took 1ms\n")
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	appendFile(t, name+".1", "GET /b took 2ms\n")
+	got := read(t, red)
+	if got["lines"] != 2.0 {
+		t.Errorf(`got["lines"] = (%v); want (2): before the new file is created`, got["lines"])
+	}
+
+	appendFile(t, name+".1", "GET /c took 3ms\n")
+	appendFile(t, name, "GET /d took 4ms\nGET /e took 5ms\n")
+	got = read(t, red)
+	if got["lines"] != 3.0 {
+		t.Errorf(`got["lines"] = (%v); want (3)`, got["lines"])
+	}
+	if got["path"] != "/e" {
+		t.Errorf(`got["path"] = (%v); want (/e)`, got["path"])
+	}
+}
+
+func TestReadTruncation(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, "")
+	red := newReader(t, name, logfile.WithPattern(pattern))
+	defer red.Close()
+
+	appendFile(t, name, "GET /a took 1ms\nGET /b took 2ms\n")
+	read(t, red)
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	appendFile(t, name, "GET /c took 3ms\n")
+	got := read(t, red)
+	if got["lines"] != 1.0 {
+		t.Errorf(`got["lines"] = (%v); want (1)`, got["lines"])
+	}
+	if got["path"] != "/c" {
+		t.Errorf(`got["path"] = (%v); want (/c)`, got["path"])
+	}
+}
+
+func TestOffsetFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	name := filepath.Join(dir, "app.log")
+	offsetFile := filepath.Join(dir, "app.offset")
+	appendFile(t, name, "GET /a took 1ms\n")
+	red := newReader(t, name, logfile.WithPattern(pattern), logfile.WithOffsetFile(offsetFile), logfile.WithFromBeginning())
+	got := read(t, red)
+	if got["lines"] != 1.0 {
+		t.Errorf(`got["lines"] = (%v); want (1)`, got["lines"])
+	}
+	red.Close()
+
+	appendFile(t, name, "GET /b took 2ms\n")
+	red = newReader(t, name, logfile.WithPattern(pattern), logfile.WithOffsetFile(offsetFile), logfile.WithFromBeginning())
+	defer red.Close()
+	got = read(t, red)
+	if got["lines"] != 1.0 {
+		t.Errorf(`got["lines"] = (%v); want (1): lines should not be read twice`, got["lines"])
+	}
+	if got["path"] != "/b" {
+		t.Errorf(`got["path"] = (%v); want (/b)`, got["path"])
+	}
+	if red.Offset() != 32 {
+		t.Errorf("red.Offset() = (%d); want (32)", red.Offset())
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxReadSize is the maximum amount of bytes read on each call. The rest is
+// read on the next calls.
+const maxReadSize = 16 << 20
+
+// tail returns the complete lines written since the last call. If the file has
+// been rotated, the rest of the old file is read before switching to the new
+// one. If the file has been truncated, it starts from the beginning.
+func (r *Reader) tail() ([]string, error) {
+	current, err := r.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(r.endpoint)
+	if err != nil {
+		// The file has been moved and the new one is not created yet.
+		return r.readLines()
+	}
+	if !os.SameFile(current, info) {
+		lines, err := r.readLines()
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(r.endpoint)
+		if err != nil {
+			return lines, nil
+		}
+		r.file.Close()
+		r.file, r.offset = f, 0
+		r.log.Infof("%s: file has been rotated", r.name)
+		more, err := r.readLines()
+		return append(lines, more...), err
+	}
+	if info.Size() < r.offset {
+		r.log.Infof("%s: file has been truncated", r.name)
+		r.offset = 0
+	}
+	return r.readLines()
+}
+
+// readLines reads the complete lines of the current file from the offset, and
+// moves the offset after the last one.
+func (r *Reader) readLines() ([]string, error) {
+	if _, err := r.file.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.file, maxReadSize))
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		if len(data) < maxReadSize {
+			// the last line is not finished yet.
+			return nil, nil
+		}
+		end = len(data) - 1
+	}
+	data = data[:end+1]
+	r.offset += int64(len(data))
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func (r *Reader) loadOffset() (int64, bool) {
+	if r.offsetFile == "" {
+		return 0, false
+	}
+	data, err := ioutil.ReadFile(r.offsetFile)
+	if err != nil {
+		return 0, false
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || offset < 0 {
+		r.log.Warnf("%s: invalid offset file: %s", r.name, r.offsetFile)
+		return 0, false
+	}
+	return offset, true
+}
+
+// saveOffset writes the offset into a temporary file and moves it in place,
+// therefore the offset file is never left half written.
+func (r *Reader) saveOffset() error {
+	if r.offsetFile == "" {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.offsetFile), filepath.Base(r.offsetFile))
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.WriteString(strconv.FormatInt(r.offset, 10)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.offsetFile)
+}
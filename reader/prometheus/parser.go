@@ -0,0 +1,298 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric types defined in the text exposition format.
+const (
+	counterType   = "counter"
+	gaugeType     = "gauge"
+	histogramType = "histogram"
+	summaryType   = "summary"
+	untypedType   = "untyped"
+)
+
+// ParseError is returned when a line of the exposition cannot be parsed.
+type ParseError struct {
+	Line   int
+	Reason string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// sample is a single line of the exposition.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parse reads the Prometheus text format from r and returns a flat map of keys
+// to values. Each key is made of the family name, followed by the sorted label
+// pairs and the histogram or summary component, all joined by dots:
+//
+//    http_requests_total{code="200",method="get"} 3  => http_requests_total.code_200.method_get: 3
+//    rpc_duration_seconds{quantile="0.5"} 0.01      => rpc_duration_seconds.quantile_0_5: 0.01
+//    rpc_duration_seconds_count 20                  => rpc_duration_seconds.count: 20
+//    request_size_bucket{le="+Inf"} 4               => request_size.bucket.le_inf: 4
+//
+// Samples with NaN or infinite values are skipped as they cannot be presented
+// in JSON.
+func parse(r io.Reader) (map[string]float64, error) {
+	types := make(map[string]string)
+	var samples []sample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			name, kind, ok := typeLine(line)
+			if ok {
+				types[name] = kind
+			}
+			continue
+		}
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, ParseError{Line: lineNo, Reason: err.Error()}
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		result[sampleKey(s, types)] = s.value
+	}
+	return result, nil
+}
+
+// typeLine returns the metric name and its type if the line is a TYPE
+// comment. HELP lines and other comments are ignored.
+func typeLine(line string) (string, string, bool) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#"))
+	if len(fields) < 3 || fields[0] != "TYPE" {
+		return "", "", false
+	}
+	switch kind := strings.ToLower(fields[2]); kind {
+	case counterType, gaugeType, histogramType, summaryType, untypedType:
+		return fields[1], kind, true
+	}
+	return "", "", false
+}
+
+// parseSample parses lines in form of:
+//    metric_name [ "{" label_name "=" `"` label_value `"` { "," ... } [ "," ] "}" ] value [ timestamp ]
+func parseSample(line string) (sample, error) {
+	s := sample{labels: make(map[string]string)}
+	i := 0
+	for i < len(line) && isNameChar(line[i], i == 0) {
+		i++
+	}
+	if i == 0 {
+		return s, fmt.Errorf("invalid metric name in %q", line)
+	}
+	s.name = line[:i]
+	rest := strings.TrimLeft(line[i:], " \t")
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseLabels(rest[1:], s.labels)
+		if err != nil {
+			return s, err
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("expected a value and an optional timestamp in %q", line)
+	}
+	v, err := parseValue(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.value = v
+	if len(fields) == 2 {
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return s, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+	}
+	return s, nil
+}
+
+// parseLabels reads the label pairs into labels until it reaches the closing
+// brace, and returns the rest of the line.
+func parseLabels(in string, labels map[string]string) (string, error) {
+	for {
+		in = strings.TrimLeft(in, " \t")
+		if strings.HasPrefix(in, "}") {
+			return in[1:], nil
+		}
+		i := 0
+		for i < len(in) && isNameChar(in[i], i == 0) && in[i] != ':' {
+			i++
+		}
+		if i == 0 {
+			return "", fmt.Errorf("invalid label name in %q", in)
+		}
+		name := in[:i]
+		in = strings.TrimLeft(in[i:], " \t")
+		if !strings.HasPrefix(in, "=") {
+			return "", fmt.Errorf("expected '=' after label %q", name)
+		}
+		in = strings.TrimLeft(in[1:], " \t")
+		if !strings.HasPrefix(in, `"`) {
+			return "", fmt.Errorf("expected quoted value for label %q", name)
+		}
+		value, rest, err := unquote(in[1:])
+		if err != nil {
+			return "", err
+		}
+		labels[name] = value
+		in = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(in, ",") {
+			in = in[1:]
+			continue
+		}
+		if !strings.HasPrefix(in, "}") {
+			return "", fmt.Errorf("expected ',' or '}' after label %q", name)
+		}
+	}
+}
+
+// unquote reads an escaped label value up to the closing quote, and returns the
+// value and the rest of the input.
+func unquote(in string) (string, string, error) {
+	b := new(bytes.Buffer)
+	for i := 0; i < len(in); i++ {
+		switch c := in[i]; c {
+		case '"':
+			return b.String(), in[i+1:], nil
+		case '\\':
+			i++
+			if i >= len(in) {
+				return "", "", fmt.Errorf("unterminated escape sequence")
+			}
+			switch in[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"':
+				b.WriteByte(in[i])
+			default:
+				return "", "", fmt.Errorf("invalid escape sequence: \\%c", in[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated label value")
+}
+
+func parseValue(v string) (float64, error) {
+	switch v {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", v)
+	}
+	return f, nil
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// sampleKey finds the family of the sample and generates the key it should be
+// stored with.
+func sampleKey(s sample, types map[string]string) string {
+	family, component := s.name, ""
+	if _, ok := types[s.name]; !ok {
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			base := strings.TrimSuffix(s.name, suffix)
+			if base == s.name {
+				continue
+			}
+			kind := types[base]
+			if kind == histogramType || (kind == summaryType && suffix != "_bucket") {
+				family, component = base, suffix[1:]
+				break
+			}
+		}
+	}
+
+	var special string
+	switch {
+	case component == "bucket":
+		special = "le"
+	case types[family] == summaryType && component == "":
+		special = "quantile"
+	}
+
+	names := make([]string, 0, len(s.labels))
+	for name := range s.labels {
+		if name != special {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	parts := []string{family}
+	for _, name := range names {
+		parts = append(parts, name+"_"+sanitise(s.labels[name]))
+	}
+	if component != "" {
+		parts = append(parts, component)
+	}
+	if v, ok := s.labels[special]; ok && special != "" {
+		parts = append(parts, special+"_"+sanitise(v))
+	}
+	return strings.Join(parts, ".")
+}
+
+// sanitise replaces the characters that are not safe to be used in a key with
+// underscores.
+func sanitise(v string) string {
+	if v == "+Inf" {
+		return "inf"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, v)
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 42
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="400"} 3
+http_requests_total{method="post", code="200",} 1027 1395066363000
+# TYPE request_size histogram
+request_size_bucket{le="0.5"} 1
+request_size_bucket{le="+Inf"} 4
+request_size_sum 10.5
+request_size_count 4
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{service="a b",quantile="0.99"} 76656
+rpc_duration_seconds_sum{service="a b"} 1.7560473e+07
+rpc_duration_seconds_count{service="a b"} 2693
+escaped{path="C:\\dir\"x\""} 2
+untyped_metric -1.5e-3
+not_a_number NaN
+infinity +Inf
+`
+	got, err := parse(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := map[string]float64{
+		"go_goroutines": 42,
+		"http_requests_total.code_400.method_post":       3,
+		"http_requests_total.code_200.method_post":       1027,
+		"request_size.bucket.le_0_5":                     1,
+		"request_size.bucket.le_inf":                     4,
+		"request_size.sum":                               10.5,
+		"request_size.count":                             4,
+		"rpc_duration_seconds.service_a_b.quantile_0_99": 76656,
+		"rpc_duration_seconds.service_a_b.sum":           1.7560473e+07,
+		"rpc_duration_seconds.service_a_b.count":         2693,
+		"escaped.path_C__dir_x_":                         2,
+		"untyped_metric":                                 -1.5e-3,
+	}
+	if len(got) != len(want) {
+		t.Errorf("len(got) = (%d); want (%d): %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			t.Errorf("got[%s] = (%v); want (%v)", k, g, v)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"json", `{"a": 1}`},
+		{"no value", "metric_name\n"},
+		{"bad value", "metric_name abc\n"},
+		{"bad timestamp", "metric_name 1 abc\n"},
+		{"extra fields", "metric_name 1 2 3\n"},
+		{"unterminated labels", `metric_name{a="b" 1`},
+		{"unquoted label", `metric_name{a=b} 1`},
+		{"bad escape", `metric_name{a="\t"} 1`},
+		{"unterminated value", `metric_name{a="b} 1`},
+		{"missing equal sign", `metric_name{a "b"} 1`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parse(bytes.NewBufferString(tc.input))
+			if _, ok := err.(ParseError); !ok {
+				t.Errorf("err = (%#v); want (ParseError)", err)
+			}
+		})
+	}
+}
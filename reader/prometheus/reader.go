@@ -0,0 +1,182 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package prometheus contains logic to read from an endpoint that exposes its
+// metrics in the Prometheus text exposition format. Counters, gauges,
+// histograms and summaries are turned into a flat JSON object, which then goes
+// through the mapper like any other reader's payload. Labels become a part of
+// the keys, for example:
+//
+//    http_requests_total{code="200",method="get"} 3
+//
+// is presented as:
+//
+//    {"http_requests_total.code_200.method_get": 3}
+//
+// Histogram buckets and summary quantiles are grouped under their family name:
+//
+//    rpc_duration_seconds.quantile_0_5
+//    rpc_duration_seconds.sum
+//    rpc_duration_seconds.count
+//    request_size.bucket.le_inf
+//
+// Samples with NaN or infinite values are dropped, because they cannot be
+// presented in JSON.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Reader can read from any application that exposes Prometheus metrics in the
+// text format. It implements DataReader interface.
+type Reader struct {
+	name     string
+	endpoint string
+	log      tools.FieldLogger
+	mapper   datatype.Mapper
+	typeName string
+	interval time.Duration
+	timeout  time.Duration
+	pinged   bool
+}
+
+// New generates the Reader based on the provided options.
+func New(options ...func(reader.Constructor) error) (*Reader, error) {
+	r := &Reader{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+
+	if r.name == "" {
+		return nil, reader.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, reader.ErrEmptyEndpoint
+	}
+	if r.mapper == nil {
+		r.mapper = datatype.DefaultMapper()
+	}
+	if r.typeName == "" {
+		r.typeName = r.name
+	}
+	if r.interval == 0 {
+		r.interval = time.Second
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "expipe")
+	return r, nil
+}
+
+// Ping pings the endpoint and return nil if was successful.
+// It returns an EndpointNotAvailableError if the endpoint id unavailable.
+func (r *Reader) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	_, err := ctxhttp.Head(ctx, nil, r.endpoint)
+	if err != nil {
+		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	r.pinged = true
+	return nil
+}
+
+// Read scrapes the endpoint and converts the exposition into a JSON object. It
+// returns reader.ErrInvalidJSON if the response is not in the Prometheus text
+// format.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	if !r.pinged {
+		return nil, reader.ErrPingNotCalled
+	}
+	resp, err := ctxhttp.Get(job, nil, r.endpoint)
+	if err != nil {
+		if _, ok := err.(*url.Error); ok {
+			err = reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		r.log.WithField("reader", "prometheus_reader").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID()).
+			Debugf("%s: error making request: %v", r.name, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	values, err := parse(resp.Body)
+	if err != nil {
+		r.log.WithField("reader", "prometheus_reader").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID()).
+			Debugf("%s: error parsing metrics: %v", r.name, err)
+		return nil, reader.ErrInvalidJSON
+	}
+	content, err := json.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding metrics")
+	}
+	res := &reader.Result{
+		ID:       job.ID(),
+		Time:     time.Now(), // It is sensible to record the time now
+		Content:  content,
+		TypeName: r.TypeName(),
+		Mapper:   r.Mapper(),
+	}
+	return res, nil
+}
+
+// Name shows the name identifier for this reader.
+func (r *Reader) Name() string { return r.name }
+
+// SetName sets the name of the reader.
+func (r *Reader) SetName(name string) { r.name = name }
+
+// Endpoint returns the endpoint.
+func (r *Reader) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the endpoint of the reader.
+func (r *Reader) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// TypeName shows the typeName the recorder should record as.
+func (r *Reader) TypeName() string { return r.typeName }
+
+// SetTypeName sets the type name of the reader.
+func (r *Reader) SetTypeName(typeName string) { r.typeName = typeName }
+
+// Mapper returns the mapper object.
+func (r *Reader) Mapper() datatype.Mapper { return r.mapper }
+
+// SetMapper sets the mapper of the reader.
+func (r *Reader) SetMapper(mapper datatype.Mapper) { r.mapper = mapper }
+
+// Interval returns the interval.
+func (r *Reader) Interval() time.Duration { return r.interval }
+
+// SetInterval sets the interval of the reader.
+func (r *Reader) SetInterval(interval time.Duration) { r.interval = interval }
+
+// Timeout returns the time-out.
+func (r *Reader) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the reader.
+func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the reader.
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
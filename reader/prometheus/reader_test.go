@@ -0,0 +1,105 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/reader/prometheus"
+	rt "github.com/arsham/expipe/reader/testing"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+)
+
+var metrics = []byte(`# HELP expipe_up Whether the app is up.
+# TYPE expipe_up gauge
+expipe_up 1
+`)
+
+func getTestServer() *httptest.Server {
+	return httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(metrics)
+		}),
+	)
+}
+
+type Construct struct {
+	*rt.BaseConstruct
+	testServer *httptest.Server
+}
+
+func (c *Construct) TestServer() *httptest.Server {
+	c.testServer = getTestServer()
+	return c.testServer
+}
+
+func (c *Construct) Object() (reader.DataReader, error) {
+	return prometheus.New(c.Setters()...)
+}
+
+func (c *Construct) ValidPayload() []byte   { return metrics }
+func (c *Construct) InvalidPayload() []byte { return []byte(`this is { not valid`) }
+
+func TestPrometheusReader(t *testing.T) {
+	rt.TestSuites(t, func() (rt.Constructor, func()) {
+		c := &Construct{
+			testServer:    getTestServer(),
+			BaseConstruct: rt.NewBaseConstruct(),
+		}
+		return c, func() { c.testServer.Close() }
+	})
+}
+
+func TestReadExposition(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1395066363000
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+`))
+	}))
+	defer ts.Close()
+	red, err := prometheus.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("prom"),
+		reader.WithEndpoint(ts.URL),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res, err := red.Read(token.New(context.Background()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var got map[string]float64
+	if err = json.Unmarshal(res.Content, &got); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := map[string]float64{
+		"http_requests_total.code_200.method_get": 1027,
+		"rpc_duration_seconds.quantile_0_5":       4773,
+		"rpc_duration_seconds.sum":                1.7560473e+07,
+		"rpc_duration_seconds.count":              2693,
+	}
+	if len(got) != len(want) {
+		t.Errorf("len(got) = (%d); want (%d)", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got[%s] = (%v); want (%v)", k, got[k], v)
+		}
+	}
+}
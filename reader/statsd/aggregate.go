@@ -0,0 +1,115 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"math"
+	"sort"
+)
+
+// timer holds the statistics of a timer over an interval.
+type timer struct {
+	Count float64 `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// aggregate collects the metrics received in one interval. Gauges keep their
+// values between the intervals, as the StatsD protocol defines.
+type aggregate struct {
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string][]float64
+	counts   map[string]float64 // timer counts with the sample rates applied.
+	sets     map[string]map[string]struct{}
+	badLines int
+}
+
+func newAggregate(gauges map[string]float64) *aggregate {
+	if gauges == nil {
+		gauges = make(map[string]float64)
+	}
+	return &aggregate{
+		counters: make(map[string]float64),
+		gauges:   gauges,
+		timers:   make(map[string][]float64),
+		counts:   make(map[string]float64),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (a *aggregate) add(m metric) {
+	switch m.kind {
+	case counterType:
+		a.counters[m.name] += m.value / m.rate
+	case gaugeType:
+		if m.delta {
+			a.gauges[m.name] += m.value
+			return
+		}
+		a.gauges[m.name] = m.value
+	case timerType, histogramType:
+		a.timers[m.name] = append(a.timers[m.name], m.value)
+		a.counts[m.name] += 1 / m.rate
+	case setType:
+		s, ok := a.sets[m.name]
+		if !ok {
+			s = make(map[string]struct{})
+			a.sets[m.name] = s
+		}
+		s[m.raw] = struct{}{}
+	}
+}
+
+// result returns the object to be presented to the mapper, grouped by the
+// metric types.
+func (a *aggregate) result() map[string]interface{} {
+	timers := make(map[string]timer, len(a.timers))
+	for name, values := range a.timers {
+		timers[name] = summarise(values, a.counts[name])
+	}
+	sets := make(map[string]int, len(a.sets))
+	for name, s := range a.sets {
+		sets[name] = len(s)
+	}
+	return map[string]interface{}{
+		"counters":  a.counters,
+		"gauges":    a.gauges,
+		"timers":    timers,
+		"sets":      sets,
+		"bad_lines": a.badLines,
+	}
+}
+
+func summarise(values []float64, count float64) timer {
+	sort.Float64s(values)
+	t := timer{
+		Count: count,
+		Min:   values[0],
+		Max:   values[len(values)-1],
+		P50:   percentile(values, 50),
+		P90:   percentile(values, 90),
+		P99:   percentile(values, 99),
+	}
+	for _, v := range values {
+		t.Sum += v
+	}
+	t.Mean = t.Sum / float64(len(values))
+	return t
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Config holds the necessary configuration for setting up a StatsD listener.
+// Protocol can be either "udp" (default) or "tcp". If MapFile is provided, the
+// data will be mapped, otherwise it uses the DefaultMapper.
+type Config struct {
+	log            tools.FieldLogger
+	StatsdTypeName string `mapstructure:"type_name"`
+	StatsdAddress  string `mapstructure:"address"`
+	StatsdProtocol string `mapstructure:"protocol"`
+	StatsdInterval string `mapstructure:"interval"`
+	StatsdTimeout  string `mapstructure:"timeout"`
+	MapFile        string `mapstructure:"map_file"`
+	StatsdName     string
+	ConfInterval   time.Duration
+	ConfTimeout    time.Duration
+	mapper         datatype.Mapper
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig returns an instance of the statsd reader.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if obj.mapper == nil {
+		obj.mapper = datatype.DefaultMapper()
+	}
+	return obj, nil
+}
+
+// Reader implements the ReaderConf interface.
+func (c *Config) Reader() (reader.DataReader, error) {
+	options := []func(reader.Constructor) error{
+		reader.WithLogger(c.Logger()),
+		WithAddress(c.Endpoint()),
+		reader.WithMapper(c.mapper),
+		reader.WithName(c.Name()),
+		reader.WithTypeName(c.StatsdTypeName),
+		reader.WithInterval(c.Interval()),
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, reader.WithTimeout(c.Timeout()))
+	}
+	if c.StatsdProtocol != "" {
+		options = append(options, WithProtocol(c.StatsdProtocol))
+	}
+	return New(options...)
+}
+
+// Name returns name from the config file.
+func (c *Config) Name() string { return c.StatsdName }
+
+// TypeName returns type name from the config file.
+func (c *Config) TypeName() string { return c.StatsdTypeName }
+
+// Endpoint returns the address to listen on.
+func (c *Config) Endpoint() string { return c.StatsdAddress }
+
+// Interval returns interval after reading from the config file.
+func (c *Config) Interval() time.Duration { return c.ConfInterval }
+
+// Timeout returns timeout after reading from the config file.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger returns logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// Mapper returns the mapper assigned to this object.
+func (c *Config) Mapper() datatype.Mapper { return c.mapper }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+// WithViper produces an error any of the inputs are empty. The timeout is
+// optional, as the reader does not make any outgoing calls.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil || v.AllKeys() == nil {
+			return errors.Wrap(err, "decoding config")
+		}
+
+		var interval, timeout time.Duration
+		if interval, err = time.ParseDuration(c.StatsdInterval); err != nil {
+			return errors.Wrapf(err, "parse interval (%v)", c.StatsdInterval)
+		}
+		c.ConfInterval = interval
+
+		if c.StatsdTimeout != "" {
+			if timeout, err = time.ParseDuration(c.StatsdTimeout); err != nil {
+				return errors.Wrapf(err, "parse timeout (%v)", c.StatsdTimeout)
+			}
+		}
+		if c.StatsdTypeName == "" {
+			return fmt.Errorf("type_name cannot be empty: %s", c.StatsdTypeName)
+		}
+		if c.StatsdAddress == "" {
+			return fmt.Errorf("address cannot be empty: %s", c.StatsdAddress)
+		}
+		switch c.StatsdProtocol {
+		case "", UDP, TCP:
+		default:
+			return InvalidProtocolError(c.StatsdProtocol)
+		}
+		c.ConfTimeout = timeout
+		c.StatsdName = name
+		return WithMapFile(c.MapFile)(c)
+	}
+}
+
+// WithMapFile returns any errors on reading the file. If the mapFile is empty,
+// it does nothing and returns nil.
+func WithMapFile(mapFile string) Conf {
+	return func(c *Config) error {
+		if mapFile == "" {
+			return nil
+		}
+		extension := filepath.Ext(mapFile)
+		filename := mapFile[0 : len(mapFile)-len(extension)]
+		v := viper.New()
+		v.SetConfigName(filename)
+		v.SetConfigType("yaml")
+		v.AddConfigPath(".")
+		err := v.ReadInConfig()
+		if err != nil {
+			return err
+		}
+		c.mapper = datatype.MapsFromViper(v)
+		return nil
+	}
+}
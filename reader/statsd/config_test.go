@@ -0,0 +1,283 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader/statsd"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(statsd.Config)
+	err := statsd.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = statsd.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+	AllKeys() []string
+}
+
+func TestWithViper(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	c := new(statsd.Config)
+	input := `
+    readers:
+        reader1:
+            address: 127.0.0.1:8125
+            type_name: %s
+            map_file: noway
+            timeout: 10s
+            interval: 1s
+    `
+
+	in := bytes.NewBufferString(fmt.Sprintf(input, ""))
+	v.ReadConfig(in)
+	err := statsd.WithViper(v, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): empty typeName")
+	}
+
+	in = bytes.NewBufferString(fmt.Sprintf(input, ""))
+	v.ReadConfig(in)
+	err = statsd.WithViper(v, "name", "")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): empty key")
+	}
+
+	in = bytes.NewBufferString(fmt.Sprintf(input, "example_type"))
+	v.ReadConfig(in)
+	err = statsd.WithViper(v, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): map file does not exist")
+	}
+
+	err = statsd.WithViper(nil, "name", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error): nil viper")
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            address: 127.0.0.1:8125
+            type_name: example_type
+            timeout: 10s
+            interval: 1s
+    `))
+	v.ReadConfig(input)
+	c := new(statsd.Config)
+	err := statsd.WithViper(v, "reader1", "readers.reader1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != "127.0.0.1:8125" {
+		t.Errorf("c.Endpoint() = (%s); want (127.0.0.1:8125)", c.Endpoint())
+	}
+	if c.TypeName() != "example_type" {
+		t.Errorf("c.TypeName() = (%s); want (example_type)", c.TypeName())
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+func (badMarshaller) AllKeys() []string                                 { return []string{} }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	c := new(statsd.Config)
+	tcs := []struct {
+		name  string
+		input *bytes.Buffer
+	}{
+		{
+			name: "timeout",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                address: :8125
+                timeout: abc
+                interval: 1s
+    `)),
+		},
+		{
+			name: "bad protocol",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                address: :8125
+                protocol: http
+                interval: 1s
+    `)),
+		},
+		{
+			name: "no address",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                protocol: tcp
+                interval: 1s
+    `)),
+		},
+		{
+			name: "bad interval",
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+                type_name: example_type
+                address: :8125
+                timeout: 1s
+                interval: def
+    `)),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v.ReadConfig(tc.input)
+			err := statsd.WithViper(v, "reader1", "readers.reader1")(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+
+	err := statsd.WithViper(&badMarshaller{}, "reader1", "readers.reader1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := statsd.NewConfig(
+		statsd.WithLogger(log),
+	)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	if c.Mapper() != datatype.DefaultMapper() {
+		t.Errorf("c.Mapper() = (%v); want (%v)", c.Mapper(), datatype.DefaultMapper())
+	}
+}
+
+func TestNewConfigErrors(t *testing.T) {
+	c, err := statsd.NewConfig(
+		statsd.WithLogger(nil),
+	)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestWithMapFile(t *testing.T) {
+	c := new(statsd.Config)
+	err := statsd.WithMapFile("")(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	cwd, _ := os.Getwd()
+	file, err := ioutil.TempFile(cwd, "yaml")
+	if err != nil {
+		panic(err)
+	}
+	oldName := file.Name() //required for viper
+	newName := file.Name() + ".yml"
+	os.Rename(oldName, newName)
+	defer os.Remove(newName)
+
+	err = statsd.WithMapFile(path.Base(file.Name()))(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	err = statsd.WithMapFile("this file does not exist")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestConfigReader(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := statsd.NewConfig(
+		statsd.WithLogger(log),
+	)
+	c.StatsdName = "name"
+	c.StatsdTypeName = "name"
+	c.StatsdAddress = "localhost"
+	c.ConfInterval = time.Second
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := c.Reader()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if e.(*statsd.Reader) != nil {
+		t.Errorf("e = (%v); want (nil)", e)
+	}
+	c.StatsdAddress = ":8125"
+	e, err = c.Reader()
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if e.(*statsd.Reader) == nil {
+		t.Error("e.(*statsd.Reader) = (nil); want (Reader)")
+	}
+	c.StatsdProtocol = "tcp"
+	c.ConfTimeout = time.Second
+	e, err = c.Reader()
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if e.Timeout() != time.Second {
+		t.Errorf("e.Timeout() = (%v); want (1s)", e.Timeout())
+	}
+	if e.(*statsd.Reader).Protocol() != statsd.TCP {
+		t.Errorf("Protocol() = (%s); want (tcp)", e.(*statsd.Reader).Protocol())
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/pkg/errors"
+)
+
+// InvalidProtocolError is returned when the protocol is neither udp nor tcp.
+type InvalidProtocolError string
+
+func (i InvalidProtocolError) Error() string {
+	return fmt.Sprintf("invalid protocol: %s", string(i))
+}
+
+// WithAddress sets the address the reader listens on, e.g. ":8125". Unlike
+// reader.WithEndpoint, it does not expect a URL.
+func WithAddress(address string) func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		if address == "" {
+			return reader.ErrEmptyEndpoint
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return reader.InvalidEndpointError(address)
+		}
+		e.SetEndpoint(address)
+		return nil
+	}
+}
+
+// WithProtocol sets the protocol of the listener. It should be either udp or
+// tcp.
+func WithProtocol(protocol string) func(reader.Constructor) error {
+	return func(e reader.Constructor) error {
+		r, ok := e.(*Reader)
+		if !ok {
+			return errors.New("incompatible reader")
+		}
+		switch protocol {
+		case UDP, TCP:
+			r.protocol = protocol
+			return nil
+		}
+		return InvalidProtocolError(protocol)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the StatsD line protocol.
+const (
+	counterType   = "c"
+	gaugeType     = "g"
+	timerType     = "ms"
+	histogramType = "h"
+	setType       = "s"
+)
+
+// metric is a single metric received in the line protocol.
+type metric struct {
+	name  string
+	kind  string
+	value float64
+	raw   string // the value as received, used for sets.
+	rate  float64
+	delta bool // the gauge value has a sign and should be added.
+}
+
+// parseLine parses a line in form of:
+//    name:value|type[|@sample_rate][|#tags]
+// Multiple values can be sent for the same name in one line:
+//    name:value1|type:value2|type
+// The tags are ignored.
+func parseLine(line string) ([]metric, error) {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return nil, fmt.Errorf("no name in %q", line)
+	}
+	name, values := line[:i], line[i+1:]
+	if j := strings.Index(values, "|#"); j >= 0 {
+		values = values[:j]
+	}
+	var metrics []metric
+	for _, part := range strings.Split(values, ":") {
+		m, err := parseValue(name, part)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+func parseValue(name, part string) (metric, error) {
+	m := metric{name: name, rate: 1}
+	fields := strings.Split(part, "|")
+	if len(fields) < 2 {
+		return m, fmt.Errorf("no type for %q", name)
+	}
+	m.raw, m.kind = fields[0], fields[1]
+	switch m.kind {
+	case counterType, gaugeType, timerType, histogramType, setType:
+	default:
+		return m, fmt.Errorf("unknown type %q for %q", m.kind, name)
+	}
+	if m.raw == "" {
+		return m, fmt.Errorf("no value for %q", name)
+	}
+	if m.kind != setType {
+		v, err := strconv.ParseFloat(m.raw, 64)
+		// the gauges are kept between the reads, and the non-finite values
+		// cannot be encoded.
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return m, fmt.Errorf("invalid value %q for %q", m.raw, name)
+		}
+		m.value = v
+		m.delta = m.kind == gaugeType && (m.raw[0] == '+' || m.raw[0] == '-')
+	}
+	for _, f := range fields[2:] {
+		if !strings.HasPrefix(f, "@") {
+			continue
+		}
+		rate, err := strconv.ParseFloat(f[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return m, fmt.Errorf("invalid sample rate %q for %q", f, name)
+		}
+		m.rate = rate
+	}
+	return m, nil
+}
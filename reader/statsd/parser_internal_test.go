@@ -0,0 +1,86 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd
+
+import "testing"
+
+func TestParseLine(t *testing.T) {
+	tcs := []struct {
+		line string
+		want []metric
+	}{
+		{"hits:1|c", []metric{{name: "hits", kind: counterType, value: 1, raw: "1", rate: 1}}},
+		{"hits:2|c|@0.5", []metric{{name: "hits", kind: counterType, value: 2, raw: "2", rate: 0.5}}},
+		{"queue:-3|g", []metric{{name: "queue", kind: gaugeType, value: -3, raw: "-3", rate: 1, delta: true}}},
+		{"db.query:12.5|ms|#env:prod", []metric{{name: "db.query", kind: timerType, value: 12.5, raw: "12.5", rate: 1}}},
+		{"users:bob|s", []metric{{name: "users", kind: setType, raw: "bob", rate: 1}}},
+		{"size:1|h:2|h", []metric{
+			{name: "size", kind: histogramType, value: 1, raw: "1", rate: 1},
+			{name: "size", kind: histogramType, value: 2, raw: "2", rate: 1},
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.line, func(t *testing.T) {
+			got, err := parseLine(tc.line)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("len(got) = (%d); want (%d)", len(got), len(tc.want))
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("got[%d] = (%v); want (%v)", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"hits", ":1|c", "hits:1", "hits:1|x", "hits:|c", "hits:a|c", "hits:1|c|@2", "hits:1|c|@a",
+		"queue:NaN|g", "hits:Inf|c", "db:-inf|ms",
+	} {
+		t.Run(line, func(t *testing.T) {
+			if _, err := parseLine(line); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	a := newAggregate(map[string]float64{"queue": 10})
+	for _, line := range []string{
+		"hits:1|c", "hits:2|c|@0.5", "queue:-3|g", "queue:+1|g", "temp:20|g",
+		"db:10|ms", "db:30|ms", "db:20|ms|@0.5", "users:bob|s", "users:alice|s", "users:bob|s",
+	} {
+		metrics, err := parseLine(line)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		for _, m := range metrics {
+			a.add(m)
+		}
+	}
+	res := a.result()
+	counters := res["counters"].(map[string]float64)
+	if counters["hits"] != 5 {
+		t.Errorf(`counters["hits"] = (%v); want (5)`, counters["hits"])
+	}
+	gauges := res["gauges"].(map[string]float64)
+	if gauges["queue"] != 8 || gauges["temp"] != 20 {
+		t.Errorf("gauges = (%v); want (map[queue:8 temp:20])", gauges)
+	}
+	db := res["timers"].(map[string]timer)["db"]
+	want := timer{Count: 4, Sum: 60, Min: 10, Max: 30, Mean: 20, P50: 20, P90: 30, P99: 30}
+	if db != want {
+		t.Errorf(`timers["db"] = (%v); want (%v)`, db, want)
+	}
+	if sets := res["sets"].(map[string]int); sets["users"] != 2 {
+		t.Errorf(`sets["users"] = (%v); want (2)`, sets["users"])
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package statsd contains logic to receive metrics pushed by applications in
+// the StatsD line protocol, over UDP or TCP. Counters, gauges, timers,
+// histograms and sets with sample rates are supported. The metrics are
+// aggregated between the engine's calls to Read, therefore each result covers
+// one Interval. The result is grouped by the metric types:
+//
+//    {
+//        "counters": {"requests": 42},
+//        "gauges":   {"queue.size": 3},
+//        "timers":   {"db.query": {"count": 2, "sum": 30, "min": 10, "max": 20, "mean": 15, "p50": 10, "p90": 20, "p99": 20}},
+//        "sets":     {"users": 5},
+//        "bad_lines": 0
+//    }
+//
+// Ping binds the listener, and reports whether it is bound on later calls.
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// Supported protocols.
+const (
+	UDP = "udp"
+	TCP = "tcp"
+)
+
+// maxPacketSize is the largest UDP packet the reader accepts.
+const maxPacketSize = 65535
+
+// Reader listens on an address for the metrics pushed in StatsD line protocol.
+// It implements DataReader interface.
+type Reader struct {
+	name     string
+	endpoint string
+	protocol string
+	log      tools.FieldLogger
+	mapper   datatype.Mapper
+	typeName string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	agg      *aggregate
+	conn     net.PacketConn
+	listener net.Listener
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New generates the Reader based on the provided options. The endpoint is the
+// address the reader listens on, and should be set with the WithAddress option.
+// The protocol defaults to UDP.
+func New(options ...func(reader.Constructor) error) (*Reader, error) {
+	r := &Reader{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+
+	if r.name == "" {
+		return nil, reader.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, reader.ErrEmptyEndpoint
+	}
+	if r.protocol == "" {
+		r.protocol = UDP
+	}
+	if r.mapper == nil {
+		r.mapper = datatype.DefaultMapper()
+	}
+	if r.typeName == "" {
+		r.typeName = r.name
+	}
+	if r.interval == 0 {
+		r.interval = time.Second
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "statsd")
+	r.agg = newAggregate(nil)
+	return r, nil
+}
+
+// Ping binds the listener if it is not bound yet. It returns an
+// EndpointNotAvailableError if the address cannot be bound.
+func (r *Reader) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil || r.listener != nil {
+		return nil
+	}
+	var err error
+	r.quit = make(chan struct{})
+	switch r.protocol {
+	case TCP:
+		r.listener, err = net.Listen(TCP, r.endpoint)
+		if err == nil {
+			r.wg.Add(1)
+			go r.acceptTCP(r.listener, r.quit)
+		}
+	default:
+		r.conn, err = net.ListenPacket(UDP, r.endpoint)
+		if err == nil {
+			r.wg.Add(1)
+			go r.serveUDP(r.conn, r.quit)
+		}
+	}
+	if err != nil {
+		return reader.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	return nil
+}
+
+// Read returns the metrics aggregated since the last call.
+func (r *Reader) Read(job *token.Context) (*reader.Result, error) {
+	r.mu.Lock()
+	if r.conn == nil && r.listener == nil {
+		r.mu.Unlock()
+		return nil, reader.ErrPingNotCalled
+	}
+	agg := r.agg
+	gauges := make(map[string]float64, len(agg.gauges))
+	for k, v := range agg.gauges {
+		gauges[k] = v
+	}
+	r.agg = newAggregate(gauges)
+	r.mu.Unlock()
+
+	content, err := json.Marshal(agg.result())
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding metrics")
+	}
+	res := &reader.Result{
+		ID:       job.ID(),
+		Time:     time.Now(), // It is sensible to record the time now
+		Content:  content,
+		TypeName: r.TypeName(),
+		Mapper:   r.Mapper(),
+	}
+	return res, nil
+}
+
+// Addr returns the address the reader is bound to, or nil if it is not bound.
+func (r *Reader) Addr() net.Addr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.conn != nil:
+		return r.conn.LocalAddr()
+	case r.listener != nil:
+		return r.listener.Addr()
+	}
+	return nil
+}
+
+// Close stops the listener and waits for the connections to be closed.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+	if r.conn != nil {
+		err = r.conn.Close()
+		r.conn = nil
+	}
+	if r.listener != nil {
+		err = r.listener.Close()
+		r.listener = nil
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func (r *Reader) serveUDP(conn net.PacketConn, quit chan struct{}) {
+	defer r.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if closing(quit) {
+				return
+			}
+			r.log.Warnf("%s: error reading packet: %v", r.name, err)
+			continue
+		}
+		r.handle(bytes.Split(buf[:n], []byte{'\n'}))
+	}
+}
+
+func (r *Reader) acceptTCP(l net.Listener, quit chan struct{}) {
+	defer r.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if closing(quit) {
+				return
+			}
+			r.log.Warnf("%s: error accepting connection: %v", r.name, err)
+			continue
+		}
+		r.wg.Add(1)
+		go r.serveTCP(conn, quit)
+	}
+}
+
+func (r *Reader) serveTCP(conn net.Conn, quit chan struct{}) {
+	defer r.wg.Done()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-quit:
+		case <-done:
+		}
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		r.handle([][]byte{scanner.Bytes()})
+	}
+}
+
+func (r *Reader) handle(lines [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range lines {
+		l := strings.TrimSpace(string(line))
+		if l == "" {
+			continue
+		}
+		metrics, err := parseLine(l)
+		if err != nil {
+			r.agg.badLines++
+			r.log.Debugf("%s: %v", r.name, err)
+			continue
+		}
+		for _, m := range metrics {
+			r.agg.add(m)
+		}
+	}
+}
+
+func closing(quit chan struct{}) bool {
+	select {
+	case <-quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Name shows the name identifier for this reader.
+func (r *Reader) Name() string { return r.name }
+
+// SetName sets the name of the reader.
+func (r *Reader) SetName(name string) { r.name = name }
+
+// Endpoint returns the address the reader listens on.
+func (r *Reader) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the address the reader listens on.
+func (r *Reader) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// Protocol returns the protocol the reader listens on.
+func (r *Reader) Protocol() string { return r.protocol }
+
+// TypeName shows the typeName the recorder should record as.
+func (r *Reader) TypeName() string { return r.typeName }
+
+// SetTypeName sets the type name of the reader.
+func (r *Reader) SetTypeName(typeName string) { r.typeName = typeName }
+
+// Mapper returns the mapper object.
+func (r *Reader) Mapper() datatype.Mapper { return r.mapper }
+
+// SetMapper sets the mapper of the reader.
+func (r *Reader) SetMapper(mapper datatype.Mapper) { r.mapper = mapper }
+
+// Interval returns the interval.
+func (r *Reader) Interval() time.Duration { return r.interval }
+
+// SetInterval sets the interval of the reader.
+func (r *Reader) SetInterval(interval time.Duration) { r.interval = interval }
+
+// Timeout returns the time-out.
+func (r *Reader) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the reader.
+func (r *Reader) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the reader.
+func (r *Reader) SetLogger(log tools.FieldLogger) { r.log = log }
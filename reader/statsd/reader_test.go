@@ -0,0 +1,216 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package statsd_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/reader/statsd"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func newReader(t *testing.T, protocol string) *statsd.Reader {
+	red, err := statsd.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("app"),
+		statsd.WithAddress("127.0.0.1:0"),
+		statsd.WithProtocol(protocol),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return red
+}
+
+type result struct {
+	Counters map[string]float64
+	Gauges   map[string]float64
+	Sets     map[string]int
+	Timers   map[string]map[string]float64
+	BadLines int `json:"bad_lines"`
+}
+
+// readUntil reads from the reader until the counter reaches the value, because
+// the packets are received asynchronously.
+func readUntil(t *testing.T, red *statsd.Reader, counter string, value float64) result {
+	var total result
+	total.Counters = make(map[string]float64)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		res, err := red.Read(token.New(context.Background()))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if _, err = datatype.JobResultDataTypes(res.Content, red.Mapper()); err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+		}
+		var r result
+		if err = json.Unmarshal(res.Content, &r); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		for k, v := range r.Counters {
+			total.Counters[k] += v
+		}
+		total.Gauges, total.BadLines = r.Gauges, total.BadLines+r.BadLines
+		if r.Sets != nil && len(r.Sets) > 0 {
+			total.Sets = r.Sets
+		}
+		if r.Timers != nil && len(r.Timers) > 0 {
+			total.Timers = r.Timers
+		}
+		if total.Counters[counter] >= value {
+			return total
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s to reach %v: %v", counter, value, total)
+	return total
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(reader.Constructor) error
+	}{
+		{"no name", []func(reader.Constructor) error{statsd.WithAddress(":8125")}},
+		{"no address", []func(reader.Constructor) error{reader.WithName("a")}},
+		{"empty address", []func(reader.Constructor) error{statsd.WithAddress("")}},
+		{"bad address", []func(reader.Constructor) error{statsd.WithAddress("localhost")}},
+		{"bad protocol", []func(reader.Constructor) error{statsd.WithProtocol("http")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			red, err := statsd.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if red != nil {
+				t.Errorf("red = (%v); want (nil)", red)
+			}
+		})
+	}
+	red, err := statsd.New(reader.WithName("a"), statsd.WithAddress(":8125"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if red.Protocol() != statsd.UDP {
+		t.Errorf("red.Protocol() = (%s); want (%s)", red.Protocol(), statsd.UDP)
+	}
+}
+
+func TestPing(t *testing.T) {
+	red, err := statsd.New(
+		reader.WithLogger(tools.DiscardLogger()),
+		reader.WithName("app"),
+		statsd.WithAddress("127.0.0.1:0"),
+		statsd.WithProtocol(statsd.TCP),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = red.Read(token.New(context.Background())); err != reader.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, reader.ErrPingNotCalled)
+	}
+	if red.Addr() != nil {
+		t.Errorf("red.Addr() = (%v); want (nil)", red.Addr())
+	}
+	if err = red.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer red.Close()
+	if err = red.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil): already bound", err)
+	}
+
+	other, err := statsd.New(
+		reader.WithName("app"),
+		statsd.WithAddress(red.Addr().String()),
+		statsd.WithProtocol(statsd.TCP),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = other.Ping()
+	if _, ok := errors.Cause(err).(reader.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%T); want (reader.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestReadUDP(t *testing.T) {
+	red := newReader(t, statsd.UDP)
+	defer red.Close()
+	conn, err := net.Dial("udp", red.Addr().String())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "queue:5|g\nusers:bob|s\nusers:alice|s\ngarbage\ndb:10|ms\ndb:20|ms\n")
+	fmt.Fprint(conn, "hits:1|c\nhits:1|c|@0.5\nqueue:NaN|g\n")
+
+	res := readUntil(t, red, "hits", 3)
+	if res.BadLines != 2 {
+		t.Errorf("res.BadLines = (%d); want (2)", res.BadLines)
+	}
+	if res.Gauges["queue"] != 5 {
+		t.Errorf(`res.Gauges["queue"] = (%v); want (5)`, res.Gauges["queue"])
+	}
+	if res.Sets["users"] != 2 {
+		t.Errorf(`res.Sets["users"] = (%v); want (2)`, res.Sets["users"])
+	}
+	if res.Timers["db"]["mean"] != 15 {
+		t.Errorf(`res.Timers["db"]["mean"] = (%v); want (15)`, res.Timers["db"]["mean"])
+	}
+
+	fmt.Fprint(conn, "hits:2|c\n")
+	res = readUntil(t, red, "hits", 2)
+	if res.Counters["hits"] != 2 {
+		t.Errorf(`res.Counters["hits"] = (%v); want (2): counters should be reset`, res.Counters["hits"])
+	}
+	if res.Gauges["queue"] != 5 {
+		t.Errorf(`res.Gauges["queue"] = (%v); want (5): gauges should be kept`, res.Gauges["queue"])
+	}
+}
+
+func TestReadTCP(t *testing.T) {
+	red := newReader(t, statsd.TCP)
+	conn, err := net.Dial("tcp", red.Addr().String())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "queue:5|g\nhits:1|c\n")
+	fmt.Fprint(conn, "hits:3|c\n")
+	res := readUntil(t, red, "hits", 4)
+	if res.Gauges["queue"] != 5 {
+		t.Errorf(`res.Gauges["queue"] = (%v); want (5)`, res.Gauges["queue"])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		red.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Close() did not return with open connections")
+	}
+	if err = red.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil): should bind again", err)
+	}
+	red.Close()
+}
@@ -24,6 +24,15 @@ type Constructor interface {
 	Object() (reader.DataReader, error)
 }
 
+// Payloader can be implemented by a Constructor when its reader does not
+// consume JSON objects from the endpoint. ValidPayload should return a payload
+// the reader accepts, and InvalidPayload should return a payload that causes
+// the reader to return reader.ErrInvalidJSON.
+type Payloader interface {
+	ValidPayload() []byte
+	InvalidPayload() []byte
+}
+
 // TestSuites returns a map of test name to the runner function.
 func TestSuites(t *testing.T, setup func() (Constructor, func())) {
 	t.Parallel()
@@ -85,9 +85,13 @@ func readerReturnsSameID(t testing.TB, cons Constructor) {
 }
 
 func jasonMarshallableCheck(t testing.TB, cons Constructor) {
-	var payload string
+	var payload []byte
+	invalid, valid := []byte(`{"bb":1`), []byte(`{"bb":1}`)
+	if p, ok := cons.(Payloader); ok {
+		invalid, valid = p.InvalidPayload(), p.ValidPayload()
+	}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(payload))
+		w.Write(payload)
 	}))
 	defer ts.Close()
 
@@ -107,7 +111,7 @@ func jasonMarshallableCheck(t testing.TB, cons Constructor) {
 		t.Fatalf("err = (%#v); want (nil)", err)
 	}
 
-	payload = `{"bb":1`
+	payload = invalid
 	result, err := red.Read(job)
 	if errors.Cause(err) != reader.ErrInvalidJSON {
 		t.Errorf("err = (%#v); want (reader.ErrInvalidJSON)", err)
@@ -116,7 +120,7 @@ func jasonMarshallableCheck(t testing.TB, cons Constructor) {
 		t.Errorf("result = (%v); want (nil)", string(result.Content))
 	}
 
-	payload = `{"bb":1}`
+	payload = valid
 	result, err = red.Read(job)
 	if err != nil {
 		t.Errorf("err = (%#v); want (nil)", err)
@@ -0,0 +1,93 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// security holds the authentication and TLS settings of the connection.
+type security struct {
+	username string
+	password string
+	apiKey   string
+	caFile   string
+	certFile string
+	keyFile  string
+	insecure bool
+}
+
+// apiKeyTransport adds the API key to all requests.
+type apiKeyTransport struct {
+	apiKey string
+	next   http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers should not modify the request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "ApiKey "+t.apiKey)
+	return t.next.RoundTrip(r)
+}
+
+// httpClient returns an http client that applies the TLS settings and the API
+// key. It returns nil if the default client is sufficient.
+func (s *security) httpClient() (*http.Client, error) {
+	if s.apiKey == "" && s.caFile == "" && s.certFile == "" && !s.insecure {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.insecure}
+	if s.caFile != "" {
+		pem, err := ioutil.ReadFile(s.caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading ca file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates in ca file: %s", s.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if s.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	if s.apiKey != "" {
+		transport = &apiKeyTransport{apiKey: s.apiKey, next: transport}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// readSecret returns the content of the file without the leading and trailing
+// white spaces. It is used for loading passwords and keys from files.
+func readSecret(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrap(err, "reading secret")
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", errors.Errorf("empty secret file: %s", file)
+	}
+	return secret, nil
+}
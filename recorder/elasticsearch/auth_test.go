@@ -0,0 +1,242 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/elasticsearch"
+)
+
+// newSecureServer returns a TLS server that only responds to the requests
+// that pass the check.
+func newSecureServer(check func(*http.Request) bool) *httptest.Server {
+	return newSecureServerWithAuth(check, tls.NoClientCert)
+}
+
+func newSecureServerWithAuth(check func(*http.Request) bool, clientAuth tls.ClientAuthType) *httptest.Server {
+	var host, url, port string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !check(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		default:
+			w.Write([]byte(recording))
+		}
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // silences the handshake errors
+	ts.TLS = &tls.Config{ClientAuth: clientAuth}
+	ts.StartTLS()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return ts
+}
+
+func writeTemp(t *testing.T, dir, name string, data []byte) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return file
+}
+
+// serverCA writes the certificate of the server in a PEM file.
+func serverCA(t *testing.T, dir string, ts *httptest.Server) string {
+	cert := ts.TLS.Certificates[0].Certificate[0]
+	return writeTemp(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}))
+}
+
+// clientCert creates a self signed certificate and its key.
+func clientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "expipe"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	certFile := writeTemp(t, dir, "cert.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeTemp(t, dir, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+	return certFile, keyFile
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "elasticsearch")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func pingSecure(ts *httptest.Server, options ...func(recorder.Constructor) error) error {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithTimeout(time.Second),
+	}, options...)
+	rec, err := elasticsearch.New(options...)
+	if err != nil {
+		return err
+	}
+	return rec.Ping()
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ts := newSecureServer(func(*http.Request) bool { return true })
+	defer ts.Close()
+
+	if err := pingSecure(ts); err == nil {
+		t.Error("unknown authority: err = (nil); want (error)")
+	}
+	if err := pingSecure(ts, elasticsearch.WithCACert(serverCA(t, dir, ts))); err != nil {
+		t.Errorf("ca file: err = (%v); want (nil)", err)
+	}
+	if err := pingSecure(ts, elasticsearch.WithInsecureSkipVerify()); err != nil {
+		t.Errorf("insecure: err = (%v); want (nil)", err)
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	t.Parallel()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ts := newSecureServerWithAuth(func(r *http.Request) bool {
+		return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+	}, tls.RequestClientCert)
+	defer ts.Close()
+	ca := serverCA(t, dir, ts)
+
+	if err := pingSecure(ts, elasticsearch.WithCACert(ca)); err == nil {
+		t.Error("no client cert: err = (nil); want (error)")
+	}
+	certFile, keyFile := clientCert(t, dir)
+	err := pingSecure(ts,
+		elasticsearch.WithCACert(ca),
+		elasticsearch.WithClientCert(certFile, keyFile),
+	)
+	if err != nil {
+		t.Errorf("client cert: err = (%v); want (nil)", err)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	t.Parallel()
+	ts := newSecureServer(func(r *http.Request) bool {
+		username, password, ok := r.BasicAuth()
+		return ok && username == "elastic" && password == "changeme"
+	})
+	defer ts.Close()
+
+	if err := pingSecure(ts, elasticsearch.WithInsecureSkipVerify()); err == nil {
+		t.Error("no auth: err = (nil); want (error)")
+	}
+	err := pingSecure(ts,
+		elasticsearch.WithInsecureSkipVerify(),
+		elasticsearch.WithBasicAuth("elastic", "wrong"),
+	)
+	if err == nil {
+		t.Error("wrong password: err = (nil); want (error)")
+	}
+	err = pingSecure(ts,
+		elasticsearch.WithInsecureSkipVerify(),
+		elasticsearch.WithBasicAuth("elastic", "changeme"),
+	)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Parallel()
+	ts := newSecureServer(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "ApiKey c2VjcmV0"
+	})
+	defer ts.Close()
+
+	if err := pingSecure(ts, elasticsearch.WithInsecureSkipVerify()); err == nil {
+		t.Error("no auth: err = (nil); want (error)")
+	}
+	err := pingSecure(ts,
+		elasticsearch.WithInsecureSkipVerify(),
+		elasticsearch.WithAPIKey("c2VjcmV0"),
+	)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestSecurityErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	notPEM := writeTemp(t, dir, "not.pem", []byte("not a certificate"))
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"empty username", []func(recorder.Constructor) error{elasticsearch.WithBasicAuth("", "pass")}},
+		{"empty api key", []func(recorder.Constructor) error{elasticsearch.WithAPIKey("")}},
+		{"basic auth and api key", []func(recorder.Constructor) error{
+			elasticsearch.WithBasicAuth("user", "pass"),
+			elasticsearch.WithAPIKey("key"),
+		}},
+		{"empty ca file", []func(recorder.Constructor) error{elasticsearch.WithCACert("")}},
+		{"missing ca file", []func(recorder.Constructor) error{elasticsearch.WithCACert(filepath.Join(dir, "nothing"))}},
+		{"bad ca file", []func(recorder.Constructor) error{elasticsearch.WithCACert(notPEM)}},
+		{"no key file", []func(recorder.Constructor) error{elasticsearch.WithClientCert(notPEM, "")}},
+		{"bad cert", []func(recorder.Constructor) error{elasticsearch.WithClientCert(notPEM, notPEM)}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]func(recorder.Constructor) error{
+				recorder.WithEndpoint("https://127.0.0.1:9200"),
+				recorder.WithName("name"),
+			}, tc.options...)
+			if _, err := elasticsearch.New(options...); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/tools/token"
+	"github.com/olivere/elastic"
+)
+
+// BulkItemError is returned when elasticsearch rejects a document in a bulk
+// request. The ID is the ID of the job the document belongs to.
+type BulkItemError struct {
+	ID     token.ID
+	Status int
+	Type   string
+	Reason string
+}
+
+func (e BulkItemError) Error() string {
+	return fmt.Sprintf("document %s rejected (%d): %s: %s", e.ID, e.Status, e.Type, e.Reason)
+}
+
+// bulkItem is a document waiting in the buffer.
+type bulkItem struct {
+	id       token.ID
+	index    string
+	typeName string
+	payload  []byte
+}
+
+// bulker buffers the documents and hands them to the flush function in
+// batches. The flush function is set by the Recorder. When a batch cannot be
+// shipped, its items are kept in the buffer for the next flush.
+type bulker struct {
+	actions  int
+	size     int64
+	interval time.Duration
+	flush    func([]*bulkItem) error
+
+	mu    sync.Mutex
+	items []*bulkItem
+	bytes int64
+	timer *time.Timer
+	err   error // the error of a timed flush, not reported yet
+}
+
+// add buffers the item and flushes the buffer if it has reached any of the
+// limits. The first item of a batch starts a timer to flush the batch after
+// the interval. If a timed flush has failed since the last call, its error is
+// returned and the item is not buffered. If the flush fails, the item is taken
+// out of the buffer as the error is returned to its owner.
+func (b *bulker) add(item *bulkItem) error {
+	b.mu.Lock()
+	if err := b.err; err != nil {
+		b.err = nil
+		b.mu.Unlock()
+		return err
+	}
+	b.items = append(b.items, item)
+	b.bytes += int64(len(item.payload))
+	if len(b.items) < b.actions && b.bytes < b.size {
+		b.startTimer()
+		b.mu.Unlock()
+		return nil
+	}
+	items := b.take()
+	b.mu.Unlock()
+	return b.ship(items, item)
+}
+
+// flushNow ships whatever is in the buffer.
+func (b *bulker) flushNow() error {
+	b.mu.Lock()
+	items := b.take()
+	b.mu.Unlock()
+	if len(items) == 0 {
+		return nil
+	}
+	return b.ship(items, nil)
+}
+
+// flushLater ships the buffer when the interval has passed. Its error is
+// reported by the next add.
+func (b *bulker) flushLater() {
+	if err := b.flushNow(); err != nil {
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+}
+
+// ship flushes the items. If it fails, the items other than the owned one are
+// put back in front of the buffer.
+func (b *bulker) ship(items []*bulkItem, owned *bulkItem) error {
+	err := b.flush(items)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.err = nil
+		return nil
+	}
+	kept := make([]*bulkItem, 0, len(items)+len(b.items))
+	for _, item := range items {
+		if item != owned {
+			kept = append(kept, item)
+			b.bytes += int64(len(item.payload))
+		}
+	}
+	b.items = append(kept, b.items...)
+	if len(b.items) > 0 {
+		b.startTimer()
+	}
+	return err
+}
+
+// startTimer starts the timer of the batch if it is not running. The lock
+// should be held.
+func (b *bulker) startTimer() {
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flushLater)
+	}
+}
+
+// take empties the buffer and returns its items. The lock should be held.
+func (b *bulker) take() []*bulkItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.items
+	b.items, b.bytes = nil, 0
+	return items
+}
+
+// shipBulk sends the items in one _bulk request. It returns an error if the
+// request fails. The documents rejected by elasticsearch are logged as a
+// BulkItemError, as sending them again would not help. The request is not
+// tied to any of the jobs' contexts, therefore a cancelled job does not fail
+// the others.
+func (r *Recorder) shipBulk(items []*bulkItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	client, _ := r.connection()
+	bulk := client.Bulk()
+	for _, item := range items {
+		req := elastic.NewBulkIndexRequest().
+			Index(item.index).
+			Id(item.id.String()).
+			Doc(json.RawMessage(item.payload))
+		if item.typeName != "" {
+			req.Type(item.typeName)
+		}
+		bulk.Add(req)
+	}
+	elasticsearchBulkRequests.Add(1)
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		r.log.Debugf("%s: error shipping %d documents: %v", r.name, len(items), err)
+		return err
+	}
+
+	failed := make(map[string]*elastic.BulkResponseItem)
+	for _, m := range res.Items {
+		for _, result := range m {
+			if result.Error != nil || result.Status >= 300 {
+				failed[result.Id] = result
+			}
+		}
+	}
+	for _, item := range items {
+		result, ok := failed[item.id.String()]
+		if !ok {
+			elasticsearchRecords.Add(1)
+			continue
+		}
+		elasticsearchFailedRecords.Add(1)
+		e := BulkItemError{ID: item.id, Status: result.Status}
+		if result.Error != nil {
+			e.Type, e.Reason = result.Error.Type, result.Error.Reason
+		}
+		r.log.Warnf("%s: %v", r.name, e)
+	}
+	return nil
+}
+
+// Flush ships the buffered documents immediately. It is a no-op if the
+// recorder is not in the bulk mode.
+func (r *Recorder) Flush() error {
+	if r.bulk == nil {
+		return nil
+	}
+	r.mu.Lock()
+	pinged := r.pinged
+	r.mu.Unlock()
+	if !pinged {
+		return nil
+	}
+	return r.bulk.flushNow()
+}
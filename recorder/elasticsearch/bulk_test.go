@@ -0,0 +1,354 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/elasticsearch"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// bulkServer is an elasticsearch server that accepts _bulk requests. It
+// rejects the documents that have a "reject" key.
+type bulkServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests int
+	docs     []string
+	down     bool // responds to the _bulk requests with errors
+}
+
+func (b *bulkServer) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *bulkServer) indexed() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.docs...)
+}
+
+func (b *bulkServer) stats() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests, len(b.docs)
+}
+
+func newBulkServer() *bulkServer {
+	var host, url, port string
+	b := &bulkServer{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/_bulk":
+			b.handleBulk(w, r)
+		case len(r.URL.Path) > 5:
+			w.Write([]byte(recording))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		}
+	})
+	b.Server = httptest.NewServer(handler)
+	url = strings.Split(b.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return b
+}
+
+func (b *bulkServer) handleBulk(w http.ResponseWriter, r *http.Request) {
+	type meta struct {
+		Index struct {
+			ID string `json:"_id"`
+		} `json:"index"`
+	}
+	var items []map[string]interface{}
+	hasErrors := false
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	b.mu.Lock()
+	b.requests++
+	if b.down {
+		b.mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	for scanner.Scan() {
+		m := meta{}
+		json.Unmarshal(scanner.Bytes(), &m)
+		if !scanner.Scan() {
+			break
+		}
+		doc := scanner.Text()
+		b.docs = append(b.docs, doc)
+		item := map[string]interface{}{"_id": m.Index.ID, "status": 201}
+		if strings.Contains(doc, `"reject"`) {
+			hasErrors = true
+			item["status"] = 400
+			item["error"] = map[string]string{"type": "mapper_parsing_exception", "reason": "failed to parse"}
+		}
+		items = append(items, map[string]interface{}{"index": item})
+	}
+	b.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": hasErrors, "items": items})
+}
+
+func newBulkRecorder(t *testing.T, url string, actions int, interval time.Duration) *elasticsearch.Recorder {
+	rec, err := elasticsearch.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithEndpoint(url),
+		recorder.WithName("name"),
+		recorder.WithIndexName("my_index"),
+		recorder.WithTimeout(time.Second),
+		elasticsearch.WithBulk(actions, 0, interval),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func bulkJob(key string) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType(key, 1)}),
+		TypeName: "my_type",
+		Time:     time.Now(),
+	}
+}
+
+func TestWithBulkErrors(t *testing.T) {
+	tcs := []struct {
+		name     string
+		actions  int
+		size     int64
+		interval time.Duration
+	}{
+		{"negative actions", -1, 0, 0},
+		{"negative size", 0, -1, 0},
+		{"negative interval", 0, 0, -1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := elasticsearch.New(
+				recorder.WithEndpoint("http://127.0.0.1:9200"),
+				recorder.WithName("name"),
+				elasticsearch.WithBulk(tc.actions, tc.size, tc.interval),
+			)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+// One caller should be able to fill the batches, as the engines record one
+// job at a time.
+func TestBulkByActions(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 5, time.Hour)
+
+	for i := 0; i < 10; i++ {
+		if err := rec.Record(context.Background(), bulkJob("key")); err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+		}
+	}
+	requests, docs := ts.stats()
+	if requests != 2 {
+		t.Errorf("requests = (%d); want (2)", requests)
+	}
+	if docs != 10 {
+		t.Errorf("docs = (%d); want (10)", docs)
+	}
+}
+
+func TestBulkBySize(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithTimeout(time.Second),
+		elasticsearch.WithBulk(100, 1, time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if requests, _ := ts.stats(); requests != 1 {
+		t.Errorf("requests = (%d); want (1)", requests)
+	}
+}
+
+func TestBulkByInterval(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 100, 10*time.Millisecond)
+
+	if err := rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	deadline := time.After(time.Second)
+	for {
+		if _, docs := ts.stats(); docs == 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("the buffer was not flushed after the interval")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestBulkItemError(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 2, time.Hour)
+
+	// The rejected documents are not retried, and their errors are only
+	// logged as the callers have moved on.
+	for _, job := range []recorder.Job{bulkJob("key"), bulkJob("reject")} {
+		if err := rec.Record(context.Background(), job); err != nil {
+			t.Errorf("err = (%v); want (nil)", err)
+		}
+	}
+	if err := rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err := rec.Flush(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if requests, docs := ts.stats(); requests != 2 || docs != 3 {
+		t.Errorf("requests, docs = (%d, %d); want (2, 3)", requests, docs)
+	}
+}
+
+func TestBulkFlush(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 100, time.Hour)
+
+	if err := rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if _, docs := ts.stats(); docs != 0 {
+		t.Fatalf("docs = (%d); want (0)", docs)
+	}
+	if err := rec.Flush(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if _, docs := ts.stats(); docs != 1 {
+		t.Errorf("docs = (%d); want (1)", docs)
+	}
+}
+
+// The documents of a failed batch should be shipped with the next one, except
+// the one of the caller that receives the error.
+func TestBulkRetry(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 2, time.Hour)
+
+	ts.setDown(true)
+	if err := rec.Record(context.Background(), bulkJob("first")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err := rec.Record(context.Background(), bulkJob("second")); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	ts.setDown(false)
+	if err := rec.Record(context.Background(), bulkJob("third")); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	docs := strings.Join(ts.indexed(), "\n")
+	for _, key := range []string{"first", "third"} {
+		if !strings.Contains(docs, key) {
+			t.Errorf("%s is not indexed: %s", key, docs)
+		}
+	}
+	if strings.Contains(docs, "second") {
+		t.Errorf("second is indexed: %s", docs)
+	}
+}
+
+// The error of a timed flush should be returned by the next call, which should
+// not buffer its document.
+func TestBulkIntervalError(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	defer ts.Close()
+	rec := newBulkRecorder(t, ts.URL, 100, 10*time.Millisecond)
+
+	ts.setDown(true)
+	failed := -1
+	deadline := time.After(time.Second)
+	for i := 0; failed < 0; i++ {
+		if err := rec.Record(context.Background(), bulkJob(fmt.Sprintf("job%d", i))); err != nil {
+			failed = i
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("the error of the timed flush was not returned")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if failed == 0 {
+		t.Fatal("the first call returned an error")
+	}
+	ts.setDown(false)
+	if err := rec.Flush(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	docs := strings.Join(ts.indexed(), "\n")
+	for i := 0; i <= failed; i++ {
+		key := fmt.Sprintf(`"job%d"`, i)
+		if indexed := strings.Contains(docs, key); indexed != (i != failed) {
+			t.Errorf("%s indexed = (%t); want (%t)", key, indexed, i != failed)
+		}
+	}
+}
+
+func TestBulkEndpointNotAvailable(t *testing.T) {
+	t.Parallel()
+	ts := newBulkServer()
+	rec := newBulkRecorder(t, ts.URL, 1, time.Hour)
+	ts.Close()
+	err := rec.Record(context.Background(), bulkJob("key"))
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
@@ -5,6 +5,9 @@
 package elasticsearch
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/arsham/expipe/recorder"
@@ -14,13 +17,45 @@ import (
 
 // Config holds the necessary configuration for setting up an elasticsearch
 // reader endpoint from a configuration file.
+//
+// The bulk mode is turned on if any of bulk_actions, bulk_size or
+// flush_interval is set. The ones that are not set take their default values.
+// The retention policy is set if any of retention or max_indices is set. The
+// retention can be specified in days, e.g. 14d, and it needs an index_name
+// that starts with a literal text. The mapping_file is a JSON
+// file containing the mappings of the index template. The type_field is the
+// document field that holds the type name on clusters without mapping types.
+// The password and the api_key can be loaded from files with password_file
+// and api_key_file, but not both ways at the same time.
 type Config struct {
-	ESEndpoint  string `mapstructure:"endpoint"`
-	ESTimeout   string `mapstructure:"timeout"`
-	ESIndexName string `mapstructure:"index_name"`
-	log         tools.FieldLogger
-	ESName      string
-	ConfTimeout time.Duration
+	ESEndpoint            string `mapstructure:"endpoint"`
+	ESTimeout             string `mapstructure:"timeout"`
+	ESIndexName           string `mapstructure:"index_name"`
+	ESBulkActions         int    `mapstructure:"bulk_actions"`
+	ESBulkSize            string `mapstructure:"bulk_size"`
+	ESFlushInterval       string `mapstructure:"flush_interval"`
+	ESRetention           string `mapstructure:"retention"`
+	ESMaxIndices          int    `mapstructure:"max_indices"`
+	ESRetentionInterval   string `mapstructure:"retention_interval"`
+	ESRetentionDryRun     bool   `mapstructure:"retention_dry_run"`
+	ESMappingFile         string `mapstructure:"mapping_file"`
+	ESTypeField           string `mapstructure:"type_field"`
+	ESUsername            string `mapstructure:"username"`
+	ESPassword            string `mapstructure:"password"`
+	ESPasswordFile        string `mapstructure:"password_file"`
+	ESAPIKey              string `mapstructure:"api_key"`
+	ESAPIKeyFile          string `mapstructure:"api_key_file"`
+	ESCAFile              string `mapstructure:"ca_file"`
+	ESCertFile            string `mapstructure:"cert_file"`
+	ESKeyFile             string `mapstructure:"key_file"`
+	ESInsecureSkipVerify  bool   `mapstructure:"insecure_skip_verify"`
+	log                   tools.FieldLogger
+	ESName                string
+	ConfTimeout           time.Duration
+	ConfBulkSize          int64
+	ConfFlushInterval     time.Duration
+	ConfRetention         time.Duration
+	ConfRetentionInterval time.Duration
 }
 
 // Conf func is used for initializing a Config object.
@@ -41,13 +76,57 @@ func NewConfig(conf ...Conf) (*Config, error) {
 
 // Recorder implements the RecorderConf interface.
 func (c *Config) Recorder() (recorder.DataRecorder, error) {
-	return New(
+	options := []func(recorder.Constructor) error{
 		recorder.WithLogger(c.Logger()),
 		recorder.WithEndpoint(c.Endpoint()),
 		recorder.WithName(c.Name()),
 		recorder.WithIndexName(c.IndexName()),
 		recorder.WithTimeout(c.Timeout()),
-	)
+	}
+	if c.Bulk() {
+		options = append(options, WithBulk(c.ESBulkActions, c.ConfBulkSize, c.ConfFlushInterval))
+	}
+	if c.ESUsername != "" {
+		options = append(options, WithBasicAuth(c.ESUsername, c.ESPassword))
+	}
+	if c.ESAPIKey != "" {
+		options = append(options, WithAPIKey(c.ESAPIKey))
+	}
+	if c.ESCAFile != "" {
+		options = append(options, WithCACert(c.ESCAFile))
+	}
+	if c.ESCertFile != "" || c.ESKeyFile != "" {
+		options = append(options, WithClientCert(c.ESCertFile, c.ESKeyFile))
+	}
+	if c.ESInsecureSkipVerify {
+		options = append(options, WithInsecureSkipVerify())
+	}
+	if c.ESTypeField != "" {
+		options = append(options, WithTypeField(c.ESTypeField))
+	}
+	if c.ESMappingFile != "" {
+		options = append(options, WithMappingFile(c.ESMappingFile))
+	}
+	if c.Retention() {
+		options = append(options, WithRetention(c.ConfRetention, c.ESMaxIndices))
+		if c.ConfRetentionInterval > 0 {
+			options = append(options, WithRetentionInterval(c.ConfRetentionInterval))
+		}
+		if c.ESRetentionDryRun {
+			options = append(options, WithRetentionDryRun())
+		}
+	}
+	return New(options...)
+}
+
+// Retention returns true if the recorder should delete the old indices.
+func (c *Config) Retention() bool {
+	return c.ConfRetention != 0 || c.ESMaxIndices != 0
+}
+
+// Bulk returns true if the recorder should be in the bulk mode.
+func (c *Config) Bulk() bool {
+	return c.ESBulkActions != 0 || c.ConfBulkSize != 0 || c.ConfFlushInterval != 0
 }
 
 // Name return the name.
@@ -101,8 +180,69 @@ func WithViper(v unmarshaller, name, key string) Conf {
 		if timeout, err = time.ParseDuration(c.ESTimeout); err != nil {
 			return &recorder.ParseTimeOutError{Timeout: c.ESTimeout, Err: err}
 		}
+		if c.ConfBulkSize, err = tools.ParseSize(c.ESBulkSize); err != nil {
+			return errors.Wrapf(err, "parse bulk_size (%v)", c.ESBulkSize)
+		}
+		if c.ESFlushInterval != "" {
+			if c.ConfFlushInterval, err = time.ParseDuration(c.ESFlushInterval); err != nil {
+				return errors.Wrapf(err, "parse flush_interval (%v)", c.ESFlushInterval)
+			}
+		}
+		if c.ESBulkActions < 0 {
+			return fmt.Errorf("bulk_actions cannot be negative: %d", c.ESBulkActions)
+		}
+		if c.ConfRetention, err = parseAge(c.ESRetention); err != nil {
+			return errors.Wrapf(err, "parse retention (%v)", c.ESRetention)
+		}
+		if c.ESRetentionInterval != "" {
+			if c.ConfRetentionInterval, err = time.ParseDuration(c.ESRetentionInterval); err != nil {
+				return errors.Wrapf(err, "parse retention_interval (%v)", c.ESRetentionInterval)
+			}
+		}
+		if c.ESMaxIndices < 0 {
+			return fmt.Errorf("max_indices cannot be negative: %d", c.ESMaxIndices)
+		}
+		if c.ESPassword, err = loadSecret(c.ESPassword, c.ESPasswordFile); err != nil {
+			return errors.Wrap(err, "password")
+		}
+		if c.ESAPIKey, err = loadSecret(c.ESAPIKey, c.ESAPIKeyFile); err != nil {
+			return errors.Wrap(err, "api_key")
+		}
 		c.ESName = name
 		c.ConfTimeout = timeout
 		return nil
 	}
 }
+
+// loadSecret returns the value, or the content of the file if specified. It
+// returns an error if both are provided.
+func loadSecret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", errors.New("both the value and the file are provided")
+	}
+	return readSecret(file)
+}
+
+// parseAge returns the duration of the age. In addition to the time package's
+// units, it accepts days, e.g. 14d. It returns zero if the age is empty.
+func parseAge(age string) (time.Duration, error) {
+	age = strings.TrimSpace(age)
+	if age == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age: %s", age)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %s", age)
+	}
+	return d, nil
+}
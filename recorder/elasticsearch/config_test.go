@@ -180,3 +180,206 @@ func TestConfigRecorder(t *testing.T) {
 		t.Error("e = (nil); want (Recorder)")
 	}
 }
+
+func TestWithViperBulk(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            index_name: example_index
+            timeout: 10s
+            bulk_actions: 100
+            bulk_size: 2MB
+            flush_interval: 500ms
+    `))
+	v.ReadConfig(input)
+	c := new(elasticsearch.Config)
+	err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !c.Bulk() {
+		t.Error("c.Bulk() = (false); want (true)")
+	}
+	if c.ConfBulkSize != 2<<20 {
+		t.Errorf("c.ConfBulkSize = (%d); want (%d)", c.ConfBulkSize, 2<<20)
+	}
+	if c.ConfFlushInterval != 500*time.Millisecond {
+		t.Errorf("c.ConfFlushInterval = (%s); want (500ms)", c.ConfFlushInterval)
+	}
+
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"bad size", "bulk_size: 2ZB"},
+		{"negative size", "bulk_size: -2MB"},
+		{"bad interval", "flush_interval: 2sq"},
+		{"negative actions", "bulk_actions: -1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            timeout: 10s
+            ` + tc.input)))
+			c := new(elasticsearch.Config)
+			err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperRetention(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            index_name: expipe-{type_name}-{2006.01.02}
+            timeout: 10s
+            retention: 14d
+            max_indices: 30
+            retention_interval: 30m
+            retention_dry_run: true
+            type_field: application
+    `))
+	v.ReadConfig(input)
+	c := new(elasticsearch.Config)
+	err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !c.Retention() {
+		t.Error("c.Retention() = (false); want (true)")
+	}
+	if c.ConfRetention != 14*24*time.Hour {
+		t.Errorf("c.ConfRetention = (%s); want (336h)", c.ConfRetention)
+	}
+	if c.ConfRetentionInterval != 30*time.Minute {
+		t.Errorf("c.ConfRetentionInterval = (%s); want (30m)", c.ConfRetentionInterval)
+	}
+	if c.ESTypeField != "application" {
+		t.Errorf("c.ESTypeField = (%s); want (application)", c.ESTypeField)
+	}
+	if c.IndexName() != "expipe-{type_name}-{2006.01.02}" {
+		t.Errorf("c.IndexName() = (%s); want (expipe-{type_name}-{2006.01.02})", c.IndexName())
+	}
+	elasticsearch.WithLogger(tools.DiscardLogger())(c)
+	c.ESName = "recorder1"
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"bad retention", "retention: 14w"},
+		{"negative days", "retention: -1d"},
+		{"negative retention", "retention: -1h"},
+		{"bad interval", "retention_interval: 2sq"},
+		{"negative max indices", "max_indices: -1"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:9200
+            timeout: 10s
+            ` + tc.input)))
+			c := new(elasticsearch.Config)
+			err := elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSecrets(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	password := writeTemp(t, dir, "password", []byte("changeme\n"))
+	apiKey := writeTemp(t, dir, "api_key", []byte("  c2VjcmV0  "))
+	empty := writeTemp(t, dir, "empty", []byte("\n"))
+
+	read := func(input string) (*elasticsearch.Config, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: https://127.0.0.1:9200
+            timeout: 10s
+            username: elastic
+` + input)))
+		c := new(elasticsearch.Config)
+		return c, elasticsearch.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	}
+
+	c, err := read("            password_file: " + password + "\n            api_key_file: " + apiKey)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.ESPassword != "changeme" {
+		t.Errorf("c.ESPassword = (%s); want (changeme)", c.ESPassword)
+	}
+	if c.ESAPIKey != "c2VjcmV0" {
+		t.Errorf("c.ESAPIKey = (%s); want (c2VjcmV0)", c.ESAPIKey)
+	}
+
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"both password", "            password: pass\n            password_file: " + password},
+		{"both api key", "            api_key: key\n            api_key_file: " + apiKey},
+		{"missing file", "            password_file: " + dir + "/nothing"},
+		{"empty file", "            api_key_file: " + empty},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := read(tc.input); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestConfigRecorderSecurity(t *testing.T) {
+	c, err := elasticsearch.NewConfig(elasticsearch.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.ESName = "name"
+	c.ESEndpoint = "https://localhost:9200"
+	c.ESIndexName = "expipe"
+	c.ConfTimeout = time.Second
+	c.ESUsername = "elastic"
+	c.ESAPIKey = "key"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	c.ESAPIKey = ""
+	c.ESInsecureSkipVerify = true
+	if _, err = c.Recorder(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	c.ESKeyFile = "key.pem"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
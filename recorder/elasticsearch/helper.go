@@ -0,0 +1,224 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBulkActions is the number of documents that triggers a flush in
+	// the bulk mode, if not specified.
+	DefaultBulkActions = 500
+
+	// DefaultBulkSize is the size of the documents in bytes that triggers a
+	// flush in the bulk mode, if not specified.
+	DefaultBulkSize = 5 << 20
+
+	// DefaultFlushInterval is the maximum time a document is held in the
+	// buffer in the bulk mode, if not specified.
+	DefaultFlushInterval = time.Second
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// WithBulk turns on the bulk mode. The buffered documents are shipped in one
+// _bulk request when there are the given number of actions, when their size
+// reaches the given bytes, or when the oldest document has waited for the
+// interval; whichever happens first. Zero values are replaced by their
+// defaults.
+func WithBulk(actions int, size int64, interval time.Duration) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if actions < 0 || size < 0 || interval < 0 {
+			return fmt.Errorf("invalid bulk values: actions(%d) size(%d) interval(%s)", actions, size, interval)
+		}
+		if actions == 0 {
+			actions = DefaultBulkActions
+		}
+		if size == 0 {
+			size = DefaultBulkSize
+		}
+		if interval == 0 {
+			interval = DefaultFlushInterval
+		}
+		r.bulk = &bulker{
+			actions:  actions,
+			size:     size,
+			interval: interval,
+		}
+		return nil
+	}
+}
+
+// WithRetention sets the retention policy of the indices. The indices produced
+// by the index name template are deleted when they are older than the age, and
+// then the oldest ones are deleted if there are more than maxIndices of them.
+// Zero values mean no limits, but at least one of them should be set. The
+// index name should be a template, otherwise New returns an error.
+func WithRetention(age time.Duration, maxIndices int) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if age < 0 || maxIndices < 0 {
+			return fmt.Errorf("invalid retention values: age(%s) max indices(%d)", age, maxIndices)
+		}
+		if age == 0 && maxIndices == 0 {
+			return errors.New("retention age or max indices should be set")
+		}
+		p := r.retentionPolicy()
+		p.age, p.maxIndices = age, maxIndices
+		return nil
+	}
+}
+
+// WithRetentionInterval sets the interval between the retention checks.
+func WithRetentionInterval(interval time.Duration) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid retention interval: %s", interval)
+		}
+		r.retentionPolicy().interval = interval
+		return nil
+	}
+}
+
+// WithRetentionDryRun makes the recorder only log the indices it would have
+// deleted.
+func WithRetentionDryRun() func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		r.retentionPolicy().dryRun = true
+		return nil
+	}
+}
+
+// WithMappingFile replaces the mappings of the index template with the ones
+// in the JSON file. The file should contain the "mappings" section of the
+// template.
+func WithMappingFile(file string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		mappings, err := readMappings(file)
+		if err != nil {
+			return err
+		}
+		r.mappings = mappings
+		return nil
+	}
+}
+
+// WithTypeField sets the field that holds the TypeName of the jobs when the
+// cluster does not support mapping types.
+func WithTypeField(field string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if field == "" || strings.ContainsAny(field, `".`) || strings.HasPrefix(field, "_") {
+			return fmt.Errorf("invalid type field: %q", field)
+		}
+		r.typeField = field
+		return nil
+	}
+}
+
+// WithBasicAuth sets the username and password for connecting to the cluster.
+func WithBasicAuth(username, password string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if username == "" {
+			return errors.New("empty username")
+		}
+		r.security.username, r.security.password = username, password
+		return nil
+	}
+}
+
+// WithAPIKey sets the API key for connecting to the cluster. The key is the
+// base64 encoded "id:api_key" value, as elasticsearch returns in the encoded
+// field when the key is created.
+func WithAPIKey(key string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if key == "" {
+			return errors.New("empty api key")
+		}
+		r.security.apiKey = key
+		return nil
+	}
+}
+
+// WithCACert sets the PEM encoded certificates file for verifying the
+// cluster's certificate.
+func WithCACert(file string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if file == "" {
+			return errors.New("empty ca file")
+		}
+		r.security.caFile = file
+		return nil
+	}
+}
+
+// WithClientCert sets the PEM encoded certificate and key files the recorder
+// presents to the cluster.
+func WithClientCert(certFile, keyFile string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if certFile == "" || keyFile == "" {
+			return errors.New("both certificate and key files are required")
+		}
+		r.security.certFile, r.security.keyFile = certFile, keyFile
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify turns off verifying the cluster's certificate. It
+// should only be used for testing.
+func WithInsecureSkipVerify() func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		r.security.insecure = true
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+)
+
+const typeNamePlaceholder = "type_name"
+
+// indexTemplate is a parsed index name. Each placeholder in curly braces is
+// either {type_name}, which is replaced by the job's TypeName, or a layout in
+// the time package's format that is replaced by the job's Time in UTC. For
+// example "expipe-{type_name}-{2006.01.02}" becomes "expipe-myapp-2017.10.23".
+type indexTemplate []indexSegment
+
+type indexSegment struct {
+	text        string
+	placeholder bool
+}
+
+// parseIndexTemplate returns an InvalidIndexNameError if the braces are not
+// balanced or a placeholder is empty.
+func parseIndexTemplate(name string) (indexTemplate, error) {
+	var t indexTemplate
+	rest := name
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		closing := strings.IndexByte(rest, '}')
+		if open == -1 {
+			if closing != -1 {
+				return nil, recorder.InvalidIndexNameError(name)
+			}
+			t = append(t, indexSegment{text: rest})
+			break
+		}
+		if closing < open {
+			return nil, recorder.InvalidIndexNameError(name)
+		}
+		if open > 0 {
+			t = append(t, indexSegment{text: rest[:open]})
+		}
+		placeholder := rest[open+1 : closing]
+		if placeholder == "" || strings.ContainsRune(placeholder, '{') {
+			return nil, recorder.InvalidIndexNameError(name)
+		}
+		t = append(t, indexSegment{text: placeholder, placeholder: true})
+		rest = rest[closing+1:]
+	}
+	return t, nil
+}
+
+// static returns true if the name does not depend on the job.
+func (t indexTemplate) static() bool {
+	for _, s := range t {
+		if s.placeholder {
+			return false
+		}
+	}
+	return true
+}
+
+// prefix returns the literal text the names start with, or an empty string if
+// the template starts with a placeholder.
+func (t indexTemplate) prefix() string {
+	if len(t) == 0 || t[0].placeholder {
+		return ""
+	}
+	return strings.ToLower(t[0].text)
+}
+
+// name evaluates the template for the given type name and time. Elasticsearch
+// only accepts lower case index names, therefore the result is lower cased and
+// the characters that are not allowed in the type name are replaced with
+// underscores.
+func (t indexTemplate) name(typeName string, ts time.Time) string {
+	buf := new(bytes.Buffer)
+	for _, s := range t {
+		switch {
+		case !s.placeholder:
+			buf.WriteString(s.text)
+		case s.text == typeNamePlaceholder:
+			buf.WriteString(sanitiseIndexPart(typeName))
+		default:
+			buf.WriteString(ts.UTC().Format(s.text))
+		}
+	}
+	return strings.ToLower(buf.String())
+}
+
+// pattern returns a wildcard expression that matches all indices produced by
+// the template.
+func (t indexTemplate) pattern() string {
+	buf := new(bytes.Buffer)
+	for _, s := range t {
+		if s.placeholder {
+			buf.WriteByte('*')
+			continue
+		}
+		buf.WriteString(s.text)
+	}
+	return strings.ToLower(buf.String())
+}
+
+// matcher returns a regular expression that only matches the whole names
+// produced by the template. Unlike the pattern, it does not match the indices
+// that have the same prefix and suffix, but more parts in between.
+func (t indexTemplate) matcher() *regexp.Regexp {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('^')
+	for _, s := range t {
+		if s.placeholder {
+			buf.WriteString(placeholderExpr(s.text))
+			continue
+		}
+		buf.WriteString(regexp.QuoteMeta(strings.ToLower(s.text)))
+	}
+	buf.WriteByte('$')
+	return regexp.MustCompile(buf.String())
+}
+
+// placeholderExpr returns an expression matching what the placeholder
+// produces. The runs of digits and letters of a formatted time match any
+// digits and letters, and the rest of the layout is expected as is.
+func placeholderExpr(placeholder string) string {
+	if placeholder == typeNamePlaceholder {
+		return ".+"
+	}
+	buf := new(bytes.Buffer)
+	var last string
+	for _, r := range strings.ToLower(time.Time{}.Format(placeholder)) {
+		var class string
+		switch {
+		case r >= '0' && r <= '9':
+			class = `\d+`
+		case r >= 'a' && r <= 'z':
+			class = "[a-z]+"
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+		if class != "" && class != last {
+			buf.WriteString(class)
+		}
+		last = class
+	}
+	return buf.String()
+}
+
+func sanitiseIndexPart(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(` "*\<|,>/?#:`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
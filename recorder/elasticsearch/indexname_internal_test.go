@@ -0,0 +1,92 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+)
+
+func TestIndexTemplateName(t *testing.T) {
+	ts := time.Date(2017, 10, 23, 22, 0, 0, 0, time.FixedZone("test", -3*3600))
+	tcs := []struct {
+		template string
+		typeName string
+		want     string
+		static   bool
+	}{
+		{"expipe", "App", "expipe", true},
+		{"expipe-{type_name}", "MyApp", "expipe-myapp", false},
+		{"expipe-{2006.01.02}", "App", "expipe-2017.10.24", false},
+		{"expipe-{type_name}-{2006.01.02}", "App", "expipe-app-2017.10.24", false},
+		{"{type_name}", "my app/1", "my_app_1", false},
+		{"{2006}-{01}", "App", "2017-10", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.template, func(t *testing.T) {
+			tmpl, err := parseIndexTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if got := tmpl.name(tc.typeName, ts); got != tc.want {
+				t.Errorf("name() = (%s); want (%s)", got, tc.want)
+			}
+			if tmpl.static() != tc.static {
+				t.Errorf("static() = (%t); want (%t)", tmpl.static(), tc.static)
+			}
+		})
+	}
+}
+
+func TestParseIndexTemplateErrors(t *testing.T) {
+	tcs := []string{
+		"expipe-{type_name",
+		"expipe-type_name}",
+		"expipe-}type_name{",
+		"expipe-{}",
+		"expipe-{{type_name}}",
+	}
+	for _, tc := range tcs {
+		t.Run(tc, func(t *testing.T) {
+			_, err := parseIndexTemplate(tc)
+			if _, ok := err.(recorder.InvalidIndexNameError); !ok {
+				t.Errorf("err = (%#v); want (recorder.InvalidIndexNameError)", err)
+			}
+		})
+	}
+}
+
+func TestIndexTemplateMatcher(t *testing.T) {
+	tcs := []struct {
+		template string
+		name     string
+		pattern  string
+		match    bool
+	}{
+		{"expipe-{type_name}-{2006.01.02}", "expipe-app-2017.10.24", "expipe-*-*", true},
+		{"expipe-{type_name}-{2006.01.02}", "expipe-my-app-2017.10.24", "expipe-*-*", true},
+		{"expipe-{type_name}-{2006.01.02}", "expipe-app-2017.10", "expipe-*-*", false},
+		{"expipe-{type_name}-{2006.01.02}", "expipe-app-notadate", "expipe-*-*", false},
+		{"expipe-{2006.01}", "expipe-2017.10", "expipe-*", true},
+		{"expipe-{2006.01}", "expipe-2017.10-old", "expipe-*", false},
+		{"Expipe-{Jan-2006}", "expipe-oct-2017", "expipe-*", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseIndexTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if tmpl.pattern() != tc.pattern {
+				t.Errorf("pattern() = (%s); want (%s)", tmpl.pattern(), tc.pattern)
+			}
+			if got := tmpl.matcher().MatchString(tc.name); got != tc.match {
+				t.Errorf("MatchString(%s) = (%t); want (%t)", tc.name, got, tc.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/pkg/errors"
+)
+
+const (
+	doubleType  = "double"
+	keywordType = "keyword"
+	dateType    = "date"
+
+	timestampField = "@timestamp"
+)
+
+// fieldType returns the elasticsearch type for storing the values of the data
+// type. Lists are stored as arrays of doubles. It returns an empty string if
+// the type is not known.
+func fieldType(d datatype.DataType) string {
+	switch d.(type) {
+	case *datatype.FloatType, *datatype.ByteType, *datatype.KiloByteType, *datatype.MegaByteType:
+		return doubleType
+	case *datatype.FloatListType, *datatype.GCListType:
+		return doubleType
+	case *datatype.StringType:
+		return keywordType
+	}
+	return ""
+}
+
+// dynamicTemplates maps the types elasticsearch detects in the documents to
+// the types of the data types producing them. Numbers without fractions are
+// detected as long, therefore they are included to avoid failures when a
+// fraction arrives later.
+var dynamicTemplates = []struct {
+	name      string
+	matchType string
+	sample    datatype.DataType
+}{
+	{"strings", "string", &datatype.StringType{}},
+	{"integers", "long", &datatype.FloatType{}},
+	{"floats", "double", &datatype.FloatType{}},
+}
+
+// defaultMappings returns the mappings derived from the data types. In the
+// typeless mode there is no _default_ type, and the type field is a keyword.
+func (r *Recorder) defaultMappings() map[string]interface{} {
+	templates := make([]map[string]interface{}, len(dynamicTemplates))
+	for i, t := range dynamicTemplates {
+		templates[i] = map[string]interface{}{
+			t.name: map[string]interface{}{
+				"match_mapping_type": t.matchType,
+				"mapping":            map[string]string{"type": fieldType(t.sample)},
+			},
+		}
+	}
+	properties := map[string]interface{}{
+		timestampField: map[string]string{"type": dateType},
+	}
+	mapping := map[string]interface{}{
+		"dynamic_templates": templates,
+		"properties":        properties,
+	}
+	if _, typeless := r.connection(); typeless {
+		properties[r.typeField] = map[string]string{"type": keywordType}
+		return mapping
+	}
+	return map[string]interface{}{"_default_": mapping}
+}
+
+// readMappings reads the mappings from a JSON file.
+func readMappings(file string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading mapping file")
+	}
+	var mappings map[string]interface{}
+	if err = json.Unmarshal(data, &mappings); err != nil {
+		return nil, errors.Wrapf(err, "decoding mapping file: %s", file)
+	}
+	if len(mappings) == 0 {
+		return nil, errors.Errorf("empty mapping file: %s", file)
+	}
+	return mappings, nil
+}
+
+// templateName returns the name of the recorder's index template.
+func (r *Recorder) templateName() string {
+	return "expipe-" + strings.ToLower(sanitiseIndexPart(r.name))
+}
+
+// putTemplate installs an index template that applies the mappings to all
+// indices the recorder creates. It replaces the previous template of the
+// recorder, therefore changes in the mappings take effect on the next index.
+func (r *Recorder) putTemplate(ctx context.Context) error {
+	mappings := r.mappings
+	if mappings == nil {
+		mappings = r.defaultMappings()
+	}
+	client, typeless := r.connection()
+	body := map[string]interface{}{"mappings": mappings}
+	if typeless {
+		body["index_patterns"] = []string{r.template.pattern()}
+	} else {
+		body["template"] = r.template.pattern()
+	}
+	_, err := client.IndexPutTemplate(r.templateName()).BodyJson(body).Do(ctx)
+	return errors.Wrap(err, "installing index template")
+}
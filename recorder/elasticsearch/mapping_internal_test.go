@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+func TestFieldType(t *testing.T) {
+	tcs := []struct {
+		d    datatype.DataType
+		want string
+	}{
+		{datatype.NewFloatType("a", 1), "double"},
+		{datatype.NewByteType("a", 1), "double"},
+		{datatype.NewKiloByteType("a", 1), "double"},
+		{datatype.NewMegaByteType("a", 1), "double"},
+		{datatype.NewFloatListType("a", []float64{1}), "double"},
+		{datatype.NewGCListType("a", []uint64{1}), "double"},
+		{datatype.NewStringType("a", "b"), "keyword"},
+		{nil, ""},
+	}
+	for _, tc := range tcs {
+		if got := fieldType(tc.d); got != tc.want {
+			t.Errorf("fieldType(%T) = (%s); want (%s)", tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestDefaultMappings(t *testing.T) {
+	r := &Recorder{}
+	data, err := json.Marshal(r.defaultMappings())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var m struct {
+		Default struct {
+			DynamicTemplates []map[string]struct {
+				MatchMappingType string            `json:"match_mapping_type"`
+				Mapping          map[string]string `json:"mapping"`
+			} `json:"dynamic_templates"`
+			Properties map[string]map[string]string `json:"properties"`
+		} `json:"_default_"`
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if m.Default.Properties["@timestamp"]["type"] != "date" {
+		t.Errorf("@timestamp = (%v); want (date)", m.Default.Properties["@timestamp"])
+	}
+	want := map[string]string{"string": "keyword", "long": "double", "double": "double"}
+	got := make(map[string]string)
+	for _, tmpl := range m.Default.DynamicTemplates {
+		for _, v := range tmpl {
+			got[v.MatchMappingType] = v.Mapping["type"]
+		}
+	}
+	for match, typ := range want {
+		if got[match] != typ {
+			t.Errorf("got[%s] = (%s); want (%s)", match, got[match], typ)
+		}
+	}
+}
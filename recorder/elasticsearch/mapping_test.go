@@ -0,0 +1,162 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/elasticsearch"
+)
+
+// templateServer records the index templates it receives.
+type templateServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	templates map[string]map[string]interface{}
+	fail      bool
+}
+
+func newTemplateServer() *templateServer {
+	var host, url, port string
+	s := &templateServer{templates: make(map[string]map[string]interface{})}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		case strings.HasPrefix(r.URL.Path, "/_template/"):
+			if s.fail {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body := make(map[string]interface{})
+			json.NewDecoder(r.Body).Decode(&body)
+			s.templates[strings.TrimPrefix(r.URL.Path, "/_template/")] = body
+			w.Write([]byte(`{"acknowledged": true}`))
+		default:
+			w.Write([]byte(recording))
+		}
+	})
+	s.Server = httptest.NewServer(handler)
+	url = strings.Split(s.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return s
+}
+
+func mappingFile(t *testing.T, content string) (string, func()) {
+	f, err := ioutil.TempFile("", "mapping")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	f.WriteString(content)
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+func TestIndexTemplate(t *testing.T) {
+	t.Parallel()
+	ts := newTemplateServer()
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("My Recorder"),
+		recorder.WithIndexName("expipe-{type_name}-{2006.01.02}"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	tmpl, ok := ts.templates["expipe-my_recorder"]
+	if !ok {
+		t.Fatalf("template was not installed: %v", ts.templates)
+	}
+	if tmpl["template"] != "expipe-*-*" {
+		t.Errorf("template = (%v); want (expipe-*-*)", tmpl["template"])
+	}
+	if _, ok := tmpl["mappings"]; !ok {
+		t.Errorf("mappings not in the template: %v", tmpl)
+	}
+}
+
+func TestIndexTemplateMappingFile(t *testing.T) {
+	t.Parallel()
+	ts := newTemplateServer()
+	defer ts.Close()
+	name, cleanup := mappingFile(t, `{"my_type": {"properties": {"key": {"type": "integer"}}}}`)
+	defer cleanup()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		elasticsearch.WithMappingFile(name),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	mappings, ok := ts.templates["expipe-name"]["mappings"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("mappings not in the template: %v", ts.templates)
+	}
+	if _, ok := mappings["my_type"]; !ok {
+		t.Errorf("my_type not in mappings: %v", mappings)
+	}
+	if _, ok := mappings["_default_"]; ok {
+		t.Errorf("default mappings were not replaced: %v", mappings)
+	}
+}
+
+func TestIndexTemplateError(t *testing.T) {
+	t.Parallel()
+	ts := newTemplateServer()
+	defer ts.Close()
+	ts.fail = true
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithMappingFileErrors(t *testing.T) {
+	invalid, cleanup := mappingFile(t, `{"my_type": `)
+	defer cleanup()
+	empty, cleanup2 := mappingFile(t, `{}`)
+	defer cleanup2()
+	for _, file := range []string{"/does/not/exist.json", invalid, empty} {
+		_, err := elasticsearch.New(
+			recorder.WithEndpoint("http://127.0.0.1:9200"),
+			recorder.WithName("name"),
+			elasticsearch.WithMappingFile(file),
+		)
+		if err == nil {
+			t.Errorf("%s: err = (nil); want (error)", file)
+		}
+	}
+}
@@ -9,44 +9,128 @@
 //
 // This list will grow in time:
 //
-//   +----------------------+-------------------------+
-//   |   Expipe var name    |  ElasticSearch Var Name |
-//   +----------------------+-------------------------+
-//   | elasticsearchRecords | ElasticSearch Records   |
-//   +----------------------+-------------------------+
+//   +------------------------------+--------------------------------+
+//   |       Expipe var name        |     ElasticSearch Var Name     |
+//   +------------------------------+--------------------------------+
+//   | elasticsearchRecords         | ElasticSearch Records          |
+//   | elasticsearchBulkRequests    | ElasticSearch Bulk Requests    |
+//   | elasticsearchFailedRecords   | ElasticSearch Failed Records   |
+//   | elasticsearchExpiredIndices  | ElasticSearch Expired Indices  |
+//   | elasticsearchDeletedIndices  | ElasticSearch Deleted Indices  |
+//   | elasticsearchRetentionErrors | ElasticSearch Retention Errors |
+//   +------------------------------+--------------------------------+
+//
+// Bulk mode
+//
+// By default every job is shipped in its own request. In the bulk mode (see
+// WithBulk) the documents are buffered and shipped in _bulk requests. Record
+// returns when the document is buffered, unless the buffer is full and it has
+// to be shipped. If a _bulk request fails, its documents are kept for the next
+// one, and the error is returned by the Record call that shipped it, or by the
+// next one if it was shipped after the flush interval. If elasticsearch
+// rejects a document, a BulkItemError holding the job's ID is logged. The
+// buffer is shipped by Flush, e.g. on shutdown.
+//
+// Index names
+//
+// The index name can have placeholders in curly braces. {type_name} is
+// replaced by the TypeName of the job, and any other placeholder is treated as
+// a layout in the time package's format and is replaced by the Time of the job
+// in UTC. For example "expipe-{type_name}-{2006.01.02}" produces a new index
+// for each app per day. The indices are created on demand when the first
+// document arrives, and the recorder remembers which ones exist.
+//
+// Mappings
+//
+// On ping, the recorder installs an index template for its indices, therefore
+// the fields are not left to elasticsearch's guesses. The mappings are derived
+// from the data types: the float types are stored as double, lists as arrays
+// of doubles, strings as keyword, and the @timestamp field as date. You can
+// replace the mappings with the ones in a JSON file (see WithMappingFile).
+//
+// Typeless clusters
+//
+// Elasticsearch 7 and later versions do not support mapping types. The
+// recorder detects the version of the cluster on ping, and if it doesn't
+// support types, it indexes the documents without a type and writes the
+// TypeName of the job in the "app" field of the document instead (see
+// WithTypeField). In Kibana, filter the apps with "app:AppName" instead of
+// "_type:AppName".
+//
+// Security
+//
+// The recorder can authenticate with basic auth (WithBasicAuth) or an API key
+// (WithAPIKey), verify the cluster's certificate with a custom CA bundle
+// (WithCACert) and present a client certificate (WithClientCert). In the
+// configuration file the password and the API key can be loaded from files
+// with password_file and api_key_file.
+//
+// Retention
+//
+// When the index name is a template, the recorder can delete the indices that
+// are older than a certain age, or the oldest ones when there are more than a
+// certain number of them (see WithRetention). The template should start with a
+// literal text, e.g. expipe-{type_name}-{2006.01.02}, so the indices of the
+// other tools on the cluster are not deleted. The check is done periodically
+// after the first successful ping. In the dry-run mode the indices are only
+// logged.
 package elasticsearch
 
 import (
 	"bytes"
 	"context"
 	"expvar"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
-	"github.com/arsham/expipe/datatype"
 	"github.com/arsham/expipe/recorder"
 	"github.com/arsham/expipe/tools"
 	"github.com/olivere/elastic"
 	"github.com/pkg/errors"
 )
 
-var elasticsearchRecords = expvar.NewInt("ElasticSearch Records")
+var (
+	elasticsearchRecords       = expvar.NewInt("ElasticSearch Records")
+	elasticsearchBulkRequests  = expvar.NewInt("ElasticSearch Bulk Requests")
+	elasticsearchFailedRecords = expvar.NewInt("ElasticSearch Failed Records")
+
+	elasticsearchExpiredIndices  = expvar.NewInt("ElasticSearch Expired Indices")
+	elasticsearchDeletedIndices  = expvar.NewInt("ElasticSearch Deleted Indices")
+	elasticsearchRetentionErrors = expvar.NewInt("ElasticSearch Retention Errors")
+)
 
 // Recorder contains an elasticsearch client and an index name for recording
 // data. It implements DataRecorder interface
 type Recorder struct {
-	name      string
-	client    *elastic.Client // Elasticsearch client
-	endpoint  string
-	indexName string
-	log       tools.FieldLogger
-	timeout   time.Duration
-	pinged    bool
+	name       string
+	endpoint   string
+	indexName  string
+	log        tools.FieldLogger
+	timeout    time.Duration
+	bulk       *bulker // nil if not in the bulk mode
+	template   indexTemplate
+	retention  *retention             // nil if the indices are kept forever
+	mappings   map[string]interface{} // nil means the default mappings
+	typeField  string                 // holds the TypeName in the typeless mode
+	security   security
+	httpClient *http.Client // nil means the elastic's default client
+
+	pingMu sync.Mutex // serialises the pings
+
+	// The client, typeless and pinged are replaced by Ping, which can be
+	// called while the jobs are being recorded. They are guarded by mu.
+	mu       sync.Mutex
+	client   *elastic.Client // Elasticsearch client
+	typeless bool            // true if the cluster does not support types
+	pinged   bool
+	indices  map[string]struct{} // the indices that are known to exist
 }
 
 // New returns an error if it can't create the index.
 func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
-	r := &Recorder{}
+	r := &Recorder{indices: make(map[string]struct{})}
 	for _, op := range options {
 		err := op(r)
 		if err != nil {
@@ -66,53 +150,123 @@ func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
 	if r.indexName == "" {
 		r.indexName = r.name
 	}
+	template, err := parseIndexTemplate(r.indexName)
+	if err != nil {
+		return nil, err
+	}
+	r.template = template
+	if r.retention != nil && r.template.static() {
+		return nil, errors.New("retention needs a templated index name")
+	}
+	if r.retention != nil && r.template.prefix() == "" {
+		// otherwise the indices of the other tools would match.
+		return nil, errors.New("retention needs an index name that starts with a literal text")
+	}
 	if r.timeout == 0 {
 		r.timeout = 5 * time.Second
 	}
+	if r.bulk != nil {
+		r.bulk.flush = r.shipBulk
+	}
+	if r.typeField == "" {
+		r.typeField = DefaultTypeField
+	}
+	if r.security.username != "" && r.security.apiKey != "" {
+		return nil, errors.New("basic auth and api key cannot be used together")
+	}
+	if r.httpClient, err = r.security.httpClient(); err != nil {
+		return nil, err
+	}
 	r.log.Debug("connecting to: ", r.Endpoint())
 	return r, nil
 }
 
-// Ping pings the endpoint and report if there was an error.
+// Ping pings the endpoint and report if there was an error. Each ping replaces
+// the client, and stops the previous one.
 func (r *Recorder) Ping() error {
-	var err error
+	r.pingMu.Lock()
+	defer r.pingMu.Unlock()
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
-	r.client, err = elastic.NewClient(
+	options := []elastic.ClientOptionFunc{
 		elastic.SetURL(r.endpoint),
 		elastic.SetErrorLog(r.log),
 		elastic.SetHealthcheckTimeoutStartup(r.timeout),
 		elastic.SetSnifferTimeout(r.timeout),
 		elastic.SetHealthcheckTimeout(r.timeout),
 		elastic.SetSnifferTimeoutStartup(r.timeout),
-	)
+	}
+	if u, e := url.Parse(r.endpoint); e == nil && u.Scheme != "" {
+		// The sniffed nodes should be connected with the same scheme.
+		options = append(options, elastic.SetScheme(u.Scheme))
+	}
+	if r.security.username != "" {
+		options = append(options, elastic.SetBasicAuth(r.security.username, r.security.password))
+	}
+	if r.httpClient != nil {
+		options = append(options, elastic.SetHttpClient(r.httpClient))
+	}
+	client, err := elastic.NewClient(options...)
 	if err != nil {
 		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
 	}
-	exists, err := r.client.IndexExists(r.indexName).Do(ctx)
+	typeless, err := r.detectVersion(client)
 	if err != nil {
-		return errors.Wrap(err, "querying index")
+		client.Stop()
+		return err
 	}
-	if !exists {
-		_, err := r.client.CreateIndex(r.indexName).Do(ctx)
-		if err != nil {
-			return errors.Wrapf(err, "create index: %s", r.indexName)
+	r.mu.Lock()
+	old := r.client
+	r.client, r.typeless = client, typeless
+	r.indices = make(map[string]struct{})
+	r.mu.Unlock()
+	if old != nil {
+		// The requests in flight can finish with the old client, but its
+		// healthcheck and sniffer goroutines are not needed anymore.
+		old.Stop()
+	}
+	if err = r.putTemplate(ctx); err != nil {
+		return err
+	}
+	if r.template.static() {
+		// Otherwise the indices are created when the jobs arrive.
+		if err = r.ensureIndex(ctx, r.template.name("", time.Time{})); err != nil {
+			return err
 		}
 	}
+	r.mu.Lock()
 	r.pinged = true
+	r.mu.Unlock()
+	r.startRetention()
 	return nil
 }
 
+// connection returns the client and whether the cluster does not support
+// types. The client is nil if the ping is not called.
+func (r *Recorder) connection() (*elastic.Client, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client, r.typeless
+}
+
 // Record returns an error if the endpoint responds in errors. It returns an
 // error if the ping is not called or the endpoint is not responding too many
 // times.
 func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
-	if !r.pinged {
+	r.mu.Lock()
+	pinged := r.pinged
+	r.mu.Unlock()
+	if !pinged {
 		return recorder.ErrPingNotCalled
 	}
 	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
 	defer cancel()
-	err := r.record(ctx, job.TypeName, job.Time, job.Payload)
+	var err error
+	if r.bulk != nil {
+		err = r.enqueue(ctx, job)
+	} else {
+		err = r.record(ctx, job)
+	}
 	if err != nil {
 		err = errors.Cause(err)
 		if _, ok := err.(*url.Error); ok || err == elastic.ErrNoClient {
@@ -131,17 +285,25 @@ func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
 // record ships the kv data to elasticsearch. It calls the recordFunc if exists,
 // otherwise continues as normal. Although this doesn't change the state of the
 // Client, it is a part of its behaviour.
-func (r *Recorder) record(ctx context.Context, typeName string, timestamp time.Time, list datatype.DataContainer) error {
+func (r *Recorder) record(ctx context.Context, job recorder.Job) error {
 	w := new(bytes.Buffer)
-	_, err := list.Generate(w, timestamp)
+	_, err := job.Payload.Generate(w, job.Time)
 	if err != nil {
-		errors.Wrap(err, "generating payload")
+		return errors.Wrap(err, "generating payload")
 	}
-	payload := w.String()
-	_, err = r.client.Index().
-		Index(r.indexName).
-		Type(typeName).
-		BodyString(payload).
+	index := r.template.name(job.TypeName, job.Time)
+	if err = r.ensureIndex(ctx, index); err != nil {
+		return err
+	}
+	payload, err := r.document(job.TypeName, w.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	client, _ := r.connection()
+	_, err = client.Index().
+		Index(index).
+		Type(r.mappingType(job.TypeName)).
+		BodyString(string(payload)).
 		Do(ctx)
 	if err != nil {
 		return errors.Wrap(err, "record payload")
@@ -150,6 +312,60 @@ func (r *Recorder) record(ctx context.Context, typeName string, timestamp time.T
 	return ctx.Err()
 }
 
+// enqueue hands the job's payload to the bulk buffer.
+func (r *Recorder) enqueue(ctx context.Context, job recorder.Job) error {
+	w := new(bytes.Buffer)
+	_, err := job.Payload.Generate(w, job.Time)
+	if err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	index := r.template.name(job.TypeName, job.Time)
+	if err = r.ensureIndex(ctx, index); err != nil {
+		return err
+	}
+	payload, err := r.document(job.TypeName, w.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	item := &bulkItem{
+		id:       job.ID,
+		index:    index,
+		typeName: r.bulkType(job.TypeName),
+		payload:  payload,
+	}
+	return r.bulk.add(item)
+}
+
+// ensureIndex creates the index if it does not exist. The existing indices are
+// cached, therefore elasticsearch is queried only once for each index. If the
+// creation fails because another client has just created it, it is not
+// considered an error.
+func (r *Recorder) ensureIndex(ctx context.Context, index string) error {
+	r.mu.Lock()
+	_, ok := r.indices[index]
+	r.mu.Unlock()
+	if ok {
+		return nil
+	}
+	client, _ := r.connection()
+	exists, err := client.IndexExists(index).Do(ctx)
+	if err != nil {
+		return errors.Wrap(err, "querying index")
+	}
+	if !exists {
+		if _, err = client.CreateIndex(index).Do(ctx); err != nil {
+			exists, e := client.IndexExists(index).Do(ctx)
+			if e != nil || !exists {
+				return errors.Wrapf(err, "create index: %s", index)
+			}
+		}
+	}
+	r.mu.Lock()
+	r.indices[index] = struct{}{}
+	r.mu.Unlock()
+	return nil
+}
+
 // Name shows the name identifier for this recorder.
 func (r *Recorder) Name() string { return r.name }
 
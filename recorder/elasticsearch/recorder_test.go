@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -154,6 +155,43 @@ func TestElasticsearchRecordURLError(t *testing.T) {
 	}
 }
 
+func TestElasticsearchClose(t *testing.T) {
+	t.Parallel()
+	ts := getTestServer()
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{}),
+		TypeName: "my type",
+		Time:     time.Now(),
+	}
+	if err = rec.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), job); err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), job); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
 func TestElasticsearchIndexExists(t *testing.T) {
 	t.Parallel()
 	var host, url, port string
@@ -238,3 +276,108 @@ func TestElasticsearchCreateIndex(t *testing.T) {
 		t.Fatalf("err = (%#v); want (nil)", err)
 	}
 }
+
+func TestElasticsearchIndexTemplate(t *testing.T) {
+	t.Parallel()
+	var (
+		host, url, port string
+		mu              sync.Mutex
+		created         = make(map[string]bool)
+		queried         = make(map[string]int)
+		indexed         = make(map[string]int)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		case len(parts) == 1 && r.Method == "HEAD":
+			queried[parts[0]]++
+			if !created[parts[0]] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case len(parts) == 1 && r.Method == "PUT":
+			created[parts[0]] = true
+			w.Write([]byte(`{"acknowledged": true}`))
+		default:
+			indexed[parts[0]]++
+			w.Write([]byte(recording))
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	url = strings.Split(ts.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe-{type_name}-{2006.01.02}"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(created) != 0 {
+		t.Errorf("len(created) = (%d); want (0)", len(created))
+	}
+
+	day1 := time.Date(2017, 10, 23, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	jobs := []struct {
+		typeName string
+		time     time.Time
+	}{
+		{"AppOne", day1},
+		{"AppOne", day1},
+		{"AppTwo", day1},
+		{"AppOne", day2},
+	}
+	for _, j := range jobs {
+		err := rec.Record(context.Background(), recorder.Job{
+			ID:       token.NewUID(),
+			Payload:  datatype.New([]datatype.DataType{}),
+			TypeName: j.typeName,
+			Time:     j.time,
+		})
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{
+		"expipe-appone-2017.10.23": 2,
+		"expipe-apptwo-2017.10.23": 1,
+		"expipe-appone-2017.10.24": 1,
+	}
+	for index, count := range want {
+		if !created[index] {
+			t.Errorf("%s was not created", index)
+		}
+		if queried[index] != 1 {
+			t.Errorf("queried[%s] = (%d); want (1)", index, queried[index])
+		}
+		if indexed[index] != count {
+			t.Errorf("indexed[%s] = (%d); want (%d)", index, indexed[index], count)
+		}
+	}
+}
+
+func TestElasticsearchInvalidIndexTemplate(t *testing.T) {
+	_, err := elasticsearch.New(
+		recorder.WithEndpoint("http://127.0.0.1:9200"),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe-{type_name"),
+	)
+	if _, ok := errors.Cause(err).(recorder.InvalidIndexNameError); !ok {
+		t.Errorf("err = (%#v); want (recorder.InvalidIndexNameError)", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRetentionInterval is the interval between the retention checks, if
+// not specified.
+const DefaultRetentionInterval = time.Hour
+
+// retention holds the policy for deleting the indices produced by the
+// recorder's index name template.
+type retention struct {
+	age        time.Duration // zero means no limit
+	maxIndices int           // zero means no limit
+	interval   time.Duration
+	dryRun     bool
+	quit       chan struct{}
+	pruneMu    sync.Mutex // the loop and the callers should not overlap
+}
+
+type indexInfo struct {
+	name    string
+	created time.Time
+}
+
+type byCreation []indexInfo
+
+func (b byCreation) Len() int           { return len(b) }
+func (b byCreation) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCreation) Less(i, j int) bool { return b[i].created.Before(b[j].created) }
+
+// retentionPolicy returns the retention policy, and creates one if not set.
+func (r *Recorder) retentionPolicy() *retention {
+	if r.retention == nil {
+		r.retention = &retention{interval: DefaultRetentionInterval}
+	}
+	return r.retention
+}
+
+// startRetention starts the retention loop if the retention policy is set and
+// the loop is not running already.
+func (r *Recorder) startRetention() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.retention == nil || r.retention.quit != nil {
+		return
+	}
+	r.retention.quit = make(chan struct{})
+	go r.retentionLoop(r.retention.quit)
+}
+
+func (r *Recorder) retentionLoop(quit chan struct{}) {
+	ticker := time.NewTicker(r.retention.interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		if _, err := r.Prune(ctx); err != nil {
+			elasticsearchRetentionErrors.Add(1)
+			r.log.Errorf("%s: pruning indices: %v", r.name, err)
+		}
+		cancel()
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Prune deletes the indices produced by the index name template that are
+// older than the retention age, and then the oldest ones if there are more
+// than the maximum number of indices. In the dry-run mode it only logs them.
+// It returns the names of the deleted indices. It is a no-op if the retention
+// policy is not set.
+func (r *Recorder) Prune(ctx context.Context) ([]string, error) {
+	if r.retention == nil {
+		return nil, nil
+	}
+	client, _ := r.connection()
+	if client == nil {
+		return nil, errors.New("ping is not called")
+	}
+	r.retention.pruneMu.Lock()
+	defer r.retention.pruneMu.Unlock()
+	res, err := client.IndexGet(r.template.pattern()).Do(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing indices")
+	}
+	matcher := r.template.matcher()
+	indices := make([]indexInfo, 0, len(res))
+	for name, info := range res {
+		if !matcher.MatchString(name) || info == nil {
+			continue
+		}
+		created, ok := creationDate(info.Settings)
+		if !ok {
+			r.log.Warnf("%s: no creation date for %s", r.name, name)
+			continue
+		}
+		indices = append(indices, indexInfo{name: name, created: created})
+	}
+	sort.Sort(byCreation(indices))
+
+	var expired []string
+	cutoff := time.Now().Add(-r.retention.age)
+	for i, index := range indices {
+		remaining := len(indices) - i
+		if (r.retention.age > 0 && index.created.Before(cutoff)) ||
+			(r.retention.maxIndices > 0 && remaining > r.retention.maxIndices) {
+			expired = append(expired, index.name)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	elasticsearchExpiredIndices.Add(int64(len(expired)))
+	if r.retention.dryRun {
+		r.log.Infof("%s: dry-run: would delete indices: %v", r.name, expired)
+		return expired, nil
+	}
+	if _, err = client.DeleteIndex(expired...).Do(ctx); err != nil {
+		return nil, errors.Wrap(err, "deleting indices")
+	}
+	r.mu.Lock()
+	for _, name := range expired {
+		delete(r.indices, name)
+	}
+	r.mu.Unlock()
+	elasticsearchDeletedIndices.Add(int64(len(expired)))
+	r.log.Infof("%s: deleted indices: %v", r.name, expired)
+	return expired, nil
+}
+
+// creationDate reads the index.creation_date setting, which is in
+// milliseconds since epoch.
+func creationDate(settings map[string]interface{}) (time.Time, bool) {
+	index, ok := settings["index"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, false
+	}
+	value, ok := index["creation_date"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// Close flushes the buffered documents, and stops the retention loop and the
+// client. The recorder should be pinged again to record.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.retention != nil && r.retention.quit != nil {
+		close(r.retention.quit)
+		r.retention.quit = nil
+	}
+	r.mu.Unlock()
+	err := r.Flush()
+	r.mu.Lock()
+	client := r.client
+	r.pinged = false
+	r.mu.Unlock()
+	if client != nil {
+		// The requests in flight can finish with the stopped client, but its
+		// healthcheck and sniffer goroutines are not needed anymore.
+		client.Stop()
+	}
+	return err
+}
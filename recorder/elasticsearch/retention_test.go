@@ -0,0 +1,285 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/elasticsearch"
+	"github.com/arsham/expipe/tools"
+)
+
+// retentionServer is an elasticsearch server that holds a list of indices
+// with their creation dates.
+type retentionServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	indices map[string]time.Time
+	deleted []string
+}
+
+func newRetentionServer(indices map[string]time.Time) *retentionServer {
+	var host, url, port string
+	s := &retentionServer{indices: indices}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		path := strings.Trim(r.URL.Path, "/")
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/":
+			w.Write([]byte(pinging))
+		case r.Method == "GET" && strings.Contains(path, "*"):
+			prefix := strings.Split(path, "*")[0]
+			res := make(map[string]interface{})
+			for name, created := range s.indices {
+				if !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				ms := created.UnixNano() / int64(time.Millisecond)
+				res[name] = map[string]interface{}{
+					"settings": map[string]interface{}{
+						"index": map[string]interface{}{"creation_date": strconv.FormatInt(ms, 10)},
+					},
+				}
+			}
+			json.NewEncoder(w).Encode(res)
+		case r.Method == "DELETE":
+			for _, name := range strings.Split(path, ",") {
+				delete(s.indices, name)
+				s.deleted = append(s.deleted, name)
+			}
+			w.Write([]byte(`{"acknowledged": true}`))
+		default:
+			w.Write([]byte(recording))
+		}
+	})
+	s.Server = httptest.NewServer(handler)
+	url = strings.Split(s.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return s
+}
+
+func (s *retentionServer) deletedIndices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := append([]string{}, s.deleted...)
+	sort.Strings(deleted)
+	return deleted
+}
+
+func testIndices() map[string]time.Time {
+	now := time.Now()
+	day := 24 * time.Hour
+	return map[string]time.Time{
+		"expipe-app-2017.10.01":   now.Add(-20 * day),
+		"expipe-app-2017.10.10":   now.Add(-11 * day),
+		"expipe-app-2017.10.15":   now.Add(-6 * day),
+		"expipe-app-2017.10.20":   now.Add(-1 * day),
+		"expipe-other-2017.10.02": now.Add(-19 * day),
+		"expipe-app-notadate":     now.Add(-30 * day),
+	}
+}
+
+func TestRetention(t *testing.T) {
+	day := 24 * time.Hour
+	tcs := []struct {
+		name       string
+		age        time.Duration
+		maxIndices int
+		dryRun     bool
+		want       []string
+	}{
+		{"age", 10 * day, 0, false, []string{"expipe-app-2017.10.01", "expipe-app-2017.10.10", "expipe-other-2017.10.02"}},
+		{"max indices", 0, 3, false, []string{"expipe-app-2017.10.01", "expipe-other-2017.10.02"}},
+		{"both", 15 * day, 4, false, []string{"expipe-app-2017.10.01", "expipe-other-2017.10.02"}},
+		{"both max", 15 * day, 2, false, []string{"expipe-app-2017.10.01", "expipe-app-2017.10.10", "expipe-other-2017.10.02"}},
+		{"nothing", 30 * day, 0, false, nil},
+		{"dry run", 10 * day, 0, true, nil},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newRetentionServer(testIndices())
+			defer ts.Close()
+			options := []func(recorder.Constructor) error{
+				recorder.WithLogger(tools.DiscardLogger()),
+				recorder.WithEndpoint(ts.URL),
+				recorder.WithName("name"),
+				recorder.WithIndexName("expipe-{type_name}-{2006.01.02}"),
+				elasticsearch.WithRetention(tc.age, tc.maxIndices),
+				elasticsearch.WithRetentionInterval(time.Hour),
+			}
+			if tc.dryRun {
+				options = append(options, elasticsearch.WithRetentionDryRun())
+			}
+			rec, err := elasticsearch.New(options...)
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if err = rec.Ping(); err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			defer rec.Close()
+
+			deleted, err := rec.Prune(context.Background())
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			// the loop might have deleted them already.
+			got := ts.deletedIndices()
+			if len(got) != len(tc.want) || len(got) > 0 && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("deleted = (%v); want (%v)", got, tc.want)
+			}
+			if tc.dryRun && len(deleted) != 3 {
+				t.Errorf("len(deleted) = (%d); want (3)", len(deleted))
+			}
+		})
+	}
+}
+
+func TestRetentionLoop(t *testing.T) {
+	ts := newRetentionServer(testIndices())
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe-{type_name}-{2006.01.02}"),
+		elasticsearch.WithRetention(0, 1),
+		elasticsearch.WithRetentionInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rec.Close()
+	ts.mu.Lock()
+	ts.indices["expipe-app-2017.10.21"] = time.Now()
+	ts.mu.Unlock()
+
+	deadline := time.After(time.Second)
+	for {
+		ts.mu.Lock()
+		left := len(ts.indices)
+		ts.mu.Unlock()
+		if left == 2 { // the newest one, and the one that does not match
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("len(indices) = (%d); want (2)", left)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// The indices of the other tools on the cluster should not be deleted.
+func TestRetentionForeignIndices(t *testing.T) {
+	indices := testIndices()
+	old := time.Now().Add(-20 * 24 * time.Hour)
+	foreign := []string{"filebeat-2017.10.01", "logstash-2017.10.01", "expipe-2017.10.01", "expipe-app-2017.10.01-old"}
+	for _, name := range foreign {
+		indices[name] = old
+	}
+	ts := newRetentionServer(indices)
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe-{type_name}-{2006.01.02}"),
+		elasticsearch.WithRetention(10*24*time.Hour, 0),
+		elasticsearch.WithRetentionInterval(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rec.Close()
+	if _, err = rec.Prune(context.Background()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, name := range foreign {
+		if _, ok := ts.indices[name]; !ok {
+			t.Errorf("%s is deleted", name)
+		}
+	}
+	if _, ok := ts.indices["expipe-app-2017.10.01"]; ok {
+		t.Error("expipe-app-2017.10.01 is not deleted")
+	}
+
+	// without a literal prefix the template would match all of them.
+	_, err = elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("{type_name}-{2006.01.02}"),
+		elasticsearch.WithRetention(10*24*time.Hour, 0),
+	)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestRetentionErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		index   string
+		options []func(recorder.Constructor) error
+	}{
+		{"static index name", "expipe", []func(recorder.Constructor) error{elasticsearch.WithRetention(time.Hour, 0)}},
+		{"no prefix", "{type_name}-{2006.01.02}", []func(recorder.Constructor) error{elasticsearch.WithRetention(time.Hour, 0)}},
+		{"no limits", "expipe-{2006}", []func(recorder.Constructor) error{elasticsearch.WithRetention(0, 0)}},
+		{"negative age", "expipe-{2006}", []func(recorder.Constructor) error{elasticsearch.WithRetention(-time.Hour, 0)}},
+		{"negative max", "expipe-{2006}", []func(recorder.Constructor) error{elasticsearch.WithRetention(0, -1)}},
+		{"zero interval", "expipe-{2006}", []func(recorder.Constructor) error{elasticsearch.WithRetentionInterval(0)}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]func(recorder.Constructor) error{
+				recorder.WithEndpoint("http://127.0.0.1:9200"),
+				recorder.WithName("name"),
+				recorder.WithIndexName(tc.index),
+			}, tc.options...)
+			_, err := elasticsearch.New(options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestPruneWithoutPing(t *testing.T) {
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint("http://127.0.0.1:9200"),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe-{2006}"),
+		elasticsearch.WithRetention(time.Hour, 0),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if _, err = rec.Prune(context.Background()); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
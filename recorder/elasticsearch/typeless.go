@@ -0,0 +1,102 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/olivere/elastic"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTypeField is the field that holds the TypeName of the jobs when
+	// elasticsearch does not support mapping types, if not specified.
+	DefaultTypeField = "app"
+
+	// typelessVersion is the first major version of elasticsearch that has
+	// removed the mapping types.
+	typelessVersion = 7
+
+	// docType is the endpoint name that replaces the type in the index API of
+	// the typeless versions.
+	docType = "_doc"
+)
+
+// majorVersion returns the major part of an elasticsearch version number,
+// e.g. 7 for "7.10.2".
+func majorVersion(version string) (int, error) {
+	major := strings.SplitN(strings.TrimSpace(version), ".", 2)[0]
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, errors.Errorf("invalid version: %q", version)
+	}
+	return n, nil
+}
+
+// detectVersion asks the cluster for its version and returns true for the
+// versions that do not support mapping types.
+func (r *Recorder) detectVersion(client *elastic.Client) (bool, error) {
+	version, err := client.ElasticsearchVersion(r.endpoint)
+	if err != nil {
+		return false, errors.Wrap(err, "getting elasticsearch version")
+	}
+	major, err := majorVersion(version)
+	if err != nil {
+		return false, err
+	}
+	typeless := major >= typelessVersion
+	if typeless {
+		r.log.Debugf("%s: elasticsearch %s does not support types, using the %q field", r.name, version, r.typeField)
+	}
+	return typeless, nil
+}
+
+// mappingType returns the type the documents of the typeName are indexed
+// with. In the typeless mode it is the _doc endpoint.
+func (r *Recorder) mappingType(typeName string) string {
+	if _, typeless := r.connection(); typeless {
+		return docType
+	}
+	return typeName
+}
+
+// bulkType returns the type of the documents of the typeName in the bulk
+// requests. In the typeless mode it is empty, as Elasticsearch 8 rejects the
+// _type in the bulk metadata.
+func (r *Recorder) bulkType(typeName string) string {
+	if _, typeless := r.connection(); typeless {
+		return ""
+	}
+	return typeName
+}
+
+// document returns the payload that should be indexed. In the typeless mode
+// the type name is added to the document.
+func (r *Recorder) document(typeName string, payload []byte) ([]byte, error) {
+	if _, typeless := r.connection(); !typeless {
+		return payload, nil
+	}
+	payload = bytes.TrimSpace(payload)
+	if len(payload) < 2 || payload[0] != '{' {
+		return nil, errors.New("payload is not a JSON object")
+	}
+	key, _ := json.Marshal(r.typeField)
+	value, _ := json.Marshal(typeName)
+	buf := bytes.NewBuffer(make([]byte, 0, len(payload)+len(key)+len(value)+2))
+	buf.WriteByte('{')
+	buf.Write(key)
+	buf.WriteByte(':')
+	buf.Write(value)
+	rest := bytes.TrimSpace(payload[1:])
+	if len(rest) > 0 && rest[0] != '}' {
+		buf.WriteByte(',')
+	}
+	buf.Write(rest)
+	return buf.Bytes(), nil
+}
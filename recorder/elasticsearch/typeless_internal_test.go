@@ -0,0 +1,67 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch
+
+import "testing"
+
+func TestMajorVersion(t *testing.T) {
+	tcs := []struct {
+		version string
+		want    int
+		err     bool
+	}{
+		{"5.0.1", 5, false},
+		{"7.10.2", 7, false},
+		{"8.0.0-rc1", 8, false},
+		{"10", 10, false},
+		{"", 0, true},
+		{"v7.1", 0, true},
+	}
+	for _, tc := range tcs {
+		got, err := majorVersion(tc.version)
+		if (err != nil) != tc.err {
+			t.Errorf("majorVersion(%q): err = (%v); want error (%t)", tc.version, err, tc.err)
+		}
+		if got != tc.want {
+			t.Errorf("majorVersion(%q) = (%d); want (%d)", tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestDocument(t *testing.T) {
+	r := &Recorder{typeField: "app"}
+	payload := []byte(`{"@timestamp":"2017","a":1}`)
+	got, err := r.document("My App", payload)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if string(got) != string(payload) {
+		t.Errorf("document() = (%s); want (%s)", got, payload)
+	}
+
+	r.typeless = true
+	tcs := []struct {
+		payload string
+		want    string
+	}{
+		{`{"@timestamp":"2017","a":1}`, `{"app":"My \"App\"","@timestamp":"2017","a":1}`},
+		{` { "a":1}`, `{"app":"My \"App\"","a":1}`},
+		{`{}`, `{"app":"My \"App\""}`},
+	}
+	for _, tc := range tcs {
+		got, err := r.document(`My "App"`, []byte(tc.payload))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("document(%s) = (%s); want (%s)", tc.payload, got, tc.want)
+		}
+	}
+	for _, payload := range []string{"", "[]", "{"} {
+		if _, err := r.document("app", []byte(payload)); err == nil {
+			t.Errorf("document(%q): err = (nil); want (error)", payload)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package elasticsearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/elasticsearch"
+)
+
+// typelessServer is an elasticsearch server with the given version. It keeps
+// the paths and bodies of the requests.
+type typelessServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]string
+}
+
+func newTypelessServer(version string) *typelessServer {
+	var host, url, port string
+	s := &typelessServer{requests: make(map[string]string)}
+	ping := strings.Replace(pinging, `"number" : "5.0.1"`, `"number" : "`+version+`"`, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.URL.Path == "/_nodes/http":
+			w.Write([]byte(fmt.Sprintf(sniffer, host, host, host, port, url)))
+		case r.URL.Path == "/":
+			w.Write([]byte(ping))
+		case r.URL.Path == "/_bulk":
+			body, _ := ioutil.ReadAll(r.Body)
+			s.requests[r.Method+" "+r.URL.Path] = string(body)
+			id := strings.Split(strings.Split(string(body), `"_id":"`)[1], `"`)[0]
+			w.Write([]byte(`{"took":1,"errors":false,"items":[{"index":{"_id":"` + id + `","status":201}}]}`))
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			s.requests[r.Method+" "+r.URL.Path] = string(body)
+			w.Write([]byte(recording))
+		}
+	})
+	s.Server = httptest.NewServer(handler)
+	url = strings.Split(s.URL, "//")[1]
+	host, port = strings.Split(url, ":")[0], strings.Split(url, ":")[1]
+	return s
+}
+
+func (s *typelessServer) request(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.requests[key]
+	return body, ok
+}
+
+func TestTypeless(t *testing.T) {
+	t.Parallel()
+	for _, version := range []string{"7.10.2", "8.1.0"} {
+		ts := newTypelessServer(version)
+		defer ts.Close()
+		rec, err := elasticsearch.New(
+			recorder.WithEndpoint(ts.URL),
+			recorder.WithName("name"),
+			recorder.WithIndexName("expipe"),
+		)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if err = rec.Ping(); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		body, ok := ts.request("PUT /_template/expipe-name")
+		if !ok {
+			t.Fatalf("%s: template was not installed", version)
+		}
+		tmpl := make(map[string]interface{})
+		json.Unmarshal([]byte(body), &tmpl)
+		if _, ok := tmpl["index_patterns"]; !ok {
+			t.Errorf("%s: index_patterns not in the template: %s", version, body)
+		}
+		if strings.Contains(body, "_default_") {
+			t.Errorf("%s: _default_ in the template: %s", version, body)
+		}
+
+		err = rec.Record(context.Background(), bulkJob("key"))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		doc, ok := ts.request("POST /expipe/_doc")
+		if !ok {
+			t.Fatalf("%s: document was not indexed without type: %v", version, ts.requests)
+		}
+		if !strings.Contains(doc, `"app":"my_type"`) {
+			t.Errorf("%s: app field not in the document: %s", version, doc)
+		}
+	}
+}
+
+func TestTypelessBulk(t *testing.T) {
+	t.Parallel()
+	ts := newTypelessServer("7.0.0")
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		elasticsearch.WithBulk(1, 0, time.Hour),
+		elasticsearch.WithTypeField("application"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body, ok := ts.request("POST /_bulk")
+	if !ok {
+		t.Fatal("bulk request was not sent")
+	}
+	// Elasticsearch 8 rejects the _type in the bulk metadata.
+	if strings.Contains(body, `"_type"`) {
+		t.Errorf("_type is in the bulk request: %s", body)
+	}
+	if !strings.Contains(body, `"application":"my_type"`) {
+		t.Errorf("application field not in the document: %s", body)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	t.Parallel()
+	ts := newTypelessServer("6.8.0")
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	doc, ok := ts.request("POST /expipe/my_type")
+	if !ok {
+		t.Fatalf("document was not indexed with its type: %v", ts.requests)
+	}
+	if strings.Contains(doc, `"app"`) {
+		t.Errorf("app field in the document: %s", doc)
+	}
+}
+
+func TestTypedBulk(t *testing.T) {
+	t.Parallel()
+	ts := newTypelessServer("6.8.0")
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		elasticsearch.WithBulk(1, 0, time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(context.Background(), bulkJob("key")); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body, ok := ts.request("POST /_bulk")
+	if !ok {
+		t.Fatal("bulk request was not sent")
+	}
+	if !strings.Contains(body, `"_type":"my_type"`) {
+		t.Errorf("_type is not my_type in the bulk request: %s", body)
+	}
+}
+
+func TestTypelessBadVersion(t *testing.T) {
+	t.Parallel()
+	ts := newTypelessServer("unknown")
+	defer ts.Close()
+	rec, err := elasticsearch.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestWithTypeFieldErrors(t *testing.T) {
+	for _, field := range []string{"", "_type", "my.app", `my"app`} {
+		_, err := elasticsearch.New(
+			recorder.WithEndpoint("http://127.0.0.1:9200"),
+			recorder.WithName("name"),
+			elasticsearch.WithTypeField(field),
+		)
+		if err == nil {
+			t.Errorf("WithTypeField(%q): err = (nil); want (error)", field)
+		}
+	}
+}
+
+// The engines ping the recorders again when their breakers half-open, while
+// the other engines are recording with them.
+func TestPingWhileRecording(t *testing.T) {
+	t.Parallel()
+	for _, bulk := range []bool{false, true} {
+		ts := newTypelessServer("7.0.0")
+		defer ts.Close()
+		options := []func(recorder.Constructor) error{
+			recorder.WithEndpoint(ts.URL),
+			recorder.WithName("name"),
+			recorder.WithIndexName("expipe-{2006.01.02}"),
+		}
+		if bulk {
+			options = append(options, elasticsearch.WithBulk(1, 0, time.Hour))
+		}
+		rec, err := elasticsearch.New(options...)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if err = rec.Ping(); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if err := rec.Ping(); err != nil {
+					t.Errorf("bulk %t: Ping(): err = (%v); want (nil)", bulk, err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if err := rec.Record(context.Background(), bulkJob("key")); err != nil {
+					t.Errorf("bulk %t: Record(): err = (%v); want (nil)", bulk, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package file
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a file recorder from
+// a configuration file. MaxSize can be in bytes or have one of KB, MB or GB
+// units, e.g. 100MB.
+type Config struct {
+	FilePath       string `mapstructure:"path"`
+	FileTimeout    string `mapstructure:"timeout"`
+	FileIndexName  string `mapstructure:"index_name"`
+	FileMaxSize    string `mapstructure:"max_size"`
+	FileDateFormat string `mapstructure:"date_format"`
+	FileCompress   bool   `mapstructure:"compress"`
+	FileRetention  int    `mapstructure:"retention"`
+	log            tools.FieldLogger
+	FileName       string
+	ConfTimeout    time.Duration
+	ConfMaxSize    int64
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		WithPath(c.Endpoint()),
+		recorder.WithName(c.Name()),
+		recorder.WithIndexName(c.IndexName()),
+		WithMaxSize(c.ConfMaxSize),
+		WithRetention(c.FileRetention),
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, recorder.WithTimeout(c.Timeout()))
+	}
+	if c.FileDateFormat != "" {
+		options = append(options, WithDateFormat(c.FileDateFormat))
+	}
+	if c.FileCompress {
+		options = append(options, WithCompress())
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.FileName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.FileIndexName }
+
+// Endpoint return the directory of the files.
+func (c *Config) Endpoint() string { return c.FilePath }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty. The timeout is
+// optional.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.FileTimeout != "" {
+			if timeout, err = time.ParseDuration(c.FileTimeout); err != nil {
+				return &recorder.ParseTimeOutError{Timeout: c.FileTimeout, Err: err}
+			}
+		}
+		if c.FilePath == "" {
+			return errors.New("path cannot be empty")
+		}
+		if c.ConfMaxSize, err = tools.ParseSize(c.FileMaxSize); err != nil {
+			return errors.Wrapf(err, "parse max_size (%v)", c.FileMaxSize)
+		}
+		c.FileName = name
+		c.ConfTimeout = timeout
+		return nil
+	}
+}
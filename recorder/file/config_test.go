@@ -0,0 +1,220 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package file_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder/file"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(file.Config)
+	err := file.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = file.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+func TestWithViper(t *testing.T) {
+	tcs := []struct {
+		tcName string
+		name   string
+		key    string
+		v      unmarshaller
+	}{
+		{"no name", "", "key", viper.New()},
+		{"no key", "name", "", viper.New()},
+		{"no viper", "name", "key", nil},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.tcName, func(t *testing.T) {
+			c := new(file.Config)
+			err := file.WithViper(tc.v, tc.name, tc.key)(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            path: /var/lib/expipe
+            index_name: example_index
+            timeout: 10s
+            max_size: 10MB
+            date_format: 2006-01-02T15
+            compress: true
+            retention: 3
+    `))
+	v.ReadConfig(input)
+	c := new(file.Config)
+	err := file.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != "/var/lib/expipe" {
+		t.Errorf("c.Endpoint() = (%s); want (/var/lib/expipe)", c.Endpoint())
+	}
+	if c.IndexName() != "example_index" {
+		t.Errorf("c.IndexName() = (%s); want (example_index)", c.IndexName())
+	}
+	if c.ConfMaxSize != 10<<20 {
+		t.Errorf("c.ConfMaxSize = (%d); want (%d)", c.ConfMaxSize, 10<<20)
+	}
+	if !c.FileCompress || c.FileRetention != 3 || c.FileDateFormat != "2006-01-02T15" {
+		t.Errorf("c = (%v); want compress, retention and date_format", c)
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+func (badMarshaller) AllKeys() []string                                 { return []string{} }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders
+        recorder1:
+                index_name: example_index
+interval: 2sq
+                timeout: 1ms
+    `))
+	v.ReadConfig(input)
+	c := new(file.Config)
+	err := file.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+                timeout: asas
+    `))
+	v.ReadConfig(input)
+	err = file.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+    `))
+	v.ReadConfig(input)
+	c = new(file.Config)
+	err = file.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): no path")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                path: /var/lib/expipe
+                max_size: 10 apples
+    `))
+	v.ReadConfig(input)
+	c = new(file.Config)
+	err = file.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): bad max_size")
+	}
+
+	err = file.WithViper(&badMarshaller{}, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := file.NewConfig(
+		file.WithLogger(log),
+	)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+}
+
+func TestNewConfigErrors(t *testing.T) {
+	c, err := file.NewConfig(
+		file.WithLogger(nil),
+	)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestConfigRecorder(t *testing.T) {
+	log := tools.DiscardLogger()
+	c, err := file.NewConfig(
+		file.WithLogger(log),
+	)
+	c.FileName = "name"
+	c.FileIndexName = "name"
+	c.FilePath = "/var/lib/expipe"
+	c.FileDateFormat = "daily"
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	e, err := c.Recorder()
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if e.(*file.Recorder) != nil {
+		t.Errorf("e = (%v); want (nil)", e)
+	}
+
+	c.FileDateFormat = "2006-01"
+	c.FileCompress = true
+	c.ConfTimeout = time.Second
+	e, err = c.Recorder()
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if e.(*file.Recorder) == nil {
+		t.Error("e = (nil); want (Recorder)")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package file
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// InvalidDateFormatError is returned when the date format does not produce
+// unique and parsable names.
+type InvalidDateFormatError string
+
+func (e InvalidDateFormatError) Error() string {
+	return fmt.Sprintf("invalid date format: %s", string(e))
+}
+
+// WithPath sets the directory the files are stored in. Unlike
+// recorder.WithEndpoint, it does not expect a URL.
+func WithPath(path string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		if path == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		e.SetEndpoint(path)
+		return nil
+	}
+}
+
+// WithMaxSize sets the maximum size of the files in bytes. The files are not
+// rotated by size if it is zero.
+func WithMaxSize(size int64) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if size < 0 {
+			return fmt.Errorf("max size cannot be negative: %d", size)
+		}
+		r.maxSize = size
+		return nil
+	}
+}
+
+// WithDateFormat sets the layout of the date in the file names, in the time
+// package's format. It decides how often the files are rotated by time.
+func WithDateFormat(layout string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		ref := time.Date(2017, 11, 5, 15, 4, 5, 0, time.UTC)
+		formatted := ref.Format(layout)
+		if layout == "" || formatted == layout {
+			return InvalidDateFormatError(layout)
+		}
+		if _, err := time.Parse(layout, formatted); err != nil {
+			return InvalidDateFormatError(layout)
+		}
+		r.dateFormat = layout
+		return nil
+	}
+}
+
+// WithCompress sets the recorder to compress the rotated files with gzip.
+func WithCompress() func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		r.compress = true
+		return nil
+	}
+}
+
+// WithRetention sets the number of rotated files to keep for each index. All
+// files are kept if it is zero.
+func WithRetention(count int) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if count < 0 {
+			return fmt.Errorf("retention cannot be negative: %d", count)
+		}
+		r.retention = count
+		return nil
+	}
+}
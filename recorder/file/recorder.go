@@ -0,0 +1,209 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package file contains logic to record data into files as JSON lines. Each
+// job is written as one line, the same document that is sent to elasticsearch.
+// The files are stored in the directory given as the endpoint and are named
+// after the IndexName and the date of the job:
+//
+//    /var/lib/expipe/expipe-2017-11-05.jsonl
+//
+// The date format decides how often the files are rotated by time, for example
+// "2006-01-02T15" creates a new file every hour. When a maximum size is set,
+// the file is rotated once it reaches the size, and it is renamed with a
+// sequence number:
+//
+//    /var/lib/expipe/expipe-2017-11-05.1.jsonl
+//
+// Rotated files can be compressed with gzip, and only the most recent ones are
+// kept if a retention count is provided.
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-----------------+------------------+
+//   | Expipe var name |  File Var Name   |
+//   +-----------------+------------------+
+//   | fileRecords     | File Records     |
+//   | fileRotations   | File Rotations   |
+//   +-----------------+------------------+
+package file
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+var (
+	fileRecords   = expvar.NewInt("File Records")
+	fileRotations = expvar.NewInt("File Rotations")
+)
+
+// DefaultDateFormat is used for naming the files when no date format is set.
+const DefaultDateFormat = "2006-01-02"
+
+// extension is the extension of the files.
+const extension = ".jsonl"
+
+// Recorder writes the jobs into files. It implements DataRecorder interface.
+type Recorder struct {
+	name       string
+	endpoint   string
+	indexName  string
+	log        tools.FieldLogger
+	timeout    time.Duration
+	maxSize    int64
+	dateFormat string
+	compress   bool
+	retention  int
+
+	mu     sync.Mutex
+	pinged bool
+	files  map[string]*current // keyed by the index name
+}
+
+// current is the file being written for an index.
+type current struct {
+	name string
+	file *os.File
+	size int64
+}
+
+// New returns an error if any of the options are invalid. The endpoint is the
+// directory the files are stored in, and should be set with the WithPath
+// option.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "file")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.dateFormat == "" {
+		r.dateFormat = DefaultDateFormat
+	}
+	r.files = make(map[string]*current)
+	return r, nil
+}
+
+// Ping creates the directory if it does not exist, and checks if it is
+// writable.
+func (r *Recorder) Ping() error {
+	if err := os.MkdirAll(r.endpoint, 0755); err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	f, err := ioutil.TempFile(r.endpoint, ".expipe")
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	r.mu.Lock()
+	r.pinged = true
+	r.mu.Unlock()
+	return nil
+}
+
+// Record appends the payload of the job to the file of its index and date. It
+// returns an error if the ping is not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pinged {
+		return recorder.ErrPingNotCalled
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if _, err := job.Payload.Generate(buf, job.Time); err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	buf.WriteByte('\n')
+	index := job.IndexName
+	if index == "" {
+		index = r.indexName
+	}
+	err := r.write(index, job.Time, buf.Bytes())
+	if err != nil {
+		if _, ok := errors.Cause(err).(*os.PathError); ok {
+			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		r.log.WithField("recorder", "file").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID).
+			Debugf("%s: error writing to file: %v", r.name, err)
+		return err
+	}
+	fileRecords.Add(1)
+	return nil
+}
+
+// Close closes all open files.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for index, c := range r.files {
+		if e := c.file.Close(); e != nil {
+			err = e
+		}
+		delete(r.files, index)
+	}
+	return err
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the directory the files are stored in.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the directory the files are stored in.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the indexName the recorder should record as.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
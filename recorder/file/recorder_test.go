@@ -0,0 +1,307 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package file_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/file"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "file_recorder")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func newRecorder(t *testing.T, dir string, options ...func(recorder.Constructor) error) *file.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		file.WithPath(dir),
+	}, options...)
+	rec, err := file.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job(t time.Time, value float64) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("value", value)}),
+		TypeName: "my_type",
+		Time:     t,
+	}
+}
+
+func files(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{file.WithPath("/tmp")}},
+		{"no path", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"empty path", []func(recorder.Constructor) error{file.WithPath("")}},
+		{"negative size", []func(recorder.Constructor) error{file.WithMaxSize(-1)}},
+		{"negative retention", []func(recorder.Constructor) error{file.WithRetention(-1)}},
+		{"bad date format", []func(recorder.Constructor) error{file.WithDateFormat("daily")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := file.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	rec, err := file.New(
+		recorder.WithName("name"),
+		file.WithPath(filepath.Join(dir, "a", "b")),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = rec.Record(context.Background(), job(time.Now(), 1))
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if len(files(t, filepath.Join(dir, "a", "b"))) != 0 {
+		t.Error("Ping() should not leave any files behind")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	rec, _ = file.New(
+		recorder.WithName("name"),
+		file.WithPath(filepath.Join(dir, "file", "b")),
+	)
+	err = rec.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	rec := newRecorder(t, dir)
+	defer rec.Close()
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := rec.Record(context.Background(), job(now, float64(i))); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	other := job(now, 10)
+	other.IndexName = "other"
+	if err := rec.Record(context.Background(), other); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := []string{"expipe-2017-11-05.jsonl", "other-2017-11-05.jsonl"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Fatalf("files = (%v); want (%v)", got, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, want[0]))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if doc["value"] != float64(i) {
+			t.Errorf(`doc["value"] = (%v); want (%d)`, doc["value"], i)
+		}
+		if _, ok := doc["@timestamp"]; !ok {
+			t.Error("@timestamp was not recorded")
+		}
+	}
+	if i != 3 {
+		t.Errorf("lines = (%d); want (3)", i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = rec.Record(ctx, job(now, 1)); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestRecordRotation(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	rec := newRecorder(t, dir,
+		file.WithDateFormat("2006-01-02T15"),
+		file.WithMaxSize(100),
+		file.WithCompress(),
+		file.WithRetention(2),
+	)
+	defer rec.Close()
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	record := func(t *testing.T, ts time.Time) {
+		if err := rec.Record(context.Background(), job(ts, 1)); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+
+	// each line is about 60 bytes, therefore every line after the first one
+	// causes a rotation.
+	record(t, now)
+	record(t, now)
+	want := []string{"expipe-2017-11-05T10.1.jsonl.gz", "expipe-2017-11-05T10.jsonl"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Fatalf("files = (%v); want (%v)", got, want)
+	}
+	gz, err := os.Open(filepath.Join(dir, want[0]))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	r, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	content, _ := ioutil.ReadAll(r)
+	gz.Close()
+	var doc map[string]interface{}
+	if err = json.Unmarshal(content, &doc); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	time.Sleep(10 * time.Millisecond) // for modification times to differ
+	record(t, now.Add(time.Hour))
+	want = []string{"expipe-2017-11-05T10.1.jsonl.gz", "expipe-2017-11-05T10.jsonl.gz", "expipe-2017-11-05T11.jsonl"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Fatalf("files = (%v); want (%v)", got, want)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	record(t, now.Add(time.Hour))
+	want = []string{"expipe-2017-11-05T10.jsonl.gz", "expipe-2017-11-05T11.1.jsonl.gz", "expipe-2017-11-05T11.jsonl"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Errorf("files = (%v); want (%v)", got, want)
+	}
+}
+
+// The jobs with an earlier date reopen its file, which should not overwrite
+// the archive of that date when it is compressed again.
+func TestRecordOutOfOrder(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	rec := newRecorder(t, dir,
+		file.WithDateFormat("2006-01-02T15"),
+		file.WithCompress(),
+	)
+	defer rec.Close()
+	now := time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC)
+	for i, ts := range []time.Time{now, now.Add(time.Hour), now, now.Add(time.Hour)} {
+		if err := rec.Record(context.Background(), job(ts, float64(i))); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	want := []string{"expipe-2017-11-05T10.1.jsonl.gz", "expipe-2017-11-05T10.jsonl.gz", "expipe-2017-11-05T11.jsonl", "expipe-2017-11-05T11.jsonl.gz"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Fatalf("files = (%v); want (%v)", got, want)
+	}
+	for i, name := range want[:2] {
+		gz, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		r, err := gzip.NewReader(gz)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		gz.Close()
+		var doc map[string]interface{}
+		if err = json.Unmarshal(content, &doc); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		// the first archive has the second job of the date.
+		if want := float64(2 - 2*i); doc["value"] != want {
+			t.Errorf("%s: value = (%v); want (%v)", name, doc["value"], want)
+		}
+	}
+}
+
+type badType struct{}
+
+func (badType) Read(b []byte) (int, error)         { return 0, errors.New("bad") }
+func (badType) Equal(other datatype.DataType) bool { return false }
+func (badType) Reset()                             {}
+
+func TestRecordBadPayload(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	rec := newRecorder(t, dir)
+	defer rec.Close()
+	j := job(time.Now(), 1)
+	j.Payload = datatype.New([]datatype.DataType{&badType{}})
+	if err := rec.Record(context.Background(), j); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// write appends data to the file of the index for the time t. It rotates the
+// file if the date has changed or the file would exceed the maximum size.
+func (r *Recorder) write(index string, t time.Time, data []byte) error {
+	name := filepath.Join(r.endpoint, index+"-"+t.Format(r.dateFormat)+extension)
+	c := r.files[index]
+	if c != nil && c.name != name {
+		c.file.Close()
+		delete(r.files, index)
+		r.finish(index, c.name)
+		c = nil
+	}
+	if c == nil {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Wrap(err, "opening file")
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return errors.Wrap(err, "opening file")
+		}
+		c = &current{name: name, file: f, size: info.Size()}
+		r.files[index] = c
+	}
+	if r.maxSize > 0 && c.size > 0 && c.size+int64(len(data)) > r.maxSize {
+		if err := r.rotate(index, c); err != nil {
+			return errors.Wrap(err, "rotating file")
+		}
+	}
+	n, err := c.file.Write(data)
+	c.size += int64(n)
+	return err
+}
+
+// rotate renames the current file with the next sequence number and opens a
+// new one in its place.
+func (r *Recorder) rotate(index string, c *current) error {
+	c.file.Close()
+	delete(r.files, index)
+	rotated := nextName(c.name)
+	if err := os.Rename(c.name, rotated); err != nil {
+		return err
+	}
+	r.finish(index, rotated)
+	f, err := os.OpenFile(c.name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	c.file, c.size = f, 0
+	r.files[index] = c
+	return nil
+}
+
+// nextName returns the name of the file with the next sequence number that
+// is not taken, compressed or not.
+func nextName(name string) string {
+	base := strings.TrimSuffix(name, extension)
+	for n := 1; ; n++ {
+		next := fmt.Sprintf("%s.%d%s", base, n, extension)
+		if !exists(next) && !exists(next+".gz") {
+			return next
+		}
+	}
+}
+
+// finish compresses the file if required, and removes the old files beyond
+// the retention count. The errors are logged as they should not stop the
+// recording.
+func (r *Recorder) finish(index, name string) {
+	fileRotations.Add(1)
+	if r.compress {
+		r.compressFile(name)
+	}
+	if err := r.prune(index); err != nil {
+		r.log.Warnf("%s: error removing old files: %v", r.name, err)
+	}
+}
+
+// compressFile compresses the file. If the archive of the name exists, e.g.
+// when the jobs of an earlier date have reopened the file, the file is moved
+// to the next sequence name first, so the archive is not overwritten.
+func (r *Recorder) compressFile(name string) {
+	if exists(name + ".gz") {
+		next := nextName(name)
+		if err := os.Rename(name, next); err != nil {
+			r.log.Warnf("%s: error renaming %s: %v", r.name, name, err)
+			return
+		}
+		name = next
+	}
+	if err := compress(name); err != nil {
+		r.log.Warnf("%s: error compressing %s: %v", r.name, name, err)
+	}
+}
+
+// compress writes the gzipped content of name into name.gz and removes the
+// original file.
+func compress(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := name + ".gz.tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+type byModTime []os.FileInfo
+
+func (b byModTime) Len() int           { return len(b) }
+func (b byModTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byModTime) Less(i, j int) bool { return b[i].ModTime().Before(b[j].ModTime()) }
+
+// prune removes the oldest rotated files of the index until there are only as
+// many as the retention count. The file being written is not counted.
+func (r *Recorder) prune(index string) error {
+	if r.retention <= 0 {
+		return nil
+	}
+	infos, err := ioutil.ReadDir(r.endpoint)
+	if err != nil {
+		return err
+	}
+	var active string
+	if c, ok := r.files[index]; ok {
+		active = filepath.Base(c.name)
+	}
+	var rotated []os.FileInfo
+	for _, info := range infos {
+		if info.IsDir() || info.Name() == active || !r.belongs(index, info.Name()) {
+			continue
+		}
+		rotated = append(rotated, info)
+	}
+	if len(rotated) <= r.retention {
+		return nil
+	}
+	sort.Sort(byModTime(rotated))
+	for _, info := range rotated[:len(rotated)-r.retention] {
+		if err := os.Remove(filepath.Join(r.endpoint, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// belongs returns true if the file name is one of the index's files, in form
+// of index-date[.n].jsonl[.gz].
+func (r *Recorder) belongs(index, name string) bool {
+	if !strings.HasPrefix(name, index+"-") {
+		return false
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, extension) {
+		return false
+	}
+	date := strings.TrimSuffix(strings.TrimPrefix(name, index+"-"), extension)
+	if _, err := time.Parse(r.dateFormat, date); err == nil {
+		return true
+	}
+	i := strings.LastIndexByte(date, '.')
+	if i < 0 {
+		return false
+	}
+	for _, c := range date[i+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	_, err := time.Parse(r.dateFormat, date[:i])
+	return err == nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
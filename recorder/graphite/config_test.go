@@ -0,0 +1,190 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package graphite_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder/graphite"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(graphite.Config)
+	err := graphite.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = graphite.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+func TestWithViper(t *testing.T) {
+	tcs := []struct {
+		tcName string
+		name   string
+		key    string
+		v      unmarshaller
+	}{
+		{"no name", "", "key", viper.New()},
+		{"no key", "name", "", viper.New()},
+		{"no viper", "name", "key", nil},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.tcName, func(t *testing.T) {
+			c := new(graphite.Config)
+			err := graphite.WithViper(tc.v, tc.name, tc.key)(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            address: 127.0.0.1:2003
+            protocol: udp
+            index_name: example_index
+            timeout: 10s
+            list_mode: index
+    `))
+	v.ReadConfig(input)
+	c := new(graphite.Config)
+	err := graphite.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != "127.0.0.1:2003" {
+		t.Errorf("c.Endpoint() = (%s); want (127.0.0.1:2003)", c.Endpoint())
+	}
+	if c.GraphiteProtocol != graphite.UDP || c.GraphiteListMode != graphite.ListIndex {
+		t.Errorf("c = (%v); want protocol and list_mode", c)
+	}
+	if c.IndexName() != "example_index" {
+		t.Errorf("c.IndexName() = (%s); want (example_index)", c.IndexName())
+	}
+	if c.Name() != "recorder1" {
+		t.Errorf("c.Name() = (%s); want (recorder1)", c.Name())
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                address: 127.0.0.1:2003
+                timeout: asas
+    `))
+	v.ReadConfig(input)
+	c := new(graphite.Config)
+	err := graphite.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+    `))
+	v.ReadConfig(input)
+	c = new(graphite.Config)
+	err = graphite.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): no address")
+	}
+
+	for _, extra := range []string{"protocol: http", "list_mode: sum"} {
+		input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                address: 127.0.0.1:2003
+                ` + extra + `
+    `))
+		v.ReadConfig(input)
+		c = new(graphite.Config)
+		err = graphite.WithViper(v, "recorder1", "recorders.recorder1")(c)
+		if err == nil {
+			t.Errorf("%s: err = (nil); want (error)", extra)
+		}
+	}
+
+	err = graphite.WithViper(&badMarshaller{}, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := graphite.NewConfig(graphite.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	c, err = graphite.NewConfig(graphite.WithLogger(nil))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestConfigRecorder(t *testing.T) {
+	c, err := graphite.NewConfig(graphite.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.GraphiteName = "name"
+	c.GraphiteAddress = "127.0.0.1:2003"
+	rec, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.IndexName() != "name" {
+		t.Errorf("rec.IndexName() = (%s); want (name)", rec.IndexName())
+	}
+	if rec.Timeout() == 0 {
+		t.Error("rec.Timeout() = (0); want (default timeout)")
+	}
+
+	c.GraphiteAddress = "http://127.0.0.1:2003"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
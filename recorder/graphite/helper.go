@@ -0,0 +1,80 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package graphite
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// InvalidProtocolError is returned when the protocol is neither udp nor tcp.
+type InvalidProtocolError string
+
+func (i InvalidProtocolError) Error() string {
+	return fmt.Sprintf("invalid protocol: %s", string(i))
+}
+
+// InvalidListModeError is returned when the list mode is neither aggregate nor
+// index.
+type InvalidListModeError string
+
+func (i InvalidListModeError) Error() string {
+	return fmt.Sprintf("invalid list mode: %s", string(i))
+}
+
+// WithAddress sets the address of the Graphite server, e.g. "127.0.0.1:2003".
+// Unlike recorder.WithEndpoint, it does not expect a URL.
+func WithAddress(address string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		if address == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return recorder.InvalidEndpointError(address)
+		}
+		e.SetEndpoint(address)
+		return nil
+	}
+}
+
+// WithProtocol sets the protocol of the connection. It should be either tcp
+// or udp.
+func WithProtocol(protocol string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		switch protocol {
+		case TCP, UDP:
+			r.protocol = protocol
+			return nil
+		}
+		return InvalidProtocolError(protocol)
+	}
+}
+
+// WithListMode sets how the list types are written. With ListAggregate each
+// list is written as its count, min, max and mean, and with ListIndex each
+// item of the list is written in its own series, e.g. key.0, key.1.
+func WithListMode(mode string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		switch mode {
+		case ListAggregate, ListIndex:
+			r.listMode = mode
+			return nil
+		}
+		return InvalidListModeError(mode)
+	}
+}
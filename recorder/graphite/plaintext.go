@@ -0,0 +1,93 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package graphite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+// series holds the values of a payload by their paths relative to the type
+// name.
+type series map[string]float64
+
+// sanitise replaces the characters that are not allowed in the metric paths
+// with underscores. Dots are kept only if keepDots is true, as they separate
+// the nodes of the path.
+func sanitise(s string, keepDots bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '-', c == ':':
+		case c == '.' && keepDots:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// lines returns the payload in the plaintext protocol, one line per series,
+// sorted by their paths:
+//
+//    prefix.type_name.key value timestamp
+func lines(prefix, typeName string, t time.Time, payload datatype.DataContainer, listMode string) ([]string, error) {
+	s := make(series)
+	for _, d := range payload.List() {
+		if err := s.add(d, listMode); err != nil {
+			return nil, err
+		}
+	}
+	base := sanitise(typeName, false) + "."
+	if prefix != "" {
+		base = sanitise(prefix, true) + "." + base
+	}
+	ts := " " + strconv.FormatInt(t.Unix(), 10) + "\n"
+	result := make([]string, 0, len(s))
+	for key, v := range s {
+		result = append(result, base+key+" "+strconv.FormatFloat(v, 'f', -1, 64)+ts)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// add adds the values of d to the series. Byte types are written in the same
+// unit they are presented in the payload, and strings are skipped.
+func (s series) add(d datatype.DataType, listMode string) error {
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		switch v := value.(type) {
+		case float64:
+			s.addValue(key, v)
+		case []float64:
+			s.addList(key, v, listMode)
+		}
+	})
+}
+
+func (s series) addValue(key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	s[sanitise(key, true)] = v
+}
+
+// addList adds each item in its own series in the index mode, otherwise it
+// adds the count, min, max and mean of the list.
+func (s series) addList(key string, list []float64, listMode string) {
+	if listMode == ListIndex {
+		for i, v := range list {
+			s.addValue(key+"."+strconv.Itoa(i), v)
+		}
+		return
+	}
+	datatype.Summarise(list, func(name string, v float64) {
+		s.addValue(key+"."+name, v)
+	})
+}
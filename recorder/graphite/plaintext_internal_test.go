@@ -0,0 +1,96 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package graphite
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+func TestSanitise(t *testing.T) {
+	tcs := []struct {
+		input    string
+		keepDots bool
+		want     string
+	}{
+		{"memstats.Alloc", true, "memstats.Alloc"},
+		{"my.app", false, "my_app"},
+		{"a b/c", true, "a_b_c"},
+		{"rate:5m-avg", true, "rate:5m-avg"},
+	}
+	for _, tc := range tcs {
+		if got := sanitise(tc.input, tc.keepDots); got != tc.want {
+			t.Errorf("sanitise(%q, %t) = (%s); want (%s)", tc.input, tc.keepDots, got, tc.want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	ts := time.Unix(1510000000, 0)
+	payload := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("float", 1.5),
+		datatype.NewStringType("string", "skipped"),
+		datatype.NewMegaByteType("memory", 2*datatype.MegaByte),
+		datatype.NewFloatListType("list", []float64{1, 2, 6}),
+		datatype.NewGCListType("gc", []uint64{0, 2000, 4000}),
+	})
+
+	got, err := lines("expipe", "my.app", ts, payload, ListAggregate)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := []string{
+		"expipe.my_app.float 1.5 1510000000\n",
+		"expipe.my_app.gc.count 2 1510000000\n",
+		"expipe.my_app.gc.max 4 1510000000\n",
+		"expipe.my_app.gc.mean 3 1510000000\n",
+		"expipe.my_app.gc.min 2 1510000000\n",
+		"expipe.my_app.list.count 3 1510000000\n",
+		"expipe.my_app.list.max 6 1510000000\n",
+		"expipe.my_app.list.mean 3 1510000000\n",
+		"expipe.my_app.list.min 1 1510000000\n",
+		"expipe.my_app.memory 2 1510000000\n",
+	}
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("lines = (%v); want (%v)", got, want)
+	}
+
+	got, err = lines("", "app", ts, payload, ListIndex)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want = []string{
+		"app.float 1.5 1510000000\n",
+		"app.gc.0 2 1510000000\n",
+		"app.gc.1 4 1510000000\n",
+		"app.list.0 1 1510000000\n",
+		"app.list.1 2 1510000000\n",
+		"app.list.2 6 1510000000\n",
+		"app.memory 2 1510000000\n",
+	}
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("lines = (%v); want (%v)", got, want)
+	}
+}
+
+func TestPackets(t *testing.T) {
+	line := strings.Repeat("a", 600) + "\n"
+	list := []string{line, line, line}
+	r := &Recorder{protocol: TCP}
+	if got := r.packets(list); len(got) != 1 {
+		t.Errorf("len(packets) = (%d); want (1)", len(got))
+	}
+	r.protocol = UDP
+	got := r.packets(list)
+	if len(got) != 2 {
+		t.Fatalf("len(packets) = (%d); want (2)", len(got))
+	}
+	if len(got[0]) != 2*len(line) || len(got[1]) != len(line) {
+		t.Errorf("packets = (%d, %d); want (%d, %d)", len(got[0]), len(got[1]), 2*len(line), len(line))
+	}
+}
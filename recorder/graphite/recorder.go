@@ -0,0 +1,256 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package graphite contains logic to record data to a Graphite server using
+// the plaintext protocol over TCP or UDP. Each numeric value of the payload is
+// written in its own series, under the IndexName as the prefix and the
+// TypeName of the job:
+//
+//    expipe.my_app.memstats.Alloc 12.5 1510000000
+//
+// Byte types are written in the unit they are presented in, and strings are
+// skipped. List types are written with their count, min, max and mean by
+// default, or each item in its own indexed series in the ListIndex mode:
+//
+//    expipe.my_app.memstats.PauseNs.count 3 1510000000     # ListAggregate
+//    expipe.my_app.memstats.PauseNs.0 1.2 1510000000       # ListIndex
+//
+// The connection is made on Ping, and if writing to it fails the recorder
+// reconnects and tries once more before returning an EndpointNotAvailableError.
+// The next Record tries to reconnect again. Please note that a retried job
+// might write some of its lines twice over TCP, which Graphite treats as an
+// update of the same points.
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +--------------------+---------------------+
+//   |  Expipe var name   |  Graphite Var Name  |
+//   +--------------------+---------------------+
+//   | graphiteRecords    | Graphite Records    |
+//   | graphiteReconnects | Graphite Reconnects |
+//   +--------------------+---------------------+
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TCP is the default protocol of the connection.
+	TCP = "tcp"
+	// UDP protocol.
+	UDP = "udp"
+
+	// ListAggregate writes the count, min, max and mean of the lists. This is
+	// the default mode.
+	ListAggregate = "aggregate"
+	// ListIndex writes each item of the lists in its own series.
+	ListIndex = "index"
+
+	// maxDatagram is the maximum size of the UDP packets. Lines are not split
+	// between the packets.
+	maxDatagram = 1400
+)
+
+var (
+	graphiteRecords    = expvar.NewInt("Graphite Records")
+	graphiteReconnects = expvar.NewInt("Graphite Reconnects")
+)
+
+// Recorder writes the payloads to a Graphite server. It implements
+// DataRecorder interface.
+type Recorder struct {
+	name      string
+	endpoint  string
+	indexName string
+	protocol  string
+	listMode  string
+	log       tools.FieldLogger
+	timeout   time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	pinged bool
+}
+
+// New returns an error if any of the options are invalid.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{protocol: TCP, listMode: ListAggregate}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "graphite")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	return r, nil
+}
+
+// Ping connects to the server. Please note that it can only detect the
+// availability of the server on TCP.
+func (r *Recorder) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(); err != nil {
+		return err
+	}
+	r.pinged = true
+	return nil
+}
+
+// connect replaces the connection with a new one.
+func (r *Recorder) connect() error {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	conn, err := net.DialTimeout(r.protocol, r.endpoint, r.timeout)
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	r.conn = conn
+	return nil
+}
+
+// Record writes the payload to the server. It returns an error if the ping is
+// not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pinged {
+		return recorder.ErrPingNotCalled
+	}
+	prefix := job.IndexName
+	if prefix == "" {
+		prefix = r.indexName
+	}
+	list, err := lines(prefix, job.TypeName, job.Time, job.Payload, r.listMode)
+	if err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	packets := r.packets(list)
+	if err = r.send(ctx, packets); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.log.WithField("ID", job.ID).Debugf("%s: reconnecting after: %v", r.name, err)
+		graphiteReconnects.Add(1)
+		if err = r.connect(); err != nil {
+			return err
+		}
+		if err = r.send(ctx, packets); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+	}
+	graphiteRecords.Add(1)
+	return nil
+}
+
+// packets groups the lines into one packet on TCP, and into packets of at most
+// maxDatagram size on UDP.
+func (r *Recorder) packets(lines []string) [][]byte {
+	var packets [][]byte
+	buf := new(bytes.Buffer)
+	for _, line := range lines {
+		if r.protocol == UDP && buf.Len() > 0 && buf.Len()+len(line) > maxDatagram {
+			packets = append(packets, buf.Bytes())
+			buf = new(bytes.Buffer)
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+func (r *Recorder) send(ctx context.Context, packets [][]byte) error {
+	if r.conn == nil {
+		return errors.New("not connected")
+	}
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := r.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	for _, p := range packets {
+		if _, err := r.conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the address of the server.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the address of the server.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the prefix of the series.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the prefix of the series.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
@@ -0,0 +1,275 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package graphite_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/graphite"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// server is a Graphite server that sends the received lines to a channel.
+type server struct {
+	l     net.Listener
+	lines chan string
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newServer(t *testing.T) *server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s := &server{l: l, lines: make(chan string, 100)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					s.lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *server) Addr() string { return s.l.Addr().String() }
+
+// dropConns closes all the accepted connections.
+func (s *server) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *server) Close() {
+	s.l.Close()
+	s.dropConns()
+}
+
+func (s *server) next(t *testing.T) string {
+	select {
+	case line := <-s.lines:
+		return line
+	case <-time.After(2 * time.Second):
+		t.Fatal("no lines were received")
+	}
+	return ""
+}
+
+func newRecorder(t *testing.T, address string, options ...func(recorder.Constructor) error) *graphite.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		graphite.WithAddress(address),
+	}, options...)
+	rec, err := graphite.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job(value float64) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("memstats.Alloc", value)}),
+		TypeName: "my_app",
+		Time:     time.Unix(1510000000, 0),
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{graphite.WithAddress("127.0.0.1:2003")}},
+		{"no address", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"empty address", []func(recorder.Constructor) error{graphite.WithAddress("")}},
+		{"url", []func(recorder.Constructor) error{graphite.WithAddress("http://127.0.0.1:2003")}},
+		{"bad protocol", []func(recorder.Constructor) error{graphite.WithProtocol("http")}},
+		{"bad list mode", []func(recorder.Constructor) error{graphite.WithListMode("sum")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := graphite.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	rec, err := graphite.New(
+		recorder.WithName("name"),
+		graphite.WithAddress(s.Addr()),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = rec.Record(context.Background(), job(1))
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	rec.Close()
+
+	addr := s.Addr()
+	s.Close()
+	rec, _ = graphite.New(
+		recorder.WithName("name"),
+		graphite.WithAddress(addr),
+	)
+	err = rec.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	rec := newRecorder(t, s.Addr())
+	defer rec.Close()
+
+	if err := rec.Record(context.Background(), job(12.5)); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := "expipe.my_app.memstats.Alloc 12.5 1510000000"
+	if got := s.next(t); got != want {
+		t.Errorf("line = (%s); want (%s)", got, want)
+	}
+
+	other := job(1)
+	other.IndexName = "servers.web1"
+	if err := rec.Record(context.Background(), other); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := s.next(t); !strings.HasPrefix(got, "servers.web1.my_app.") {
+		t.Errorf("line = (%s); want (servers.web1.my_app.) prefix", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rec.Record(ctx, job(1)); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestRecordReconnects(t *testing.T) {
+	s := newServer(t)
+	defer s.Close()
+	rec := newRecorder(t, s.Addr())
+	defer rec.Close()
+	if err := rec.Record(context.Background(), job(1)); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s.next(t)
+
+	s.dropConns()
+	// The first writes after the connection is dropped might not fail, but
+	// the recorder should reconnect as soon as the failure is detected.
+	for i := 0; i < 10; i++ {
+		if err := rec.Record(context.Background(), job(2)); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		s.mu.Lock()
+		reconnected := len(s.conns) > 0
+		s.mu.Unlock()
+		if reconnected {
+			break
+		}
+	}
+	want := "expipe.my_app.memstats.Alloc 2 1510000000"
+	if got := s.next(t); got != want {
+		t.Errorf("line = (%s); want (%s)", got, want)
+	}
+
+	addr := s.Addr()
+	s.Close()
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = rec.Record(context.Background(), job(3))
+	}
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+
+	// the server is back.
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	defer l.Close()
+	if err = rec.Record(context.Background(), job(4)); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestRecordUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer conn.Close()
+	rec := newRecorder(t, conn.LocalAddr().String(),
+		graphite.WithProtocol(graphite.UDP),
+		graphite.WithListMode(graphite.ListIndex),
+	)
+	defer rec.Close()
+
+	j := job(1)
+	j.Payload = datatype.New([]datatype.DataType{datatype.NewFloatListType("list", []float64{1, 2})})
+	if err = rec.Record(context.Background(), j); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := "expipe.my_app.list.0 1 1510000000\nexpipe.my_app.list.1 2 1510000000\n"
+	if string(buf[:n]) != want {
+		t.Errorf("packet = (%q); want (%q)", buf[:n], want)
+	}
+}
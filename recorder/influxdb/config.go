@@ -0,0 +1,109 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package influxdb
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up an InfluxDB recorder
+// endpoint from a configuration file. The index_name is used as the database
+// name.
+type Config struct {
+	InfluxEndpoint  string `mapstructure:"endpoint"`
+	InfluxTimeout   string `mapstructure:"timeout"`
+	InfluxIndexName string `mapstructure:"index_name"`
+	log             tools.FieldLogger
+	InfluxName      string
+	ConfTimeout     time.Duration
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	return New(
+		recorder.WithLogger(c.Logger()),
+		recorder.WithEndpoint(c.Endpoint()),
+		recorder.WithName(c.Name()),
+		recorder.WithIndexName(c.IndexName()),
+		recorder.WithTimeout(c.Timeout()),
+	)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.InfluxName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.InfluxIndexName }
+
+// Endpoint return the endpoint.
+func (c *Config) Endpoint() string { return c.InfluxEndpoint }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if timeout, err = time.ParseDuration(c.InfluxTimeout); err != nil {
+			return &recorder.ParseTimeOutError{Timeout: c.InfluxTimeout, Err: err}
+		}
+		c.InfluxName = name
+		c.ConfTimeout = timeout
+		return nil
+	}
+}
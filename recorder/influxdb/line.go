@@ -0,0 +1,84 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package influxdb
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// writeLine writes the payload as one point in line protocol. Fields are
+// sorted by their keys.
+func writeLine(w io.Writer, measurement string, t time.Time, payload datatype.DataContainer) error {
+	fields := make(map[string]string)
+	for _, d := range payload.List() {
+		if err := addFields(fields, d); err != nil {
+			return err
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := new(bytes.Buffer)
+	buf.WriteString(measurementEscaper.Replace(measurement))
+	for i, k := range keys {
+		if i == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(keyEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(fields[k])
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// addFields adds the formatted field values of d to fields. Byte types are
+// recorded in the same unit they are presented in the payload, and list types
+// are recorded with their count, min, max and mean.
+func addFields(fields map[string]string, d datatype.DataType) error {
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		switch v := value.(type) {
+		case float64:
+			addFloat(fields, key, v)
+		case string:
+			fields[key] = `"` + stringEscaper.Replace(v) + `"`
+		case []float64:
+			datatype.Summarise(v, func(name string, v float64) {
+				addFloat(fields, key+"."+name, v)
+			})
+		}
+	})
+}
+
+func addFloat(fields map[string]string, key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	fields[key] = strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,218 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package influxdb contains logic to record data to an InfluxDB database using
+// the line protocol over HTTP. The TypeName of the job is used as the
+// measurement, the IndexName as the database, and the Time as the timestamp of
+// the point. The request bodies are compressed with gzip.
+//
+// Float and byte types are recorded as float fields, string types as string
+// fields, and list types are recorded with their statistics:
+//
+//    my_app memstats.Alloc=12.5,memstats.PauseNs.count=3,memstats.PauseNs.min=1,...
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-----------------+---------------------+
+//   | Expipe var name |  InfluxDB Var Name  |
+//   +-----------------+---------------------+
+//   | influxdbRecords | InfluxDB Records    |
+//   +-----------------+---------------------+
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+var influxdbRecords = expvar.NewInt("InfluxDB Records")
+
+// ResponseError is returned when the server responds with an unexpected
+// status code.
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e ResponseError) Error() string {
+	return fmt.Sprintf("unexpected response (%d): %s", e.StatusCode, e.Body)
+}
+
+// Recorder writes the payloads to an InfluxDB database. It implements
+// DataRecorder interface.
+type Recorder struct {
+	name      string
+	endpoint  string
+	indexName string
+	log       tools.FieldLogger
+	timeout   time.Duration
+
+	mu     sync.Mutex // guards pinged, as Ping can be called while recording
+	pinged bool
+}
+
+// New returns an error if any of the options are invalid.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	r.endpoint = strings.TrimRight(r.endpoint, "/")
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "influxdb")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	return r, nil
+}
+
+// Ping pings the endpoint and creates the database if it does not exist.
+func (r *Recorder) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	resp, err := ctxhttp.Get(ctx, nil, r.endpoint+"/ping")
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	err = checkResponse(resp)
+	resp.Body.Close()
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	q := url.Values{"q": {fmt.Sprintf("CREATE DATABASE %q", r.indexName)}}
+	resp, err = ctxhttp.PostForm(ctx, nil, r.endpoint+"/query", q)
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp); err != nil {
+		return errors.Wrapf(err, "create database: %s", r.indexName)
+	}
+	r.mu.Lock()
+	r.pinged = true
+	r.mu.Unlock()
+	return nil
+}
+
+// Record returns an error if the endpoint responds in errors. It returns an
+// error if the ping is not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	r.mu.Lock()
+	pinged := r.pinged
+	r.mu.Unlock()
+	if !pinged {
+		return recorder.ErrPingNotCalled
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	err := r.record(ctx, job)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*url.Error); ok {
+			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		r.log.WithField("recorder", "influxdb").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID).
+			Debugf("%s: error making request: %v", r.name, err)
+		return err
+	}
+	return nil
+}
+
+func (r *Recorder) record(ctx context.Context, job recorder.Job) error {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if err := writeLine(gz, job.TypeName, job.Time, job.Payload); err != nil {
+		return errors.Wrap(err, "generating payload")
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "compressing payload")
+	}
+	db := job.IndexName
+	if db == "" {
+		db = r.indexName
+	}
+	q := url.Values{"db": {db}, "precision": {"ns"}}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint+"/write?"+q.Encode(), buf)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		return errors.Wrap(err, "record payload")
+	}
+	defer resp.Body.Close()
+	if err = checkResponse(resp); err != nil {
+		return errors.Wrap(err, "record payload")
+	}
+	influxdbRecords.Add(1)
+	return ctx.Err()
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	return ResponseError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the endpoint.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the endpoint of the recorder.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the database the recorder should record in.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the database of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
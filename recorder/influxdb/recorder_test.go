@@ -0,0 +1,245 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package influxdb_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/influxdb"
+	rt "github.com/arsham/expipe/recorder/testing"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+type request struct {
+	query writeQuery
+	body  string
+}
+
+type writeQuery struct {
+	db, precision string
+}
+
+// getTestServer returns a server that behaves like InfluxDB. If ch is not nil,
+// the write requests are sent to it.
+func getTestServer(ch chan<- request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			w.WriteHeader(http.StatusNoContent)
+		case "/query":
+			w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+		case "/write":
+			if r.Header.Get("Content-Encoding") != "gzip" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(gz)
+			if ch != nil {
+				ch <- request{
+					query: writeQuery{db: r.URL.Query().Get("db"), precision: r.URL.Query().Get("precision")},
+					body:  string(body),
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+type Construct struct {
+	*rt.BaseConstruct
+	testServer *httptest.Server
+}
+
+func (c *Construct) TestServer() *httptest.Server {
+	c.testServer = getTestServer(nil)
+	return c.testServer
+}
+
+func (c *Construct) Object() (recorder.DataRecorder, error) {
+	return influxdb.New(c.Setters()...)
+}
+
+func (c *Construct) ValidEndpoints() []string {
+	return []string{
+		"http://192.168.1.1:8086",
+		"http://127.0.0.1:8086",
+		"http://localhost:8086",
+		"http://localhost.localdomain:8086",
+	}
+}
+
+func (c *Construct) InvalidEndpoints() []string {
+	return []string{
+		"http://192.168 .1.1:8086",
+		"http ://127.0.0.1:8086",
+		"http://:8086",
+		":8086",
+		"",
+	}
+}
+
+func TestInfluxDBRecorder(t *testing.T) {
+	rt.TestSuites(t, func() (rt.Constructor, func()) {
+		c := &Construct{
+			testServer:    getTestServer(nil),
+			BaseConstruct: rt.NewBaseConstruct(),
+		}
+		return c, func() { c.testServer.Close() }
+	})
+}
+
+func TestInfluxDBRecordLineProtocol(t *testing.T) {
+	t.Parallel()
+	ch := make(chan request, 1)
+	ts := getTestServer(ch)
+	defer ts.Close()
+	rec, err := influxdb.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+		recorder.WithIndexName("metrics"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	now := time.Unix(1500000000, 42)
+	payload := datatype.New([]datatype.DataType{
+		datatype.NewFloatType("cpu usage", 1.5),
+		datatype.NewStringType("status", `all "good"`),
+		datatype.NewFloatListType("list", []float64{1, 2, 6}),
+		datatype.NewGCListType("gc", []uint64{0, 2000, 4000}),
+		datatype.NewByteType("alloc", 2*datatype.MegaByte),
+		datatype.NewKiloByteType("heap", 3*datatype.KiloByte),
+		datatype.NewMegaByteType("sys", 4*datatype.MegaByte),
+	})
+	job := recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   payload,
+		IndexName: "other_db",
+		TypeName:  "my app",
+		Time:      now,
+	}
+	if err = rec.Record(context.Background(), job); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	req := <-ch
+	if req.query.db != "other_db" {
+		t.Errorf("db = (%s); want (other_db)", req.query.db)
+	}
+	if req.query.precision != "ns" {
+		t.Errorf("precision = (%s); want (ns)", req.query.precision)
+	}
+	want := `my\ app alloc=2,cpu\ usage=1.5,gc.count=2,gc.max=4,gc.mean=3,gc.min=2,heap=3,list.count=3,list.max=6,list.mean=3,list.min=1,status="all \"good\"",sys=4 1500000000000000042` + "\n"
+	if req.body != want {
+		t.Errorf("body = (%s); want (%s)", req.body, want)
+	}
+}
+
+func TestInfluxDBRecordErrorResponse(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/write":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"database not found"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+	rec, err := influxdb.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	job := recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New([]datatype.DataType{datatype.NewFloatType("a", 1)}),
+		TypeName: "my_type",
+		Time:     time.Now(),
+	}
+	err = rec.Record(context.Background(), job)
+	e, ok := errors.Cause(err).(influxdb.ResponseError)
+	if !ok {
+		t.Fatalf("err = (%#v); want (influxdb.ResponseError)", err)
+	}
+	if e.StatusCode != http.StatusNotFound || !strings.Contains(e.Body, "database not found") {
+		t.Errorf("err = (%v); want (database not found)", e)
+	}
+}
+
+func TestInfluxDBPingCreateDatabaseError(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/query" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	rec, err := influxdb.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestInfluxDBPingErrorResponse(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"starting up"}`))
+	}))
+	defer ts.Close()
+	rec, err := influxdb.New(
+		recorder.WithEndpoint(ts.URL),
+		recorder.WithName("name"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = rec.Ping()
+	e, ok := errors.Cause(err).(recorder.EndpointNotAvailableError)
+	if !ok {
+		t.Fatalf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+	re, ok := e.Err.(influxdb.ResponseError)
+	if !ok {
+		t.Fatalf("e.Err = (%#v); want (influxdb.ResponseError)", e.Err)
+	}
+	if re.StatusCode != http.StatusServiceUnavailable || !strings.Contains(re.Body, "starting up") {
+		t.Errorf("e.Err = (%v); want (starting up)", re)
+	}
+}
@@ -26,8 +26,10 @@ import (
 // Notes
 //
 // Recorders should not change the index name coming in the payload unless they
-// have a valid reason. The engine might add a date to this index name if the
-// user has specified in the configuration file.
+// have a valid reason. The index name might be a template the recorder
+// evaluates for each job, for example the elasticsearch recorder can add the
+// date and the type name to the index name if the user has specified in the
+// configuration file.
 // Ping() should ping the endpoint and return nil if was successful. The Engine
 // will not launch the reader if the ping result is an error.
 // IndexName() comes from the configuration, but the engine takes over.
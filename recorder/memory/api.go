@@ -0,0 +1,135 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TypeCount is the response item of the /types path.
+type TypeCount struct {
+	TypeName string `json:"type_name"`
+	Count    int    `json:"count"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func (r *Recorder) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/types", r.api(r.types))
+	mux.HandleFunc("/latest", r.api(r.latest))
+	mux.HandleFunc("/range", r.api(r.between))
+	return mux
+}
+
+// api wraps the handler functions. The handlers return the object that is
+// written as JSON, or a status code and an error.
+func (r *Recorder) api(fn func(*http.Request) (interface{}, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		memoryRequests.Add(1)
+		var (
+			obj    interface{}
+			status = http.StatusOK
+			err    error
+		)
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			status, err = http.StatusMethodNotAllowed, errors.New("method not allowed")
+		} else {
+			obj, status, err = fn(req)
+		}
+		if err != nil {
+			obj = apiError{Error: err.Error()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(obj); err != nil {
+			r.log.Debugf("%s: writing response: %v", r.name, err)
+		}
+	}
+}
+
+func (r *Recorder) types(req *http.Request) (interface{}, int, error) {
+	counts := []TypeCount{}
+	for _, name := range r.TypeNames() {
+		docs := r.Range(name, time.Time{}, time.Time{})
+		counts = append(counts, TypeCount{TypeName: name, Count: len(docs)})
+	}
+	return counts, http.StatusOK, nil
+}
+
+// latest returns the latest document of the type, or of all types if the type
+// is not specified.
+func (r *Recorder) latest(req *http.Request) (interface{}, int, error) {
+	query := req.URL.Query()
+	keys := query["key"]
+	if typeName := query.Get("type"); typeName != "" {
+		doc, ok := r.Latest(typeName)
+		if !ok {
+			return nil, http.StatusNotFound, errors.Errorf("no documents for %q", typeName)
+		}
+		return doc.Filter(keys...), http.StatusOK, nil
+	}
+	docs := []Document{}
+	for _, name := range r.TypeNames() {
+		if doc, ok := r.Latest(name); ok {
+			docs = append(docs, doc.Filter(keys...))
+		}
+	}
+	return docs, http.StatusOK, nil
+}
+
+func (r *Recorder) between(req *http.Request) (interface{}, int, error) {
+	query := req.URL.Query()
+	typeName := query.Get("type")
+	if typeName == "" {
+		return nil, http.StatusBadRequest, errors.New("type cannot be empty")
+	}
+	now := time.Now()
+	from, err := parseTime(query.Get("from"), now)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.Wrap(err, "from")
+	}
+	to, err := parseTime(query.Get("to"), now)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.Wrap(err, "to")
+	}
+	if !r.hasType(typeName) {
+		return nil, http.StatusNotFound, errors.Errorf("no documents for %q", typeName)
+	}
+	docs := []Document{}
+	for _, doc := range r.Range(typeName, from, to) {
+		docs = append(docs, doc.Filter(query["key"]...))
+	}
+	return docs, http.StatusOK, nil
+}
+
+func (r *Recorder) hasType(typeName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.rings[typeName]
+	return ok
+}
+
+// parseTime returns the time in RFC3339 format, or the time the duration
+// before now, e.g. 5m. It returns the zero time if s is empty.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time: %q", s)
+	}
+	return now.Add(-d), nil
+}
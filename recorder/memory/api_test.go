@@ -0,0 +1,121 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder/memory"
+)
+
+func get(t *testing.T, rec *memory.Recorder, path string, query url.Values, status int, v interface{}) {
+	res, err := http.Get("http://" + rec.Addr().String() + path + "?" + query.Encode())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		t.Errorf("%s: StatusCode = (%d); want (%d)", path, res.StatusCode, status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = (%s); want (application/json)", ct)
+	}
+	if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	rec := newRecorder(t)
+	defer rec.Close()
+	now := time.Now()
+	record(t, rec,
+		job("my_app", now.Add(-2*time.Minute),
+			datatype.NewFloatType("memstats.Alloc", 10),
+			datatype.NewFloatType("Goroutines", 3),
+		),
+		job("my_app", now.Add(-time.Second),
+			datatype.NewFloatType("memstats.Alloc", 20),
+			datatype.NewFloatType("Goroutines", 4),
+		),
+		job("other_app", now, datatype.NewFloatType("memstats.Alloc", 30)),
+	)
+
+	var counts []memory.TypeCount
+	get(t, rec, "/types", nil, http.StatusOK, &counts)
+	want := []memory.TypeCount{{"my_app", 2}, {"other_app", 1}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = (%v); want (%v)", counts, want)
+	}
+
+	var docs []memory.Document
+	get(t, rec, "/latest", url.Values{"key": {"memstats.*"}}, http.StatusOK, &docs)
+	if len(docs) != 2 {
+		t.Fatalf("len(docs) = (%d); want (2)", len(docs))
+	}
+	if docs[0].TypeName != "my_app" || !reflect.DeepEqual(docs[0].Values, map[string]interface{}{"memstats.Alloc": 20.0}) {
+		t.Errorf("docs[0] = (%v); want (my_app with memstats.Alloc of 20)", docs[0])
+	}
+
+	var doc memory.Document
+	get(t, rec, "/latest", url.Values{"type": {"other_app"}}, http.StatusOK, &doc)
+	if doc.TypeName != "other_app" || doc.Values["memstats.Alloc"] != 30.0 {
+		t.Errorf("doc = (%v); want (other_app with memstats.Alloc of 30)", doc)
+	}
+
+	docs = nil
+	get(t, rec, "/range", url.Values{"type": {"my_app"}, "from": {"1m"}, "key": {"Goroutines"}}, http.StatusOK, &docs)
+	if len(docs) != 1 || !reflect.DeepEqual(docs[0].Values, map[string]interface{}{"Goroutines": 4.0}) {
+		t.Errorf("docs = (%v); want (the second document with Goroutines)", docs)
+	}
+	docs = nil
+	to := now.Add(-time.Minute).Format(time.RFC3339)
+	get(t, rec, "/range", url.Values{"type": {"my_app"}, "to": {to}}, http.StatusOK, &docs)
+	if len(docs) != 1 || docs[0].Values["memstats.Alloc"] != 10.0 {
+		t.Errorf("docs = (%v); want (the first document)", docs)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	rec := newRecorder(t)
+	defer rec.Close()
+	record(t, rec, job("my_app", time.Now(), datatype.NewFloatType("n", 1)))
+	tcs := []struct {
+		name   string
+		path   string
+		query  url.Values
+		status int
+	}{
+		{"unknown latest", "/latest", url.Values{"type": {"nothing"}}, http.StatusNotFound},
+		{"unknown range", "/range", url.Values{"type": {"nothing"}}, http.StatusNotFound},
+		{"no type", "/range", nil, http.StatusBadRequest},
+		{"bad from", "/range", url.Values{"type": {"my_app"}, "from": {"yesterday"}}, http.StatusBadRequest},
+		{"bad to", "/range", url.Values{"type": {"my_app"}, "to": {"now"}}, http.StatusBadRequest},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var res map[string]string
+			get(t, rec, tc.path, tc.query, tc.status, &res)
+			if res["error"] == "" {
+				t.Errorf("res = (%v); want (error)", res)
+			}
+		})
+	}
+
+	res, err := http.Post("http://"+rec.Addr().String()+"/types", "application/json", nil)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("StatusCode = (%d); want (%d)", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
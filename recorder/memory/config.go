@@ -0,0 +1,142 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a memory recorder
+// from a configuration file. The address is where the API is served, e.g.
+// ":9274". The retention (e.g. "10m") and the capacity (the number of
+// documents of each type name) are optional. The timeout is optional and is
+// used for reading the requests and writing the responses.
+type Config struct {
+	MemAddress   string `mapstructure:"address"`
+	MemTimeout   string `mapstructure:"timeout"`
+	MemIndexName string `mapstructure:"index_name"`
+	MemRetention string `mapstructure:"retention"`
+	MemCapacity  int    `mapstructure:"capacity"`
+	log          tools.FieldLogger
+	MemName      string
+	ConfTimeout  time.Duration
+	Retention    time.Duration
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		WithAddress(c.Endpoint()),
+		recorder.WithName(c.Name()),
+	}
+	if c.MemIndexName != "" {
+		options = append(options, recorder.WithIndexName(c.IndexName()))
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, recorder.WithTimeout(c.Timeout()))
+	}
+	if c.Retention != 0 {
+		options = append(options, WithRetention(c.Retention))
+	}
+	if c.MemCapacity != 0 {
+		options = append(options, WithCapacity(c.MemCapacity))
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.MemName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.MemIndexName }
+
+// Endpoint return the address to serve the API on.
+func (c *Config) Endpoint() string { return c.MemAddress }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout, retention time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.MemTimeout != "" {
+			if timeout, err = time.ParseDuration(c.MemTimeout); err != nil {
+				return &recorder.ParseTimeOutError{Timeout: c.MemTimeout, Err: err}
+			}
+		}
+		if c.MemRetention != "" {
+			if retention, err = time.ParseDuration(c.MemRetention); err != nil {
+				return errors.Wrap(err, "parsing retention")
+			}
+			if retention <= 0 {
+				return InvalidRetentionError(retention)
+			}
+		}
+		if c.MemCapacity < 0 {
+			return InvalidCapacityError(c.MemCapacity)
+		}
+		if c.MemAddress == "" {
+			return errors.New("address cannot be empty")
+		}
+		c.MemName = name
+		c.ConfTimeout = timeout
+		c.Retention = retention
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder/memory"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(memory.Config)
+	err := memory.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = memory.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+func TestWithViper(t *testing.T) {
+	tcs := []struct {
+		tcName string
+		name   string
+		key    string
+		v      unmarshaller
+	}{
+		{"no name", "", "key", viper.New()},
+		{"no key", "name", "", viper.New()},
+		{"no viper", "name", "key", nil},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.tcName, func(t *testing.T) {
+			c := new(memory.Config)
+			err := memory.WithViper(tc.v, tc.name, tc.key)(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            address: :9274
+            index_name: example_index
+            timeout: 10s
+            retention: 30m
+            capacity: 50
+    `))
+	v.ReadConfig(input)
+	c := new(memory.Config)
+	err := memory.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != ":9274" {
+		t.Errorf("c.Endpoint() = (%s); want (:9274)", c.Endpoint())
+	}
+	if c.IndexName() != "example_index" {
+		t.Errorf("c.IndexName() = (%s); want (example_index)", c.IndexName())
+	}
+	if c.Name() != "recorder1" {
+		t.Errorf("c.Name() = (%s); want (recorder1)", c.Name())
+	}
+	if c.Retention != 30*time.Minute {
+		t.Errorf("c.Retention = (%s); want (30m)", c.Retention)
+	}
+	if c.MemCapacity != 50 {
+		t.Errorf("c.MemCapacity = (%d); want (50)", c.MemCapacity)
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                address: :9274
+                timeout: asas
+    `))
+	v.ReadConfig(input)
+	c := new(memory.Config)
+	err := memory.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+    `))
+	v.ReadConfig(input)
+	c = new(memory.Config)
+	err = memory.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): no address")
+	}
+
+	for _, line := range []string{"retention: forever", "retention: -1m", "capacity: -1"} {
+		input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                address: :9274
+                ` + line + `
+    `))
+		v.ReadConfig(input)
+		c = new(memory.Config)
+		err = memory.WithViper(v, "recorder1", "recorders.recorder1")(c)
+		if err == nil {
+			t.Errorf("err = (nil); want (error): %s", line)
+		}
+	}
+
+	err = memory.WithViper(&badMarshaller{}, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := memory.NewConfig(memory.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	c, err = memory.NewConfig(memory.WithLogger(nil))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestConfigRecorder(t *testing.T) {
+	c, err := memory.NewConfig(memory.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.MemName = "name"
+	c.MemAddress = "127.0.0.1:9274"
+	rec, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.IndexName() != "name" {
+		t.Errorf("rec.IndexName() = (%s); want (name)", rec.IndexName())
+	}
+	if rec.Timeout() == 0 {
+		t.Error("rec.Timeout() = (0); want (default timeout)")
+	}
+
+	c.MemAddress = "http://127.0.0.1:9274/types"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// InvalidRetentionError is returned when the retention is not a positive
+// duration.
+type InvalidRetentionError time.Duration
+
+func (i InvalidRetentionError) Error() string {
+	return "invalid retention: " + time.Duration(i).String()
+}
+
+// InvalidCapacityError is returned when the capacity is not a positive number.
+type InvalidCapacityError int
+
+func (i InvalidCapacityError) Error() string {
+	return "invalid capacity: " + strconv.Itoa(int(i))
+}
+
+// WithAddress sets the address the API is served on, e.g. ":9274". Unlike
+// recorder.WithEndpoint, it does not expect a URL.
+func WithAddress(address string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		if address == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return recorder.InvalidEndpointError(address)
+		}
+		e.SetEndpoint(address)
+		return nil
+	}
+}
+
+// WithRetention sets the age of the oldest documents that are kept. The
+// default is DefaultRetention.
+func WithRetention(retention time.Duration) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if retention <= 0 {
+			return InvalidRetentionError(retention)
+		}
+		r.retention = retention
+		return nil
+	}
+}
+
+// WithCapacity sets the maximum number of the documents that are kept for
+// each type name. The default is DefaultCapacity.
+func WithCapacity(capacity int) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if capacity <= 0 {
+			return InvalidCapacityError(capacity)
+		}
+		r.capacity = capacity
+		return nil
+	}
+}
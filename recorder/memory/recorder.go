@@ -0,0 +1,267 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package memory contains logic to keep the recent documents in memory and
+// serve them over an HTTP JSON API. The last documents of each TypeName are
+// kept in a ring buffer, bounded by the capacity and the retention: when the
+// buffer is full the oldest document is dropped, and the documents older than
+// the retention are expired. It gives a quick look at what is being collected
+// without setting up a database, and it can be queried directly in the tests.
+//
+// API
+//
+// The API is served on the address of the recorder. The keys can be filtered
+// with the key parameter, which can be repeated and accepts the path.Match
+// patterns, e.g. key=memstats.*. The times are in RFC3339 format, or a
+// duration before now, e.g. from=5m.
+//
+//    GET /types                                 # the type names and their document counts
+//    GET /latest?type=my_app&key=memstats.*     # the latest document of each (or the given) type
+//    GET /range?type=my_app&from=5m&to=1m       # the documents of the type in the time range
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-----------------+---------------------+
+//   | Expipe var name |   Memory Var Name   |
+//   +-----------------+---------------------+
+//   | memoryRecords   | Memory Records      |
+//   | memoryDropped   | Memory Dropped      |
+//   | memoryRequests  | Memory API Requests |
+//   +-----------------+---------------------+
+package memory
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRetention is the age of the oldest documents that are kept, if
+	// not specified.
+	DefaultRetention = 10 * time.Minute
+
+	// DefaultCapacity is the maximum number of the documents of each type
+	// name, if not specified.
+	DefaultCapacity = 1000
+)
+
+var (
+	memoryRecords  = expvar.NewInt("Memory Records")
+	memoryDropped  = expvar.NewInt("Memory Dropped")
+	memoryRequests = expvar.NewInt("Memory API Requests")
+)
+
+// Recorder keeps the recent documents in memory. It implements DataRecorder
+// interface.
+type Recorder struct {
+	name      string
+	endpoint  string
+	indexName string
+	log       tools.FieldLogger
+	timeout   time.Duration
+	retention time.Duration
+	capacity  int
+
+	mu       sync.RWMutex
+	rings    map[string]*ring
+	listener net.Listener
+	server   *http.Server
+}
+
+// New returns an error if any of the options are invalid.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{
+		retention: DefaultRetention,
+		capacity:  DefaultCapacity,
+		rings:     make(map[string]*ring),
+	}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "memory")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	return r, nil
+}
+
+// Ping starts serving the API. It returns nil if it is already serving.
+func (r *Recorder) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener != nil {
+		return nil
+	}
+	l, err := net.Listen("tcp", r.endpoint)
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	server := &http.Server{Handler: r.handler(), ReadTimeout: r.timeout, WriteTimeout: r.timeout}
+	r.listener, r.server = l, server
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			r.log.Errorf("%s: serving api: %v", r.name, err)
+		}
+	}()
+	return nil
+}
+
+// Record adds the job to the buffer of its TypeName. It returns an error if the
+// ping is not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	doc, err := newDocument(job)
+	if err != nil {
+		return errors.Wrap(err, "reading payload")
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener == nil {
+		return recorder.ErrPingNotCalled
+	}
+	rg, ok := r.rings[job.TypeName]
+	if !ok {
+		rg = newRing(r.capacity)
+		r.rings[job.TypeName] = rg
+	}
+	if rg.size == r.capacity {
+		memoryDropped.Add(1)
+	}
+	rg.add(doc)
+	rg.expire(r.cutoff())
+	memoryRecords.Add(1)
+	return nil
+}
+
+func (r *Recorder) cutoff() time.Time { return time.Now().Add(-r.retention) }
+
+// TypeNames returns the type names that have documents, sorted.
+func (r *Recorder) TypeNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.rings))
+	for name := range r.rings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Range returns the documents of the type name that are recorded between from
+// and to, inclusive, sorted by their time. The zero values mean no limits.
+func (r *Recorder) Range(typeName string, from, to time.Time) []Document {
+	cutoff := r.cutoff()
+	if from.Before(cutoff) {
+		from = cutoff
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rg, ok := r.rings[typeName]
+	if !ok {
+		return nil
+	}
+	var docs []Document
+	rg.each(func(d Document) {
+		if d.Time.Before(from) || !to.IsZero() && d.Time.After(to) {
+			return
+		}
+		docs = append(docs, d)
+	})
+	sort.Stable(byTime(docs))
+	return docs
+}
+
+// Latest returns the newest document of the type name. It returns false if
+// there are no documents within the retention.
+func (r *Recorder) Latest(typeName string) (Document, bool) {
+	docs := r.Range(typeName, time.Time{}, time.Time{})
+	if len(docs) == 0 {
+		return Document{}, false
+	}
+	return docs[len(docs)-1], true
+}
+
+type byTime []Document
+
+func (b byTime) Len() int           { return len(b) }
+func (b byTime) Less(i, j int) bool { return b[i].Time.Before(b[j].Time) }
+func (b byTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Addr returns the address the API is served on, or nil if it is not serving.
+// It is useful when the port is chosen by the system.
+func (r *Recorder) Addr() net.Addr {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Addr()
+}
+
+// Close stops the API server. The documents are kept.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.server == nil {
+		return nil
+	}
+	err := r.server.Close()
+	r.server, r.listener = nil, nil
+	return err
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the address the API is served on.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the address of the API.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the indexName the recorder should record as.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
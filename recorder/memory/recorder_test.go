@@ -0,0 +1,226 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/memory"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func newRecorder(t *testing.T, options ...func(recorder.Constructor) error) *memory.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		memory.WithAddress("127.0.0.1:0"),
+	}, options...)
+	rec, err := memory.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job(typeName string, t time.Time, list ...datatype.DataType) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New(list),
+		TypeName: typeName,
+		Time:     t,
+	}
+}
+
+func record(t *testing.T, rec *memory.Recorder, jobs ...recorder.Job) {
+	for _, j := range jobs {
+		if err := rec.Record(context.Background(), j); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{memory.WithAddress(":9274")}},
+		{"no address", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"empty address", []func(recorder.Constructor) error{memory.WithAddress("")}},
+		{"url", []func(recorder.Constructor) error{memory.WithAddress("http://localhost:9274/types")}},
+		{"zero retention", []func(recorder.Constructor) error{recorder.WithName("a"), memory.WithRetention(0)}},
+		{"negative retention", []func(recorder.Constructor) error{recorder.WithName("a"), memory.WithRetention(-time.Minute)}},
+		{"zero capacity", []func(recorder.Constructor) error{recorder.WithName("a"), memory.WithCapacity(0)}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := memory.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	rec, err := memory.New(
+		recorder.WithName("name"),
+		memory.WithAddress("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.Addr() != nil {
+		t.Errorf("rec.Addr() = (%v); want (nil)", rec.Addr())
+	}
+	err = rec.Record(context.Background(), job("my_app", time.Now()))
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rec.Close()
+	addr := rec.Addr()
+	if err = rec.Ping(); err != nil {
+		t.Errorf("second ping: err = (%v); want (nil)", err)
+	}
+	if rec.Addr().String() != addr.String() {
+		t.Errorf("rec.Addr() = (%s); want (%s)", rec.Addr(), addr)
+	}
+
+	taken, _ := memory.New(
+		recorder.WithName("name"),
+		memory.WithAddress(addr.String()),
+	)
+	err = taken.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	rec := newRecorder(t)
+	defer rec.Close()
+	now := time.Now()
+	record(t, rec,
+		job("my_app", now.Add(-2*time.Second),
+			datatype.NewFloatType("memstats.Alloc", 10),
+			datatype.NewStringType("version", "1.0"),
+			datatype.NewMegaByteType("memstats.Sys", 2*datatype.MegaByte),
+		),
+		job("my_app", now.Add(-time.Second), datatype.NewFloatType("memstats.Alloc", 20)),
+		job("other_app", now, datatype.NewFloatListType("PauseNs", []float64{1, 2})),
+	)
+	if got := rec.TypeNames(); !reflect.DeepEqual(got, []string{"my_app", "other_app"}) {
+		t.Errorf("rec.TypeNames() = (%v); want ([my_app other_app])", got)
+	}
+
+	docs := rec.Range("my_app", time.Time{}, time.Time{})
+	if len(docs) != 2 {
+		t.Fatalf("len(docs) = (%d); want (2)", len(docs))
+	}
+	want := map[string]interface{}{"memstats.Alloc": 10.0, "version": "1.0", "memstats.Sys": 2.0}
+	if !reflect.DeepEqual(docs[0].Values, want) {
+		t.Errorf("docs[0].Values = (%v); want (%v)", docs[0].Values, want)
+	}
+	if docs[0].TypeName != "my_app" || docs[0].ID == "" {
+		t.Errorf("docs[0] = (%v); want (type name and id)", docs[0])
+	}
+
+	doc, ok := rec.Latest("my_app")
+	if !ok {
+		t.Fatal("ok = (false); want (true)")
+	}
+	if doc.Values["memstats.Alloc"] != 20.0 {
+		t.Errorf(`doc.Values["memstats.Alloc"] = (%v); want (20)`, doc.Values["memstats.Alloc"])
+	}
+	if _, ok = rec.Latest("nothing"); ok {
+		t.Error("ok = (true); want (false)")
+	}
+
+	docs = rec.Range("my_app", now.Add(-1500*time.Millisecond), now)
+	if len(docs) != 1 || docs[0].Values["memstats.Alloc"] != 20.0 {
+		t.Errorf("docs = (%v); want (the second document)", docs)
+	}
+	docs = rec.Range("my_app", time.Time{}, now.Add(-1500*time.Millisecond))
+	if len(docs) != 1 || docs[0].Values["memstats.Alloc"] != 10.0 {
+		t.Errorf("docs = (%v); want (the first document)", docs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rec.Record(ctx, job("my_app", now)); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestRecordCapacity(t *testing.T) {
+	rec := newRecorder(t, memory.WithCapacity(3))
+	defer rec.Close()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		record(t, rec, job("my_app", now.Add(time.Duration(i)*time.Millisecond), datatype.NewFloatType("n", float64(i))))
+	}
+	docs := rec.Range("my_app", time.Time{}, time.Time{})
+	if len(docs) != 3 {
+		t.Fatalf("len(docs) = (%d); want (3)", len(docs))
+	}
+	for i, doc := range docs {
+		if doc.Values["n"] != float64(i+2) {
+			t.Errorf("docs[%d].Values[n] = (%v); want (%d)", i, doc.Values["n"], i+2)
+		}
+	}
+}
+
+func TestRecordRetention(t *testing.T) {
+	rec := newRecorder(t, memory.WithRetention(time.Minute))
+	defer rec.Close()
+	now := time.Now()
+	record(t, rec,
+		job("my_app", now.Add(-2*time.Minute), datatype.NewFloatType("n", 1)),
+		job("my_app", now, datatype.NewFloatType("n", 2)),
+	)
+	docs := rec.Range("my_app", time.Time{}, time.Time{})
+	if len(docs) != 1 || docs[0].Values["n"] != 2.0 {
+		t.Errorf("docs = (%v); want (only the recent document)", docs)
+	}
+}
+
+func TestClose(t *testing.T) {
+	rec := newRecorder(t)
+	addr := rec.Addr().String()
+	record(t, rec, job("my_app", time.Now()))
+	if err := rec.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if rec.Addr() != nil {
+		t.Errorf("rec.Addr() = (%v); want (nil)", rec.Addr())
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("err = (nil); want (error)")
+	}
+	if _, ok := rec.Latest("my_app"); !ok {
+		t.Error("ok = (false); the documents should be kept")
+	}
+	if err := rec.Close(); err != nil {
+		t.Errorf("second close: err = (%v); want (nil)", err)
+	}
+}
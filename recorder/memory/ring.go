@@ -0,0 +1,106 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"path"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+)
+
+// Document is a recorded job. The Values are float64 for numbers, string for
+// strings and []float64 for lists. Byte types are in the unit they are
+// presented in.
+type Document struct {
+	ID       string                 `json:"id"`
+	TypeName string                 `json:"type_name"`
+	Time     time.Time              `json:"time"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+// Filter returns a copy of the document with only the values of the keys that
+// match any of the patterns. The patterns are in the path.Match format, e.g.
+// memstats.*. It returns the document itself if there are no patterns.
+func (d Document) Filter(patterns ...string) Document {
+	if len(patterns) == 0 {
+		return d
+	}
+	values := make(map[string]interface{})
+	for k, v := range d.Values {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, k); ok {
+				values[k] = v
+				break
+			}
+		}
+	}
+	d.Values = values
+	return d
+}
+
+// newDocument flattens the payload of the job into a Document.
+func newDocument(job recorder.Job) (Document, error) {
+	values := make(map[string]interface{})
+	for _, d := range job.Payload.List() {
+		if err := flatten(values, d); err != nil {
+			return Document{}, err
+		}
+	}
+	return Document{
+		ID:       job.ID.String(),
+		TypeName: job.TypeName,
+		Time:     job.Time,
+		Values:   values,
+	}, nil
+}
+
+// flatten adds the value of d to values.
+func flatten(values map[string]interface{}, d datatype.DataType) error {
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		values[key] = value
+	})
+}
+
+// ring holds the last documents of a TypeName. When it is full, the oldest
+// document is replaced.
+type ring struct {
+	docs  []Document
+	start int // index of the oldest document
+	size  int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{docs: make([]Document, capacity)}
+}
+
+func (r *ring) add(d Document) {
+	end := (r.start + r.size) % len(r.docs)
+	r.docs[end] = d
+	if r.size < len(r.docs) {
+		r.size++
+		return
+	}
+	r.start = (r.start + 1) % len(r.docs)
+}
+
+// expire removes the documents that were added before the cutoff from the
+// oldest end, and returns the number of remaining documents.
+func (r *ring) expire(cutoff time.Time) int {
+	for r.size > 0 && r.docs[r.start].Time.Before(cutoff) {
+		r.docs[r.start] = Document{}
+		r.start = (r.start + 1) % len(r.docs)
+		r.size--
+	}
+	return r.size
+}
+
+// each calls fn with the documents, from the oldest to the newest.
+func (r *ring) each(fn func(Document)) {
+	for i := 0; i < r.size; i++ {
+		fn(r.docs[(r.start+i)%len(r.docs)])
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ringValues(r *ring) []float64 {
+	var got []float64
+	r.each(func(d Document) {
+		got = append(got, d.Values["n"].(float64))
+	})
+	return got
+}
+
+func TestRing(t *testing.T) {
+	now := time.Now()
+	r := newRing(3)
+	for i := 0; i < 5; i++ {
+		r.add(Document{
+			Time:   now.Add(time.Duration(i) * time.Second),
+			Values: map[string]interface{}{"n": float64(i)},
+		})
+	}
+	if got := ringValues(r); !reflect.DeepEqual(got, []float64{2, 3, 4}) {
+		t.Errorf("ringValues(r) = (%v); want ([2 3 4])", got)
+	}
+	if n := r.expire(now.Add(3 * time.Second)); n != 2 {
+		t.Errorf("r.expire() = (%d); want (2)", n)
+	}
+	if got := ringValues(r); !reflect.DeepEqual(got, []float64{3, 4}) {
+		t.Errorf("ringValues(r) = (%v); want ([3 4])", got)
+	}
+	if n := r.expire(now.Add(time.Hour)); n != 0 {
+		t.Errorf("r.expire() = (%d); want (0)", n)
+	}
+	r.add(Document{Time: now, Values: map[string]interface{}{"n": 7.0}})
+	if got := ringValues(r); !reflect.DeepEqual(got, []float64{7}) {
+		t.Errorf("ringValues(r) = (%v); want ([7])", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	d := Document{Values: map[string]interface{}{
+		"memstats.Alloc": 1.0,
+		"memstats.Sys":   2.0,
+		"Goroutines":     3.0,
+	}}
+	if got := d.Filter(); !reflect.DeepEqual(got, d) {
+		t.Errorf("d.Filter() = (%v); want (%v)", got, d)
+	}
+	got := d.Filter("memstats.A*", "Goroutines")
+	want := map[string]interface{}{"memstats.Alloc": 1.0, "Goroutines": 3.0}
+	if !reflect.DeepEqual(got.Values, want) {
+		t.Errorf("got.Values = (%v); want (%v)", got.Values, want)
+	}
+	if len(d.Values) != 3 {
+		t.Errorf("len(d.Values) = (%d); the document should not change", len(d.Values))
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		in   string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"5m", now.Add(-5 * time.Minute)},
+		{"2017-01-02T15:04:05Z", time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)},
+	}
+	for _, tc := range tcs {
+		got, err := parseTime(tc.in, now)
+		if err != nil {
+			t.Errorf("%s: err = (%v); want (nil)", tc.in, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseTime(%s) = (%s); want (%s)", tc.in, got, tc.want)
+		}
+	}
+	if _, err := parseTime("yesterday", now); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a Prometheus
+// recorder from a configuration file. The address is where the recorder
+// listens for the scrapes, e.g. ":9273". The timeout is optional and is used
+// for reading the requests and writing the responses. The index_name is not
+// used as the TypeName of the jobs is exposed in the labels.
+type Config struct {
+	PromAddress   string `mapstructure:"address"`
+	PromTimeout   string `mapstructure:"timeout"`
+	PromIndexName string `mapstructure:"index_name"`
+	log           tools.FieldLogger
+	PromName      string
+	ConfTimeout   time.Duration
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		WithAddress(c.Endpoint()),
+		recorder.WithName(c.Name()),
+	}
+	if c.PromIndexName != "" {
+		options = append(options, recorder.WithIndexName(c.IndexName()))
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, recorder.WithTimeout(c.Timeout()))
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.PromName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.PromIndexName }
+
+// Endpoint return the address to listen on.
+func (c *Config) Endpoint() string { return c.PromAddress }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.PromTimeout != "" {
+			if timeout, err = time.ParseDuration(c.PromTimeout); err != nil {
+				return &recorder.ParseTimeOutError{Timeout: c.PromTimeout, Err: err}
+			}
+		}
+		if c.PromAddress == "" {
+			return errors.New("address cannot be empty")
+		}
+		c.PromName = name
+		c.ConfTimeout = timeout
+		return nil
+	}
+}
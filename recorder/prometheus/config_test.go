@@ -0,0 +1,170 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder/prometheus"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(prometheus.Config)
+	err := prometheus.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = prometheus.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+func TestWithViper(t *testing.T) {
+	tcs := []struct {
+		tcName string
+		name   string
+		key    string
+		v      unmarshaller
+	}{
+		{"no name", "", "key", viper.New()},
+		{"no key", "name", "", viper.New()},
+		{"no viper", "name", "key", nil},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.tcName, func(t *testing.T) {
+			c := new(prometheus.Config)
+			err := prometheus.WithViper(tc.v, tc.name, tc.key)(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            address: :9273
+            index_name: example_index
+            timeout: 10s
+    `))
+	v.ReadConfig(input)
+	c := new(prometheus.Config)
+	err := prometheus.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != ":9273" {
+		t.Errorf("c.Endpoint() = (%s); want (:9273)", c.Endpoint())
+	}
+	if c.IndexName() != "example_index" {
+		t.Errorf("c.IndexName() = (%s); want (example_index)", c.IndexName())
+	}
+	if c.Name() != "recorder1" {
+		t.Errorf("c.Name() = (%s); want (recorder1)", c.Name())
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                address: :9273
+                timeout: asas
+    `))
+	v.ReadConfig(input)
+	c := new(prometheus.Config)
+	err := prometheus.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+    `))
+	v.ReadConfig(input)
+	c = new(prometheus.Config)
+	err = prometheus.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): no address")
+	}
+
+	err = prometheus.WithViper(&badMarshaller{}, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := prometheus.NewConfig(prometheus.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	c, err = prometheus.NewConfig(prometheus.WithLogger(nil))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestConfigRecorder(t *testing.T) {
+	c, err := prometheus.NewConfig(prometheus.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.PromName = "name"
+	c.PromAddress = "127.0.0.1:9273"
+	rec, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.IndexName() != "name" {
+		t.Errorf("rec.IndexName() = (%s); want (name)", rec.IndexName())
+	}
+	if rec.Timeout() == 0 {
+		t.Error("rec.Timeout() = (0); want (default timeout)")
+	}
+
+	c.PromAddress = "http://127.0.0.1:9273/metrics"
+	if _, err = c.Recorder(); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
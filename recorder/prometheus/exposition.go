@@ -0,0 +1,104 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+// AppLabel is the label that holds the TypeName of the jobs.
+const AppLabel = "app"
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName turns the key into a valid metric name. Invalid characters are
+// replaced with underscores, and an underscore is prepended if the name starts
+// with a digit.
+func metricName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// addMetrics adds the values of d to metrics. Byte types are added in bytes,
+// the base unit of Prometheus, and list types with their count, min, max and
+// mean.
+func addMetrics(metrics map[string]float64, d datatype.DataType) error {
+	switch v := d.(type) {
+	case *datatype.ByteType:
+		addValue(metrics, v.Key, v.Value)
+		return nil
+	case *datatype.KiloByteType:
+		addValue(metrics, v.Key, v.Value)
+		return nil
+	case *datatype.MegaByteType:
+		addValue(metrics, v.Key, v.Value)
+		return nil
+	}
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		switch v := value.(type) {
+		case float64:
+			addValue(metrics, key, v)
+		case []float64:
+			datatype.Summarise(v, func(name string, v float64) {
+				addValue(metrics, key+"_"+name, v)
+			})
+		}
+	})
+}
+
+func addValue(metrics map[string]float64, key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	metrics[metricName(key)] = v
+}
+
+// writeExposition writes the metrics of all apps. The samples of each metric
+// are grouped under one TYPE line, and the metrics and apps are sorted.
+func writeExposition(w io.Writer, apps map[string]map[string]float64) error {
+	samples := make(map[string][]string) // metric -> apps
+	for app, metrics := range apps {
+		for metric := range metrics {
+			samples[metric] = append(samples[metric], app)
+		}
+	}
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		buf.WriteString("# TYPE " + name + " gauge\n")
+		list := samples[name]
+		sort.Strings(list)
+		for _, app := range list {
+			buf.WriteString(name)
+			buf.WriteString(`{` + AppLabel + `="`)
+			buf.WriteString(labelEscaper.Replace(app))
+			buf.WriteString(`"} `)
+			buf.WriteString(strconv.FormatFloat(apps[app][name], 'g', -1, 64))
+			buf.WriteByte('\n')
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
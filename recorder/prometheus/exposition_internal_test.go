@@ -0,0 +1,90 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+func TestMetricName(t *testing.T) {
+	tcs := []struct {
+		key  string
+		want string
+	}{
+		{"Alloc", "Alloc"},
+		{"memstats.HeapAlloc", "memstats_HeapAlloc"},
+		{"a-b c", "a_b_c"},
+		{"ns:rate_5m", "ns:rate_5m"},
+		{"99th", "_99th"},
+		{"", "_"},
+	}
+	for _, tc := range tcs {
+		if got := metricName(tc.key); got != tc.want {
+			t.Errorf("metricName(%q) = (%s); want (%s)", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestAddMetrics(t *testing.T) {
+	metrics := make(map[string]float64)
+	list := []datatype.DataType{
+		datatype.NewFloatType("float", 1.5),
+		datatype.NewStringType("string", "skipped"),
+		datatype.NewByteType("bytes", 2048),
+		datatype.NewFloatListType("list", []float64{1, 2, 6}),
+		datatype.NewGCListType("gc", []uint64{0, 2000, 4000}),
+		datatype.NewFloatListType("empty", nil),
+	}
+	for _, d := range list {
+		if err := addMetrics(metrics, d); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	want := map[string]float64{
+		"float":       1.5,
+		"bytes":       2048,
+		"list_count":  3,
+		"list_min":    1,
+		"list_max":    6,
+		"list_mean":   3,
+		"gc_count":    2,
+		"gc_min":      2,
+		"gc_max":      4,
+		"gc_mean":     3,
+		"empty_count": 0,
+	}
+	if len(metrics) != len(want) {
+		t.Errorf("metrics = (%v); want (%v)", metrics, want)
+	}
+	for k, v := range want {
+		if got, ok := metrics[k]; !ok || got != v {
+			t.Errorf("metrics[%s] = (%v, %t); want (%v)", k, got, ok, v)
+		}
+	}
+}
+
+func TestWriteExposition(t *testing.T) {
+	apps := map[string]map[string]float64{
+		"b_app":     {"value": 2, "other": 3},
+		`a"app\`:    {"value": 1},
+		"empty_app": {},
+	}
+	buf := new(bytes.Buffer)
+	if err := writeExposition(buf, apps); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := `# TYPE other gauge
+other{app="b_app"} 3
+# TYPE value gauge
+value{app="a\"app\\"} 1
+value{app="b_app"} 2
+`
+	if buf.String() != want {
+		t.Errorf("exposition = (%s); want (%s)", buf.String(), want)
+	}
+}
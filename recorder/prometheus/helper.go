@@ -0,0 +1,26 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"net"
+
+	"github.com/arsham/expipe/recorder"
+)
+
+// WithAddress sets the address the recorder listens on for the scrapes, e.g.
+// ":9273". Unlike recorder.WithEndpoint, it does not expect a URL.
+func WithAddress(address string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		if address == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return recorder.InvalidEndpointError(address)
+		}
+		e.SetEndpoint(address)
+		return nil
+	}
+}
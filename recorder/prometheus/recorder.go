@@ -0,0 +1,203 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package prometheus contains logic to expose the recorded data on an HTTP
+// endpoint in the Prometheus text exposition format. Unlike other recorders,
+// it does not push the data anywhere: it keeps the latest payload of each
+// TypeName in memory and Prometheus servers scrape them from the /metrics
+// path of the address the recorder listens on.
+//
+// The keys of the payloads are sanitised into valid metric names, and the
+// TypeName of the job is set as the "app" label:
+//
+//    memstats_Alloc{app="my_app"} 1.2345e+06
+//
+// Float and byte types are exposed as gauges, byte types in bytes. List types
+// are exposed with their statistics in _count, _min, _max and _mean metrics.
+// Strings are not exposed as Prometheus only accepts numbers.
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-------------------+----------------------+
+//   |  Expipe var name  | Prometheus Var Name  |
+//   +-------------------+----------------------+
+//   | prometheusRecords | Prometheus Records   |
+//   | prometheusScrapes | Prometheus Scrapes   |
+//   +-------------------+----------------------+
+package prometheus
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// MetricsPath is the path the metrics are served on.
+const MetricsPath = "/metrics"
+
+var (
+	prometheusRecords = expvar.NewInt("Prometheus Records")
+	prometheusScrapes = expvar.NewInt("Prometheus Scrapes")
+)
+
+// Recorder keeps the latest metrics of each TypeName and serves them to
+// Prometheus. It implements DataRecorder interface.
+type Recorder struct {
+	name      string
+	endpoint  string
+	indexName string
+	log       tools.FieldLogger
+	timeout   time.Duration
+
+	mu       sync.RWMutex
+	apps     map[string]map[string]float64 // TypeName -> metric -> value
+	listener net.Listener
+	server   *http.Server
+}
+
+// New returns an error if any of the options are invalid.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{apps: make(map[string]map[string]float64)}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "prometheus")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	return r, nil
+}
+
+// Ping starts listening on the address. It returns nil if it is already
+// listening.
+func (r *Recorder) Ping() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener != nil {
+		return nil
+	}
+	l, err := net.Listen("tcp", r.endpoint)
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, r)
+	server := &http.Server{Handler: mux, ReadTimeout: r.timeout, WriteTimeout: r.timeout}
+	r.listener, r.server = l, server
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			r.log.Errorf("%s: serving metrics: %v", r.name, err)
+		}
+	}()
+	return nil
+}
+
+// Record replaces the metrics of the job's TypeName with the ones in the
+// payload. It returns an error if the ping is not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	r.mu.RLock()
+	pinged := r.listener != nil
+	r.mu.RUnlock()
+	if !pinged {
+		return recorder.ErrPingNotCalled
+	}
+	metrics := make(map[string]float64)
+	for _, d := range job.Payload.List() {
+		if err := addMetrics(metrics, d); err != nil {
+			return errors.Wrap(err, "converting payload")
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.mu.Lock()
+	r.apps[job.TypeName] = metrics
+	r.mu.Unlock()
+	prometheusRecords.Add(1)
+	return nil
+}
+
+// ServeHTTP writes the latest metrics in the Prometheus text exposition
+// format.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	prometheusScrapes.Add(1)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeExposition(w, r.apps)
+}
+
+// Addr returns the address the recorder is listening on, or nil if it is not
+// listening. It is useful when the port is chosen by the system.
+func (r *Recorder) Addr() net.Addr {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Addr()
+}
+
+// Close stops the HTTP server.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.server == nil {
+		return nil
+	}
+	err := r.server.Close()
+	r.server, r.listener = nil, nil
+	return err
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the address the recorder listens on.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the address of the recorder.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the indexName the recorder should record as.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
@@ -0,0 +1,187 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package prometheus_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/prometheus"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func newRecorder(t *testing.T) *prometheus.Recorder {
+	rec, err := prometheus.New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		prometheus.WithAddress("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job(typeName string, list ...datatype.DataType) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New(list),
+		TypeName: typeName,
+		Time:     time.Now(),
+	}
+}
+
+func scrape(t *testing.T, rec *prometheus.Recorder) string {
+	res, err := http.Get("http://" + rec.Addr().String() + prometheus.MetricsPath)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = (%d); want (%d)", res.StatusCode, http.StatusOK)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return string(body)
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{prometheus.WithAddress(":9273")}},
+		{"no address", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"empty address", []func(recorder.Constructor) error{prometheus.WithAddress("")}},
+		{"url", []func(recorder.Constructor) error{prometheus.WithAddress("http://localhost:9273/metrics")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := prometheus.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	rec, err := prometheus.New(
+		recorder.WithName("name"),
+		prometheus.WithAddress("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.Addr() != nil {
+		t.Errorf("rec.Addr() = (%v); want (nil)", rec.Addr())
+	}
+	err = rec.Record(context.Background(), job("my_app"))
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rec.Close()
+	addr := rec.Addr()
+	if err = rec.Ping(); err != nil {
+		t.Errorf("second ping: err = (%v); want (nil)", err)
+	}
+	if rec.Addr().String() != addr.String() {
+		t.Errorf("rec.Addr() = (%s); want (%s)", rec.Addr(), addr)
+	}
+
+	taken, _ := prometheus.New(
+		recorder.WithName("name"),
+		prometheus.WithAddress(addr.String()),
+	)
+	err = taken.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	rec := newRecorder(t)
+	defer rec.Close()
+	ctx := context.Background()
+	err := rec.Record(ctx, job("my_app",
+		datatype.NewFloatType("memstats.Alloc", 10),
+		datatype.NewStringType("version", "1.0"),
+	))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Record(ctx, job("other_app", datatype.NewFloatType("memstats.Alloc", 20))); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body := scrape(t, rec)
+	for _, line := range []string{
+		"# TYPE memstats_Alloc gauge",
+		`memstats_Alloc{app="my_app"} 10`,
+		`memstats_Alloc{app="other_app"} 20`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("body = (%s); want (%s) in it", body, line)
+		}
+	}
+	if strings.Contains(body, "version") {
+		t.Errorf("body = (%s); strings should not be exposed", body)
+	}
+
+	// only the latest payload of each type name is kept.
+	if err = rec.Record(ctx, job("my_app", datatype.NewFloatType("Sys", 5))); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	body = scrape(t, rec)
+	if strings.Contains(body, `memstats_Alloc{app="my_app"}`) {
+		t.Errorf("body = (%s); the old metrics should be replaced", body)
+	}
+	if !strings.Contains(body, `Sys{app="my_app"} 5`) {
+		t.Errorf("body = (%s); want (Sys) in it", body)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = rec.Record(ctx, job("my_app")); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestClose(t *testing.T) {
+	rec := newRecorder(t)
+	addr := rec.Addr().String()
+	if err := rec.Close(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if rec.Addr() != nil {
+		t.Errorf("rec.Addr() = (%v); want (nil)", rec.Addr())
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("err = (nil); want (error)")
+	}
+	if err := rec.Close(); err != nil {
+		t.Errorf("second close: err = (%v); want (nil)", err)
+	}
+}
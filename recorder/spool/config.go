@@ -0,0 +1,82 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package spool
+
+import (
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a spool from the
+// spool section of a recorder in a configuration file. MaxSize is optional
+// and can be in bytes or have one of KB, MB or GB units, e.g. 100MB.
+type Config struct {
+	SpoolDir     string `mapstructure:"dir"`
+	SpoolMaxSize string `mapstructure:"max_size"`
+	log          tools.FieldLogger
+	ConfMaxSize  int64
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Spool returns a Spool with the configuration.
+func (c *Config) Spool() (*Spool, error) {
+	return New(c.SpoolDir, c.ConfMaxSize, c.Logger())
+}
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error if the key or the directory is empty.
+func WithViper(v unmarshaller, key string) Conf {
+	return func(c *Config) error {
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.SpoolDir == "" {
+			return errors.New("dir cannot be empty")
+		}
+		if c.ConfMaxSize, err = tools.ParseSize(c.SpoolMaxSize); err != nil {
+			return errors.Wrapf(err, "parse max_size (%v)", c.SpoolMaxSize)
+		}
+		return nil
+	}
+}
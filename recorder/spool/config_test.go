@@ -0,0 +1,112 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package spool_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/arsham/expipe/recorder/spool"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(spool.Config)
+	err := spool.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = spool.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func TestWithViperErrors(t *testing.T) {
+	c := new(spool.Config)
+	if err := spool.WithViper(viper.New(), "")(c); err == nil {
+		t.Error("no key: err = (nil); want (error)")
+	}
+	if err := spool.WithViper(nil, "key")(c); err == nil {
+		t.Error("no viper: err = (nil); want (error)")
+	}
+	if err := spool.WithViper(&badMarshaller{}, "key")(c); err == nil {
+		t.Error("bad marshaller: err = (nil); want (error)")
+	}
+	for _, section := range []string{"max_size: 10MB", "dir: /tmp\n                max_size: lots"} {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            spool:
+                ` + section + `
+    `)))
+		c = new(spool.Config)
+		if err := spool.WithViper(v, "recorders.recorder1.spool")(c); err == nil {
+			t.Errorf("err = (nil); want (error): %s", section)
+		}
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            spool:
+                dir: ` + filepath.Join(dir, "recorder1") + `
+                max_size: 10MB
+    `)))
+	c, err := spool.NewConfig(
+		spool.WithViper(v, "recorders.recorder1.spool"),
+		spool.WithLogger(tools.DiscardLogger()),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.ConfMaxSize != 10<<20 {
+		t.Errorf("c.ConfMaxSize = (%d); want (%d)", c.ConfMaxSize, 10<<20)
+	}
+	s, err := c.Spool()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if s.Dir() != filepath.Join(dir, "recorder1") {
+		t.Errorf("s.Dir() = (%s); want (%s)", s.Dir(), filepath.Join(dir, "recorder1"))
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := spool.NewConfig(spool.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	c, err = spool.NewConfig(spool.WithLogger(nil))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The kinds of the stored values.
+const (
+	floatKind     = "float"
+	stringKind    = "string"
+	byteKind      = "byte"
+	kiloByteKind  = "kilobyte"
+	megaByteKind  = "megabyte"
+	floatListKind = "float_list"
+	gcListKind    = "gc_list"
+	rawKind       = "raw"
+)
+
+// record is the stored form of a job.
+type record struct {
+	ID        string    `json:"id"`
+	TypeName  string    `json:"type_name"`
+	IndexName string    `json:"index_name"`
+	Time      time.Time `json:"time"`
+	Payload   []value   `json:"payload"`
+}
+
+// value is the stored form of a DataType. Unknown types are stored with
+// their content, and are given back as they were read.
+type value struct {
+	Kind  string          `json:"kind"`
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+func encode(job recorder.Job) ([]byte, error) {
+	r := record{
+		ID:        job.ID.String(),
+		TypeName:  job.TypeName,
+		IndexName: job.IndexName,
+		Time:      job.Time,
+	}
+	if job.Payload != nil {
+		for _, d := range job.Payload.List() {
+			v, err := encodeValue(d)
+			if err != nil {
+				return nil, err
+			}
+			r.Payload = append(r.Payload, v)
+		}
+	}
+	return json.Marshal(r)
+}
+
+func encodeValue(d datatype.DataType) (value, error) {
+	var (
+		v   value
+		obj interface{}
+	)
+	switch t := d.(type) {
+	case *datatype.FloatType:
+		v.Kind, v.Key, obj = floatKind, t.Key, t.Value
+	case *datatype.StringType:
+		v.Kind, v.Key, obj = stringKind, t.Key, t.Value
+	case *datatype.ByteType:
+		v.Kind, v.Key, obj = byteKind, t.Key, t.Value
+	case *datatype.KiloByteType:
+		v.Kind, v.Key, obj = kiloByteKind, t.Key, t.Value
+	case *datatype.MegaByteType:
+		v.Kind, v.Key, obj = megaByteKind, t.Key, t.Value
+	case *datatype.FloatListType:
+		v.Kind, v.Key, obj = floatListKind, t.Key, t.Value
+	case *datatype.GCListType:
+		v.Kind, v.Key, obj = gcListKind, t.Key, t.Value
+	default:
+		d.Reset()
+		content, err := ioutil.ReadAll(d)
+		d.Reset()
+		if err != nil {
+			return v, errors.Wrap(err, "reading value")
+		}
+		v.Kind, obj = rawKind, content
+	}
+	var err error
+	v.Value, err = json.Marshal(obj)
+	return v, err
+}
+
+func decode(data []byte) (recorder.Job, error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return recorder.Job{}, errors.Wrap(err, "decoding job")
+	}
+	id, err := uuid.FromString(r.ID)
+	if err != nil {
+		return recorder.Job{}, errors.Wrap(err, "decoding id")
+	}
+	list := make([]datatype.DataType, 0, len(r.Payload))
+	for _, v := range r.Payload {
+		d, err := decodeValue(v)
+		if err != nil {
+			return recorder.Job{}, errors.Wrapf(err, "decoding %s", v.Key)
+		}
+		list = append(list, d)
+	}
+	return recorder.Job{
+		ID:        token.ID(id),
+		Payload:   datatype.New(list),
+		TypeName:  r.TypeName,
+		IndexName: r.IndexName,
+		Time:      r.Time,
+	}, nil
+}
+
+func decodeValue(v value) (datatype.DataType, error) {
+	switch v.Kind {
+	case floatKind, byteKind, kiloByteKind, megaByteKind:
+		var f float64
+		if err := json.Unmarshal(v.Value, &f); err != nil {
+			return nil, err
+		}
+		switch v.Kind {
+		case byteKind:
+			return datatype.NewByteType(v.Key, f), nil
+		case kiloByteKind:
+			return datatype.NewKiloByteType(v.Key, f), nil
+		case megaByteKind:
+			return datatype.NewMegaByteType(v.Key, f), nil
+		}
+		return datatype.NewFloatType(v.Key, f), nil
+	case stringKind:
+		var s string
+		err := json.Unmarshal(v.Value, &s)
+		return datatype.NewStringType(v.Key, s), err
+	case floatListKind:
+		var list []float64
+		err := json.Unmarshal(v.Value, &list)
+		return datatype.NewFloatListType(v.Key, list), err
+	case gcListKind:
+		var list []uint64
+		err := json.Unmarshal(v.Value, &list)
+		return datatype.NewGCListType(v.Key, list), err
+	case rawKind:
+		var content []byte
+		err := json.Unmarshal(v.Value, &content)
+		return &rawType{content: content}, err
+	}
+	return nil, errors.Errorf("unknown kind: %q", v.Kind)
+}
+
+// rawType holds the content of a value that its type is not known to the
+// spool.
+type rawType struct {
+	content []byte
+	index   int
+}
+
+func (r *rawType) Read(b []byte) (int, error) {
+	if r.index >= len(r.content) {
+		return 0, io.EOF
+	}
+	n := copy(b, r.content[r.index:])
+	r.index += n
+	return n, nil
+}
+
+func (r *rawType) Reset() { r.index = 0 }
+
+func (r *rawType) Equal(other datatype.DataType) bool {
+	o, ok := other.(*rawType)
+	return ok && bytes.Equal(r.content, o.content)
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package spool
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools/token"
+)
+
+type unknownType struct{ rawType }
+
+func TestEncodeDecode(t *testing.T) {
+	unknown := &unknownType{rawType{content: []byte(`"unknown":1`)}}
+	list := []datatype.DataType{
+		datatype.NewFloatType("float", 1.5),
+		datatype.NewStringType("string", "value"),
+		datatype.NewByteType("byte", 1024),
+		datatype.NewKiloByteType("kilobyte", 2048),
+		datatype.NewMegaByteType("megabyte", 4096),
+		datatype.NewFloatListType("float_list", []float64{1, 2}),
+		datatype.NewGCListType("gc_list", []uint64{3, 4}),
+		unknown,
+	}
+	job := recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   datatype.New(list),
+		TypeName:  "type_name",
+		IndexName: "index_name",
+		Time:      time.Now(),
+	}
+	data, err := encode(job)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got.ID != job.ID || got.TypeName != job.TypeName || got.IndexName != job.IndexName || !got.Time.Equal(job.Time) {
+		t.Errorf("got = (%v); want (%v)", got, job)
+	}
+	if got.Payload.Len() != len(list) {
+		t.Fatalf("got.Payload.Len() = (%d); want (%d)", got.Payload.Len(), len(list))
+	}
+	for i, d := range list[:len(list)-1] {
+		if !d.Equal(got.Payload.List()[i]) {
+			t.Errorf("got.Payload.List()[%d] = (%v); want (%v)", i, got.Payload.List()[i], d)
+		}
+	}
+	content, _ := ioutil.ReadAll(got.Payload.List()[len(list)-1])
+	if string(content) != `"unknown":1` {
+		t.Errorf("content = (%s); want (%s)", content, `"unknown":1`)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tcs := []struct {
+		name string
+		data string
+	}{
+		{"not json", `{`},
+		{"bad id", `{"id":"nothing"}`},
+		{"bad kind", `{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","payload":[{"kind":"nothing","value":1}]}`},
+		{"bad value", `{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","payload":[{"kind":"float","value":"a"}]}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decode([]byte(tc.data)); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
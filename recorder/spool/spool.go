@@ -0,0 +1,343 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package spool contains logic to persist the jobs a recorder could not record
+// on the local disk, and replay them in order when the recorder recovers.
+//
+// Each job is written in its own file in the spool directory, named after a
+// sequence number that defines the order of the replay. The files are written
+// in full before they are renamed into place, therefore a crash never leaves a
+// partial job behind. When the spool grows over its maximum size, the oldest
+// jobs are dropped to make room for the new ones.
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-----------------+-----------------+
+//   | Expipe var name | Spool Var Name  |
+//   +-----------------+-----------------+
+//   | spoolJobs       | Spool Jobs      |
+//   | spoolReplayed   | Spool Replayed  |
+//   | spoolDropped    | Spool Dropped   |
+//   | spoolPending    | Spool Pending   |
+//   | spoolBytes      | Spool Bytes     |
+//   +-----------------+-----------------+
+package spool
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxSize is the maximum size of the spool, if not specified.
+const DefaultMaxSize = 100 << 20
+
+const (
+	jobExt  = ".job"
+	tempExt = ".tmp"
+)
+
+var (
+	spoolJobs     = expvar.NewInt("Spool Jobs")
+	spoolReplayed = expvar.NewInt("Spool Replayed")
+	spoolDropped  = expvar.NewInt("Spool Dropped")
+	spoolPending  = expvar.NewInt("Spool Pending")
+	spoolBytes    = expvar.NewInt("Spool Bytes")
+)
+
+// JobTooLargeError is returned when a job is larger than the maximum size of
+// the spool.
+type JobTooLargeError int64
+
+func (j JobTooLargeError) Error() string {
+	return fmt.Sprintf("job is larger than the spool: %d bytes", int64(j))
+}
+
+// item is a job that is stored on the disk.
+type item struct {
+	seq  uint64
+	size int64
+}
+
+// Spool persists the jobs on the disk. It is safe to use concurrently, and
+// each job is replayed once even if the spool is shared by several engines.
+type Spool struct {
+	dir     string
+	maxSize int64
+	log     tools.FieldLogger
+
+	replayMu sync.Mutex // one replay at a time, therefore each job is delivered once
+
+	mu    sync.Mutex
+	items []item // oldest first
+	size  int64
+	next  uint64
+}
+
+// New returns a Spool that stores the jobs in the dir, up to maxSize bytes.
+// If maxSize is zero, DefaultMaxSize is used. The directory is created if it
+// does not exist, and the jobs that are left from the previous runs are loaded
+// for replay.
+func New(dir string, maxSize int64, log tools.FieldLogger) (*Spool, error) {
+	if dir == "" {
+		return nil, errors.New("empty spool directory")
+	}
+	if maxSize < 0 {
+		return nil, fmt.Errorf("invalid max size: %d", maxSize)
+	}
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	if log == nil {
+		log = tools.GetLogger("error")
+	}
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		log:     log.WithField("spool", dir),
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "creating spool directory")
+	}
+	if err := s.load(); err != nil {
+		return nil, errors.Wrap(err, "loading spool")
+	}
+	return s, nil
+}
+
+// load finds the stored jobs and removes the unfinished writes.
+func (s *Spool) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, tempExt) {
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, jobExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, jobExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.items = append(s.items, item{seq: seq, size: f.Size()})
+		s.size += f.Size()
+	}
+	sort.Sort(bySeq(s.items))
+	if len(s.items) > 0 {
+		s.next = s.items[len(s.items)-1].seq + 1
+		s.log.Infof("%d jobs are waiting to be replayed", len(s.items))
+	}
+	spoolPending.Add(int64(len(s.items)))
+	spoolBytes.Add(s.size)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.makeRoom(0)
+	return nil
+}
+
+type bySeq []item
+
+func (b bySeq) Len() int           { return len(b) }
+func (b bySeq) Less(i, j int) bool { return b[i].seq < b[j].seq }
+func (b bySeq) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, jobExt))
+}
+
+// Push stores the job at the end of the spool. If the spool is full, the
+// oldest jobs are dropped.
+func (s *Spool) Push(job recorder.Job) error {
+	data, err := encode(job)
+	if err != nil {
+		return errors.Wrap(err, "encoding job")
+	}
+	size := int64(len(data))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size > s.maxSize {
+		return JobTooLargeError(size)
+	}
+	s.makeRoom(size)
+	seq := s.next
+	if err = writeFile(s.path(seq), data); err != nil {
+		return errors.Wrap(err, "writing job")
+	}
+	s.next++
+	s.items = append(s.items, item{seq: seq, size: size})
+	s.size += size
+	spoolJobs.Add(1)
+	spoolPending.Add(1)
+	spoolBytes.Add(size)
+	return nil
+}
+
+// writeFile writes the data in a temporary file and renames it to name when
+// it is synced to the disk.
+func writeFile(name string, data []byte) error {
+	tmp := strings.TrimSuffix(name, jobExt) + tempExt
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// makeRoom drops the oldest jobs until size bytes can be added. It should be
+// called while holding the lock.
+func (s *Spool) makeRoom(size int64) {
+	for len(s.items) > 0 && s.size+size > s.maxSize {
+		s.log.Warnf("spool is full, dropping job %d", s.items[0].seq)
+		s.removeItem(0)
+		spoolDropped.Add(1)
+	}
+}
+
+// removeItem removes the i-th job. It should be called while holding the lock.
+func (s *Spool) removeItem(i int) {
+	it := s.items[i]
+	if err := os.Remove(s.path(it.seq)); err != nil && !os.IsNotExist(err) {
+		s.log.Errorf("removing job %d: %v", it.seq, err)
+	}
+	s.items = append(s.items[:i], s.items[i+1:]...)
+	s.size -= it.size
+	spoolPending.Add(-1)
+	spoolBytes.Add(-it.size)
+}
+
+// remove removes the job with the seq if it still is in the spool.
+func (s *Spool) remove(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, it := range s.items {
+		if it.seq == seq {
+			s.removeItem(i)
+			return
+		}
+	}
+}
+
+// Replay calls fn with the stored jobs, from the oldest to the newest, and
+// removes each job when fn returns nil. It stops at the first error and keeps
+// the rest of the jobs for the next replay. It returns the number of the jobs
+// that are replayed. The jobs that can not be decoded are dropped. The
+// concurrent calls wait for each other, as they would otherwise deliver the
+// same jobs.
+func (s *Spool) Replay(ctx context.Context, fn func(recorder.Job) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	var n int
+	for {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		s.mu.Lock()
+		if len(s.items) == 0 {
+			s.mu.Unlock()
+			return n, nil
+		}
+		seq := s.items[0].seq
+		data, err := ioutil.ReadFile(s.path(seq))
+		s.mu.Unlock()
+
+		var job recorder.Job
+		if err == nil {
+			job, err = decode(data)
+		}
+		if err != nil {
+			s.log.Errorf("dropping unreadable job %d: %v", seq, err)
+			s.remove(seq)
+			spoolDropped.Add(1)
+			continue
+		}
+		if err = fn(job); err != nil {
+			return n, err
+		}
+		s.remove(seq)
+		spoolReplayed.Add(1)
+		n++
+	}
+}
+
+// Len returns the number of the stored jobs.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// Size returns the size of the stored jobs in bytes.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close releases the spool. The jobs stay on the disk and are loaded by the
+// next Spool of the directory. The spool should not be used after it is
+// closed.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spoolPending.Add(-int64(len(s.items)))
+	spoolBytes.Add(-s.size)
+	s.items, s.size = nil, 0
+	return nil
+}
+
+// SetMaxSize changes the maximum size of the spool. If maxSize is zero,
+// DefaultMaxSize is used. If the stored jobs are larger than the new size, the
+// oldest ones are dropped.
+func (s *Spool) SetMaxSize(maxSize int64) error {
+	if maxSize < 0 {
+		return fmt.Errorf("invalid max size: %d", maxSize)
+	}
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxSize = maxSize
+	s.makeRoom(0)
+	return nil
+}
+
+// MaxSize returns the maximum size of the spool in bytes.
+func (s *Spool) MaxSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxSize
+}
+
+// Dir returns the directory of the spool.
+func (s *Spool) Dir() string { return s.dir }
@@ -0,0 +1,318 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package spool_test
+
+import (
+	"context"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/spool"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func newSpool(t *testing.T, dir string, maxSize int64) *spool.Spool {
+	s, err := spool.New(dir, maxSize, tools.DiscardLogger())
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return s
+}
+
+func job(n float64) recorder.Job {
+	return recorder.Job{
+		ID:        token.NewUID(),
+		Payload:   datatype.New([]datatype.DataType{datatype.NewFloatType("n", n)}),
+		TypeName:  "my_app",
+		IndexName: "my_index",
+		Time:      time.Unix(1500000000, 123456789),
+	}
+}
+
+func push(t *testing.T, s *spool.Spool, from, to int) {
+	for i := from; i <= to; i++ {
+		if err := s.Push(job(float64(i))); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+}
+
+// replay returns the n values of the replayed jobs.
+func replay(t *testing.T, s *spool.Spool) []float64 {
+	var got []float64
+	_, err := s.Replay(context.Background(), func(job recorder.Job) error {
+		got = append(got, job.Payload.List()[0].(*datatype.FloatType).Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return got
+}
+
+func checkValues(t *testing.T, got []float64, from, to int) {
+	if len(got) != to-from+1 {
+		t.Fatalf("got = (%v); want (%d to %d)", got, from, to)
+	}
+	for i, n := range got {
+		if n != float64(from+i) {
+			t.Fatalf("got = (%v); want (%d to %d)", got, from, to)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	if _, err := spool.New("", 0, nil); err == nil {
+		t.Error("empty dir: err = (nil); want (error)")
+	}
+	if _, err := spool.New(dir, -1, nil); err == nil {
+		t.Error("negative size: err = (nil); want (error)")
+	}
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, nil, 0600)
+	if _, err := spool.New(file, 0, nil); err == nil {
+		t.Error("file: err = (nil); want (error)")
+	}
+	s, err := spool.New(filepath.Join(dir, "a", "b"), 0, nil)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if s.Len() != 0 || s.Size() != 0 {
+		t.Errorf("s.Len() = (%d), s.Size() = (%d); want (0, 0)", s.Len(), s.Size())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 10)
+	if s.Len() != 10 {
+		t.Errorf("s.Len() = (%d); want (10)", s.Len())
+	}
+	if s.Size() == 0 {
+		t.Error("s.Size() = (0); want (size of the jobs)")
+	}
+
+	calls := 0
+	n, err := s.Replay(context.Background(), func(recorder.Job) error {
+		calls++
+		if calls > 3 {
+			return errors.New("recorder is down")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if n != 3 {
+		t.Errorf("n = (%d); want (3)", n)
+	}
+	checkValues(t, replay(t, s), 4, 10)
+	if s.Len() != 0 || s.Size() != 0 {
+		t.Errorf("s.Len() = (%d), s.Size() = (%d); want (0, 0)", s.Len(), s.Size())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	push(t, s, 1, 1)
+	if _, err = s.Replay(ctx, nil); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+func TestReplayJob(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	j := job(66)
+	if err := s.Push(j); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	s.Replay(context.Background(), func(got recorder.Job) error {
+		if got.ID != j.ID {
+			t.Errorf("got.ID = (%s); want (%s)", got.ID, j.ID)
+		}
+		if got.TypeName != j.TypeName || got.IndexName != j.IndexName {
+			t.Errorf("got = (%s, %s); want (%s, %s)", got.TypeName, got.IndexName, j.TypeName, j.IndexName)
+		}
+		if !got.Time.Equal(j.Time) {
+			t.Errorf("got.Time = (%s); want (%s)", got.Time, j.Time)
+		}
+		return nil
+	})
+}
+
+// The engines of a recorder share its spool, and replay it concurrently.
+func TestReplayConcurrently(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 100)
+	var (
+		mu        sync.Mutex
+		delivered = make(map[float64]int)
+		wg        sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Replay(context.Background(), func(job recorder.Job) error {
+				mu.Lock()
+				defer mu.Unlock()
+				delivered[job.Payload.List()[0].(*datatype.FloatType).Value]++
+				return nil
+			})
+			if err != nil {
+				t.Errorf("err = (%v); want (nil)", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(delivered) != 100 {
+		t.Errorf("len(delivered) = (%d); want (100)", len(delivered))
+	}
+	for n, count := range delivered {
+		if count != 1 {
+			t.Errorf("job %v is delivered (%d) times; want (1)", n, count)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("s.Len() = (%d); want (0)", s.Len())
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 5)
+	ioutil.WriteFile(filepath.Join(dir, "00000000000000000009.tmp"), []byte("partial"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("other"), 0600)
+
+	s = newSpool(t, dir, 0)
+	if s.Len() != 5 {
+		t.Errorf("s.Len() = (%d); want (5)", s.Len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000009.tmp")); !os.IsNotExist(err) {
+		t.Errorf("err = (%v); the unfinished write should be removed", err)
+	}
+	push(t, s, 6, 7)
+	checkValues(t, replay(t, s), 1, 7)
+}
+
+func TestClose(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	pending := expvar.Get("Spool Pending").(*expvar.Int)
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 3)
+	before := pending.Value()
+	if err := s.Close(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if got := before - pending.Value(); got != 3 {
+		t.Errorf("released pending = (%d); want (3)", got)
+	}
+	s = newSpool(t, dir, 0)
+	checkValues(t, replay(t, s), 1, 3)
+}
+
+func TestMaxSize(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 1)
+	size := s.Size()
+	replay(t, s)
+
+	s = newSpool(t, dir, 3*size)
+	push(t, s, 1, 5)
+	if s.Len() != 3 {
+		t.Errorf("s.Len() = (%d); want (3)", s.Len())
+	}
+	if s.Size() > 3*size {
+		t.Errorf("s.Size() = (%d); want (<= %d)", s.Size(), 3*size)
+	}
+	checkValues(t, replay(t, s), 3, 5)
+
+	err := s.Push(recorder.Job{
+		ID:      token.NewUID(),
+		Payload: datatype.New([]datatype.DataType{datatype.NewStringType("n", string(make([]byte, 4*size)))}),
+	})
+	if _, ok := errors.Cause(err).(spool.JobTooLargeError); !ok {
+		t.Errorf("err = (%#v); want (spool.JobTooLargeError)", err)
+	}
+
+	// a smaller limit drops the oldest stored jobs.
+	s = newSpool(t, dir, 0)
+	push(t, s, 1, 5)
+	s = newSpool(t, dir, 2*size)
+	checkValues(t, replay(t, s), 4, 5)
+}
+
+func TestSetMaxSize(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 1)
+	size := s.Size()
+	push(t, s, 2, 5)
+	if err := s.SetMaxSize(-1); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if err := s.SetMaxSize(10 * size); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if s.MaxSize() != 10*size {
+		t.Errorf("s.MaxSize() = (%d); want (%d)", s.MaxSize(), 10*size)
+	}
+	if s.Len() != 5 {
+		t.Errorf("s.Len() = (%d); want (5)", s.Len())
+	}
+	if err := s.SetMaxSize(2 * size); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	checkValues(t, replay(t, s), 4, 5)
+	if err := s.SetMaxSize(0); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if s.MaxSize() != spool.DefaultMaxSize {
+		t.Errorf("s.MaxSize() = (%d); want (%d)", s.MaxSize(), spool.DefaultMaxSize)
+	}
+}
+
+func TestReplayCorrupted(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	s := newSpool(t, dir, 0)
+	push(t, s, 1, 3)
+	ioutil.WriteFile(filepath.Join(dir, "00000000000000000001.job"), []byte("{not json"), 0600)
+	s = newSpool(t, dir, 0)
+	got := replay(t, s)
+	if len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("got = (%v); want ([1 3])", got)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a SQL recorder from
+// a configuration file. The driver can be either "sqlite3" (default) or
+// "postgres", and the mode can be either "wide" (default) or "narrow". The
+// index_name is the table name in the narrow mode, and the prefix of the
+// tables in the wide mode.
+type Config struct {
+	SQLDSN       string `mapstructure:"dsn"`
+	SQLDriver    string `mapstructure:"driver"`
+	SQLMode      string `mapstructure:"mode"`
+	SQLTimeout   string `mapstructure:"timeout"`
+	SQLIndexName string `mapstructure:"index_name"`
+	log          tools.FieldLogger
+	SQLName      string
+	ConfTimeout  time.Duration
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		WithDSN(c.Endpoint()),
+		recorder.WithName(c.Name()),
+	}
+	if c.SQLIndexName != "" {
+		options = append(options, recorder.WithIndexName(c.IndexName()))
+	}
+	if c.ConfTimeout != 0 {
+		options = append(options, recorder.WithTimeout(c.Timeout()))
+	}
+	if c.SQLDriver != "" {
+		options = append(options, WithDriver(c.SQLDriver))
+	}
+	if c.SQLMode != "" {
+		options = append(options, WithMode(c.SQLMode))
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.SQLName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.SQLIndexName }
+
+// Endpoint return the data source name.
+func (c *Config) Endpoint() string { return c.SQLDSN }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if c.SQLTimeout != "" {
+			if timeout, err = time.ParseDuration(c.SQLTimeout); err != nil {
+				return &recorder.ParseTimeOutError{Timeout: c.SQLTimeout, Err: err}
+			}
+		}
+		if c.SQLDSN == "" {
+			return errors.New("dsn cannot be empty")
+		}
+		if _, ok := dialects[c.SQLDriver]; !ok && c.SQLDriver != "" {
+			return InvalidDriverError(c.SQLDriver)
+		}
+		switch c.SQLMode {
+		case "", Wide, Narrow:
+		default:
+			return InvalidModeError(c.SQLMode)
+		}
+		c.SQLName = name
+		c.ConfTimeout = timeout
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported drivers.
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+// InvalidDriverError is returned when the driver is not supported.
+type InvalidDriverError string
+
+func (e InvalidDriverError) Error() string {
+	return fmt.Sprintf("unsupported driver: %s", string(e))
+}
+
+// dialect holds the differences of the databases.
+type dialect struct {
+	timeType  string
+	floatType string
+	textType  string
+	// maxIdentifier is the length of the longest identifier in bytes, zero
+	// means no limit.
+	maxIdentifier int
+	// placeholder returns the i'th placeholder of a statement, starting from 1.
+	placeholder func(i int) string
+}
+
+var dialects = map[string]dialect{
+	SQLite: {
+		timeType:    "TIMESTAMP",
+		floatType:   "REAL",
+		textType:    "TEXT",
+		placeholder: func(int) string { return "?" },
+	},
+	Postgres: {
+		timeType:      "TIMESTAMP WITH TIME ZONE",
+		floatType:     "DOUBLE PRECISION",
+		textType:      "TEXT",
+		maxIdentifier: 63, // the longer ones are truncated silently.
+		placeholder:   func(i int) string { return "$" + strconv.Itoa(i) },
+	},
+}
+
+// columnType returns the type of the column that holds the value.
+func (d dialect) columnType(value interface{}) string {
+	if _, ok := value.(string); ok {
+		return d.textType
+	}
+	return d.floatType
+}
+
+// identifier returns the name of the table or the column, as the database
+// keeps it. The names that are longer than the identifiers of the database are
+// truncated, and the hash of the name is appended to tell apart the names with
+// the same prefix.
+func (d dialect) identifier(name string) string {
+	if d.maxIdentifier == 0 || len(name) <= d.maxIdentifier {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	n := d.maxIdentifier - len(suffix)
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n] + suffix
+}
+
+// placeholders returns n placeholders separated by commas.
+func (d dialect) placeholders(n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = d.placeholder(i + 1)
+	}
+	return strings.Join(p, ",")
+}
+
+// quote returns the identifier in double quotes, which both databases
+// support. Double quotes in the name are escaped.
+func quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// tableName turns the name into a lower case name that can be used without
+// quotes in the queries.
+func tableName(name string) string {
+	b := []byte(strings.ToLower(name))
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var (
+	urlPassword      = regexp.MustCompile(`(://[^:/@]*:)[^@/]*@`)
+	keyValuePassword = regexp.MustCompile(`(password=)\S+`)
+)
+
+// redact hides the password of the data source name, e.g. in the errors.
+func redact(dsn string) string {
+	dsn = urlPassword.ReplaceAllString(dsn, "${1}xxxxx@")
+	return keyValuePassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
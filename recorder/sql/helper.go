@@ -0,0 +1,66 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"fmt"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// InvalidModeError is returned when the mode is neither wide nor narrow.
+type InvalidModeError string
+
+func (e InvalidModeError) Error() string {
+	return fmt.Sprintf("invalid mode: %s", string(e))
+}
+
+// WithDSN sets the data source name of the database. Unlike
+// recorder.WithEndpoint, it does not expect a URL.
+func WithDSN(dsn string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		if dsn == "" {
+			return recorder.ErrEmptyEndpoint
+		}
+		e.SetEndpoint(dsn)
+		return nil
+	}
+}
+
+// WithDriver sets the database driver. It should be either SQLite (default)
+// or Postgres.
+func WithDriver(driver string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if _, ok := dialects[driver]; !ok {
+			return InvalidDriverError(driver)
+		}
+		r.driver = driver
+		return nil
+	}
+}
+
+// WithMode sets the mode of the tables. It should be either Wide (default) or
+// Narrow.
+func WithMode(mode string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		switch mode {
+		case Wide, Narrow:
+			r.mode = mode
+			return nil
+		}
+		return InvalidModeError(mode)
+	}
+}
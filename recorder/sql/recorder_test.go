@@ -0,0 +1,265 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql_test
+
+import (
+	"context"
+	gosql "database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/sql"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+func tempDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sql_recorder")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return filepath.Join(dir, "metrics.db"), func() { os.RemoveAll(dir) }
+}
+
+func newRecorder(t *testing.T, dsn string, options ...func(recorder.Constructor) error) *sql.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		sql.WithDSN(dsn),
+	}, options...)
+	rec, err := sql.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job(list ...datatype.DataType) recorder.Job {
+	return recorder.Job{
+		ID:       token.NewUID(),
+		Payload:  datatype.New(list),
+		TypeName: "my_app",
+		Time:     time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func open(t *testing.T, dsn string) *gosql.DB {
+	db, err := gosql.Open(sql.SQLite, dsn)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return db
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{sql.WithDSN("metrics.db")}},
+		{"no dsn", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"empty dsn", []func(recorder.Constructor) error{sql.WithDSN("")}},
+		{"bad driver", []func(recorder.Constructor) error{sql.WithDriver("mysql")}},
+		{"bad mode", []func(recorder.Constructor) error{sql.WithMode("tall")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := sql.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	dsn, cleanup := tempDB(t)
+	defer cleanup()
+	rec, err := sql.New(
+		recorder.WithName("name"),
+		sql.WithDSN(dsn),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = rec.Record(context.Background(), job())
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	rec.Close()
+
+	rec, _ = sql.New(
+		recorder.WithName("name"),
+		sql.WithDSN(filepath.Join(dsn, "not", "a", "dir", "metrics.db")),
+	)
+	err = rec.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecordWide(t *testing.T) {
+	dsn, cleanup := tempDB(t)
+	defer cleanup()
+	rec := newRecorder(t, dsn)
+	defer rec.Close()
+	ctx := context.Background()
+
+	first := job(
+		datatype.NewFloatType("memstats.Alloc", 12.5),
+		datatype.NewStringType("version", "1.0"),
+		datatype.NewFloatType("id", 1), // reserved column
+	)
+	if err := rec.Record(ctx, first); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	// a new key is added as a new column.
+	second := job(
+		datatype.NewFloatType("memstats.Alloc", 13),
+		datatype.NewFloatListType("list", []float64{1, 3}),
+	)
+	second.Time = second.Time.Add(time.Second)
+	if err := rec.Record(ctx, second); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	db := open(t, dsn)
+	defer db.Close()
+	rows, err := db.Query(`SELECT "id", "memstats.Alloc", "version", "list.mean" FROM expipe_my_app ORDER BY "time"`)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rows.Close()
+	var (
+		ids     []string
+		allocs  []float64
+		version gosql.NullString
+		mean    gosql.NullFloat64
+	)
+	for rows.Next() {
+		var id string
+		var alloc float64
+		if err = rows.Scan(&id, &alloc, &version, &mean); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		ids = append(ids, id)
+		allocs = append(allocs, alloc)
+	}
+	if len(ids) != 2 || ids[0] != first.ID.String() {
+		t.Fatalf("ids = (%v); want ([%s %s])", ids, first.ID, second.ID)
+	}
+	if allocs[0] != 12.5 || allocs[1] != 13 {
+		t.Errorf("allocs = (%v); want ([12.5 13])", allocs)
+	}
+	if version.Valid || !mean.Valid || mean.Float64 != 2 {
+		t.Errorf("version, mean = (%v, %v); want (NULL, 2)", version, mean)
+	}
+
+	// a new recorder finds the existing columns.
+	rec2 := newRecorder(t, dsn)
+	defer rec2.Close()
+	if err = rec2.Record(ctx, second); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = rec.Record(ctx, first); err != context.Canceled {
+		t.Errorf("err = (%v); want (%v)", err, context.Canceled)
+	}
+}
+
+// Closing the recorder, e.g. on reload, while a job is being recorded should
+// not panic.
+func TestRecordWhileClosing(t *testing.T) {
+	dsn, cleanup := tempDB(t)
+	defer cleanup()
+	for _, mode := range []string{sql.Wide, sql.Narrow} {
+		rec := newRecorder(t, dsn, sql.WithMode(mode))
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := rec.Record(context.Background(), job(datatype.NewFloatType("memstats.Alloc", 1)))
+					if err == recorder.ErrPingNotCalled {
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		rec.Close()
+		wg.Wait()
+	}
+}
+
+func TestRecordNarrow(t *testing.T) {
+	dsn, cleanup := tempDB(t)
+	defer cleanup()
+	rec := newRecorder(t, dsn, sql.WithMode(sql.Narrow))
+	defer rec.Close()
+
+	j := job(
+		datatype.NewFloatType("memstats.Alloc", 12.5),
+		datatype.NewStringType("version", "1.0"),
+		datatype.NewFloatListType("list", []float64{1, 3}),
+	)
+	if err := rec.Record(context.Background(), j); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	db := open(t, dsn)
+	defer db.Close()
+	rows, err := db.Query(`SELECT type_name, key, value FROM expipe ORDER BY key`)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rows.Close()
+	got := make(map[string]float64)
+	for rows.Next() {
+		var typeName, key string
+		var value float64
+		if err = rows.Scan(&typeName, &key, &value); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		if typeName != "my_app" {
+			t.Errorf("type_name = (%s); want (my_app)", typeName)
+		}
+		got[key] = value
+	}
+	want := map[string]float64{
+		"memstats.Alloc": 12.5,
+		"list.count":     2,
+		"list.min":       1,
+		"list.max":       3,
+		"list.mean":      2,
+	}
+	if len(got) != len(want) {
+		t.Errorf("rows = (%v); want (%v)", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("rows[%s] = (%v); want (%v)", k, got[k], v)
+		}
+	}
+}
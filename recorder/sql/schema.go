@@ -0,0 +1,176 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Reserved columns of the wide tables. The payload keys with the same names
+// are not recorded.
+const (
+	timeColumn = "time"
+	idColumn   = "id"
+)
+
+// createWide creates the wide table if it does not exist.
+func (r *Recorder) createWide(ctx context.Context, db *gosql.DB, table string) error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s NOT NULL, %s %s)",
+		quote(table),
+		quote(timeColumn), r.dialect.timeType,
+		quote(idColumn), r.dialect.textType,
+	)
+	_, err := db.ExecContext(ctx, query)
+	return errors.Wrapf(err, "creating table %s", table)
+}
+
+// createNarrow creates the narrow table and its index if they do not exist.
+func (r *Recorder) createNarrow(ctx context.Context, db *gosql.DB, table string) error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s NOT NULL, %s %s NOT NULL, %s %s NOT NULL, %s %s)",
+		quote(table),
+		quote("time"), r.dialect.timeType,
+		quote("type_name"), r.dialect.textType,
+		quote("key"), r.dialect.textType,
+		quote("value"), r.dialect.floatType,
+	)
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return errors.Wrapf(err, "creating table %s", table)
+	}
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s, %s, %s)",
+		quote(r.dialect.identifier(table+"_type_name_key_time")), quote(table),
+		quote("type_name"), quote("key"), quote("time"),
+	)
+	_, err := db.ExecContext(ctx, query)
+	return errors.Wrapf(err, "creating index on %s", table)
+}
+
+// columns returns the columns of the table.
+func (r *Recorder) columns(ctx context.Context, db *gosql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1=0", quote(table)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading columns of %s", table)
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading columns of %s", table)
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// migrate creates the wide table and adds the columns that are not in the
+// table yet. The keys of the values should be the column names of the
+// dialect. The type of each new column is decided by the value it is first
+// seen with. The columns are cached, so the database is only queried when new
+// keys appear.
+func (r *Recorder) migrate(ctx context.Context, db *gosql.DB, table string, values map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	columns, ok := r.tables[table]
+	if !ok {
+		if err := r.createWide(ctx, db, table); err != nil {
+			return err
+		}
+		var err error
+		if columns, err = r.columns(ctx, db, table); err != nil {
+			return err
+		}
+		r.tables[table] = columns
+	}
+	var missing []string
+	for key := range values {
+		if !columns[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quote(table), quote(key), r.dialect.columnType(values[key]))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			// another process might have added the column.
+			fresh, cerr := r.columns(ctx, db, table)
+			if cerr != nil || !fresh[key] {
+				return errors.Wrapf(err, "adding column %s to %s", key, table)
+			}
+			r.tables[table] = fresh
+			columns = fresh
+			continue
+		}
+		sqlMigrations.Add(1)
+		columns[key] = true
+	}
+	return nil
+}
+
+// insertWide inserts the values in one row of the wide table.
+// The keys are stored in the columns named by the dialect.
+func (r *Recorder) insertWide(ctx context.Context, db *gosql.DB, table string, job jobValues) error {
+	values := make(map[string]interface{}, len(job.values))
+	for key, value := range job.values {
+		values[r.dialect.identifier(key)] = value
+	}
+	if err := r.migrate(ctx, db, table, values); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	columns := []string{quote(timeColumn), quote(idColumn)}
+	args := []interface{}{job.time, job.id}
+	for _, key := range keys {
+		columns = append(columns, quote(key))
+		args = append(args, values[key])
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quote(table), strings.Join(columns, ","), r.dialect.placeholders(len(columns)),
+	)
+	_, err := db.ExecContext(ctx, query, args...)
+	return errors.Wrapf(err, "inserting into %s", table)
+}
+
+// insertNarrow inserts each numeric value in its own row of the narrow table,
+// in one transaction.
+func (r *Recorder) insertNarrow(ctx context.Context, db *gosql.DB, table string, job jobValues) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES (%s)",
+		quote(table), quote("time"), quote("type_name"), quote("key"), quote("value"),
+		r.dialect.placeholders(4),
+	)
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "preparing insert into %s", table)
+	}
+	defer stmt.Close()
+	for key, value := range job.values {
+		v, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		if _, err = stmt.ExecContext(ctx, job.time, job.typeName, key, v); err != nil {
+			return errors.Wrapf(err, "inserting into %s", table)
+		}
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+)
+
+// The keys and the type names that are longer than the identifiers of the
+// database should be recorded in their own columns and tables, whose names are
+// shorter than the limit.
+func TestRecordLongKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql_recorder")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := filepath.Join(dir, "metrics.db")
+	rec, err := New(
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		recorder.WithIndexName("expipe"),
+		WithDSN(dsn),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rec.Close()
+	// SQLite does not truncate the names, so it is limited as PostgreSQL.
+	rec.dialect.maxIdentifier = dialects[Postgres].maxIdentifier
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+
+	prefix := strings.Repeat("memstats.", 8) // 72 bytes
+	keys := []string{prefix + "Alloc", prefix + "Sys"}
+	typeName := strings.Repeat("my_app_", 10) // 70 bytes
+	for i := 0; i < 2; i++ {
+		job := recorder.Job{
+			ID: token.NewUID(),
+			Payload: datatype.New([]datatype.DataType{
+				datatype.NewFloatType(keys[0], float64(i)),
+				datatype.NewFloatType(keys[1], float64(i+10)),
+			}),
+			TypeName: typeName,
+			Time:     time.Date(2017, 11, 5, 10, 0, i, 0, time.UTC),
+		}
+		if err = rec.Record(context.Background(), job); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+
+	db, err := gosql.Open(SQLite, dsn)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer db.Close()
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		columns[i] = quote(rec.dialect.identifier(key))
+	}
+	table := rec.table("expipe_" + typeName)
+	if len(table) > 63 {
+		t.Errorf("len(%s) = (%d); want (<= 63)", table, len(table))
+	}
+	rows, err := db.Query(`SELECT ` + strings.Join(columns, ",") + ` FROM ` + quote(table) + ` ORDER BY "time"`)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer rows.Close()
+	names, _ := rows.Columns()
+	for _, name := range names {
+		if len(name) > 63 {
+			t.Errorf("len(%s) = (%d); want (<= 63)", name, len(name))
+		}
+	}
+	var got [][2]float64
+	for rows.Next() {
+		var v [2]float64
+		if err = rows.Scan(&v[0], &v[1]); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		got = append(got, v)
+	}
+	if len(got) != 2 || got[0] != [2]float64{0, 10} || got[1] != [2]float64{1, 11} {
+		t.Errorf("values = (%v); want ([[0 10] [1 11]])", got)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package sql
+
+import (
+	"math"
+
+	"github.com/arsham/expipe/datatype"
+)
+
+// values returns the values of the payload by their keys. The values are
+// either float64 or string.
+func values(payload datatype.DataContainer) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, d := range payload.List() {
+		if err := addValues(result, d); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// addValues adds the values of d to result. Byte types are recorded in the
+// same unit they are presented in the payload, and list types are recorded
+// with their count, min, max and mean.
+func addValues(result map[string]interface{}, d datatype.DataType) error {
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		switch v := value.(type) {
+		case float64:
+			addFloat(result, key, v)
+		case string:
+			result[key] = v
+		case []float64:
+			datatype.Summarise(v, func(name string, v float64) {
+				addFloat(result, key+"."+name, v)
+			})
+		}
+	})
+}
+
+func addFloat(result map[string]interface{}, key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	result[key] = v
+}
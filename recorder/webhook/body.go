@@ -0,0 +1,68 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"text/template"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+)
+
+// DefaultTemplate is used when no templates are provided. It produces a JSON
+// object like this:
+//
+//    {"id":"...","type_name":"my_app","time":"2017-11-05T10:00:00Z","payload":{"memstats.Alloc":12.5}}
+const DefaultTemplate = `{"id":{{json .ID}},"type_name":{{json .TypeName}},"time":{{json .Time}},"payload":{{json .Payload}}}`
+
+// funcs are available in the templates.
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Data is passed to the body templates. The Payload is a map of the keys to
+// their values: float64 for numbers, string for strings and []float64 for
+// lists. Byte types are in the unit they are presented in.
+type Data struct {
+	ID        string
+	TypeName  string
+	IndexName string
+	Time      time.Time
+	Payload   map[string]interface{}
+}
+
+// parseTemplate returns an error if the text is not a valid template.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("body").Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// newData flattens the payload of the job into a Data.
+func newData(job recorder.Job, indexName string) (*Data, error) {
+	payload := make(map[string]interface{})
+	for _, d := range job.Payload.List() {
+		if err := flatten(payload, d); err != nil {
+			return nil, err
+		}
+	}
+	return &Data{
+		ID:        job.ID.String(),
+		TypeName:  job.TypeName,
+		IndexName: indexName,
+		Time:      job.Time,
+		Payload:   payload,
+	}, nil
+}
+
+// flatten adds the value of d to payload.
+func flatten(payload map[string]interface{}, d datatype.DataType) error {
+	return datatype.Flatten(d, func(key string, value interface{}) {
+		payload[key] = value
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a webhook recorder
+// from a configuration file. The body can be given inline with template, or in
+// a file with template_file, but not both. The DefaultTemplate is used if none
+// is given. The status_codes is a list of the successful status codes.
+type Config struct {
+	WebhookEndpoint     string            `mapstructure:"endpoint"`
+	WebhookTimeout      string            `mapstructure:"timeout"`
+	WebhookIndexName    string            `mapstructure:"index_name"`
+	WebhookMethod       string            `mapstructure:"method"`
+	WebhookHeaders      map[string]string `mapstructure:"headers"`
+	WebhookTemplate     string            `mapstructure:"template"`
+	WebhookTemplateFile string            `mapstructure:"template_file"`
+	WebhookStatusCodes  []int             `mapstructure:"status_codes"`
+	log                 tools.FieldLogger
+	WebhookName         string
+	ConfTimeout         time.Duration
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Recorder implements the RecorderConf interface.
+func (c *Config) Recorder() (recorder.DataRecorder, error) {
+	options := []func(recorder.Constructor) error{
+		recorder.WithLogger(c.Logger()),
+		recorder.WithEndpoint(c.Endpoint()),
+		recorder.WithName(c.Name()),
+		recorder.WithTimeout(c.Timeout()),
+	}
+	if c.WebhookIndexName != "" {
+		options = append(options, recorder.WithIndexName(c.IndexName()))
+	}
+	if c.WebhookMethod != "" {
+		options = append(options, WithMethod(c.WebhookMethod))
+	}
+	for k, v := range c.WebhookHeaders {
+		options = append(options, WithHeader(k, v))
+	}
+	if c.WebhookTemplate != "" {
+		options = append(options, WithTemplate(c.WebhookTemplate))
+	}
+	if c.WebhookTemplateFile != "" {
+		options = append(options, WithTemplateFile(c.WebhookTemplateFile))
+	}
+	if len(c.WebhookStatusCodes) > 0 {
+		options = append(options, WithStatusCodes(c.WebhookStatusCodes...))
+	}
+	return New(options...)
+}
+
+// Name return the name.
+func (c *Config) Name() string { return c.WebhookName }
+
+// IndexName return the index name.
+func (c *Config) IndexName() string { return c.WebhookIndexName }
+
+// Endpoint return the endpoint.
+func (c *Config) Endpoint() string { return c.WebhookEndpoint }
+
+// Timeout return the timeout.
+func (c *Config) Timeout() time.Duration { return c.ConfTimeout }
+
+// Logger return the logger.
+func (c *Config) Logger() tools.FieldLogger { return c.log }
+
+// WithLogger produces an error if the log is nil.
+func WithLogger(log tools.FieldLogger) Conf {
+	return func(c *Config) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		c.log = log
+		return nil
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error any of the inputs are empty.
+func WithViper(v unmarshaller, name, key string) Conf {
+	return func(c *Config) error {
+		if name == "" {
+			return recorder.ErrEmptyName
+		}
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+
+		var timeout time.Duration
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		if timeout, err = time.ParseDuration(c.WebhookTimeout); err != nil {
+			return &recorder.ParseTimeOutError{Timeout: c.WebhookTimeout, Err: err}
+		}
+		if c.WebhookTemplate != "" && c.WebhookTemplateFile != "" {
+			return errors.New("template and template_file cannot be set at the same time")
+		}
+		c.WebhookName = name
+		c.ConfTimeout = timeout
+		return nil
+	}
+}
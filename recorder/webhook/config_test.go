@@ -0,0 +1,213 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package webhook_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/recorder/webhook"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestWithLogger(t *testing.T) {
+	l := (tools.FieldLogger)(nil)
+	c := new(webhook.Config)
+	err := webhook.WithLogger(l)(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	l = tools.DiscardLogger()
+	err = webhook.WithLogger(l)(c)
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c.Logger() != l {
+		t.Errorf("c.Logger() = (%v); want (%v)", c.Logger(), l)
+	}
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+func TestWithViper(t *testing.T) {
+	tcs := []struct {
+		tcName string
+		name   string
+		key    string
+		v      unmarshaller
+	}{
+		{"no name", "", "key", viper.New()},
+		{"no key", "name", "", viper.New()},
+		{"no viper", "name", "key", nil},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.tcName, func(t *testing.T) {
+			c := new(webhook.Config)
+			err := webhook.WithViper(tc.v, tc.name, tc.key)(c)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            endpoint: http://127.0.0.1:8080/collect
+            index_name: example_index
+            timeout: 10s
+            method: put
+            headers:
+                X-Token: secret
+            template: '{"value":{{index .Payload "a"}}}'
+            status_codes: [200, 202]
+    `))
+	v.ReadConfig(input)
+	c := new(webhook.Config)
+	err := webhook.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if c.Timeout() != 10*time.Second {
+		t.Errorf("c.Timeout() = (%d); want (%d)", c.Timeout(), 10*time.Second)
+	}
+	if c.Endpoint() != "http://127.0.0.1:8080/collect" {
+		t.Errorf("c.Endpoint() = (%s); want (http://127.0.0.1:8080/collect)", c.Endpoint())
+	}
+	if c.WebhookMethod != "put" || c.WebhookHeaders["x-token"] != "secret" {
+		t.Errorf("c = (%v); want method and headers", c)
+	}
+	if c.WebhookTemplate == "" || len(c.WebhookStatusCodes) != 2 {
+		t.Errorf("c = (%v); want template and status_codes", c)
+	}
+	if c.IndexName() != "example_index" {
+		t.Errorf("c.IndexName() = (%s); want (example_index)", c.IndexName())
+	}
+	if c.Name() != "recorder1" {
+		t.Errorf("c.Name() = (%s); want (recorder1)", c.Name())
+	}
+}
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func TestWithViperBadFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	input := bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                endpoint: http://127.0.0.1:8080
+                timeout: asas
+    `))
+	v.ReadConfig(input)
+	c := new(webhook.Config)
+	err := webhook.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                index_name: example_index
+    `))
+	v.ReadConfig(input)
+	c = new(webhook.Config)
+	err = webhook.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): no timeout")
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+                endpoint: http://127.0.0.1:8080
+                timeout: 1s
+                template: "{{.ID}}"
+                template_file: body.tmpl
+    `))
+	v.ReadConfig(input)
+	c = new(webhook.Config)
+	err = webhook.WithViper(v, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Fatal("err = (nil); want (error): template and template_file")
+	}
+
+	err = webhook.WithViper(&badMarshaller{}, "recorder1", "recorders.recorder1")(c)
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := webhook.NewConfig(webhook.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	if c == nil {
+		t.Error("c = (nil); want (Config)")
+	}
+	c, err = webhook.NewConfig(webhook.WithLogger(nil))
+	if err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+	if c != nil {
+		t.Errorf("c = (%v); want (nil)", c)
+	}
+}
+
+func TestConfigRecorder(t *testing.T) {
+	c, err := webhook.NewConfig(webhook.WithLogger(tools.DiscardLogger()))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	c.WebhookName = "name"
+	c.WebhookEndpoint = "http://127.0.0.1:8080"
+	c.ConfTimeout = time.Second
+	c.WebhookHeaders = map[string]string{"x-token": "secret"}
+	c.WebhookStatusCodes = []int{200}
+	rec, err := c.Recorder()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if rec.IndexName() != "name" {
+		t.Errorf("rec.IndexName() = (%s); want (name)", rec.IndexName())
+	}
+
+	tcs := []struct {
+		name   string
+		modify func(*webhook.Config)
+	}{
+		{"bad method", func(c *webhook.Config) { c.WebhookMethod = "GET" }},
+		{"bad template", func(c *webhook.Config) { c.WebhookTemplate = "{{.ID" }},
+		{"missing template file", func(c *webhook.Config) { c.WebhookTemplateFile = "/does/not/exist" }},
+		{"bad status code", func(c *webhook.Config) { c.WebhookStatusCodes = []int{1000} }},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := webhook.NewConfig(webhook.WithLogger(tools.DiscardLogger()))
+			c.WebhookName = "name"
+			c.WebhookEndpoint = "http://127.0.0.1:8080"
+			c.ConfTimeout = time.Second
+			tc.modify(c)
+			if _, err := c.Recorder(); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
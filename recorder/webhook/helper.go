@@ -0,0 +1,114 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+var errIncompatible = errors.New("incompatible recorder")
+
+// InvalidMethodError is returned when the method is not one of POST, PUT or
+// PATCH.
+type InvalidMethodError string
+
+func (e InvalidMethodError) Error() string {
+	return fmt.Sprintf("invalid method: %s", string(e))
+}
+
+// WithMethod sets the HTTP method of the requests. It should be one of POST
+// (default), PUT or PATCH.
+func WithMethod(method string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		method = strings.ToUpper(method)
+		switch method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			r.method = method
+			return nil
+		}
+		return InvalidMethodError(method)
+	}
+}
+
+// WithHeader adds a header to the requests. It replaces the previous values of
+// the same header.
+func WithHeader(key, value string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if key == "" {
+			return errors.New("empty header name")
+		}
+		if r.headers == nil {
+			r.headers = make(http.Header)
+		}
+		r.headers.Set(key, value)
+		return nil
+	}
+}
+
+// WithTemplate sets the text/template that renders the body of the requests.
+// The templates are executed with a Data object, and have a json function for
+// encoding the values:
+//
+//    {"app":{{json .TypeName}},"alloc":{{index .Payload "memstats.Alloc"}}}
+func WithTemplate(text string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			return errors.Wrap(err, "parsing template")
+		}
+		r.template = tmpl
+		return nil
+	}
+}
+
+// WithTemplateFile reads the template from the file. See WithTemplate.
+func WithTemplateFile(file string) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Wrap(err, "reading template file")
+		}
+		return WithTemplate(string(text))(e)
+	}
+}
+
+// WithStatusCodes sets the status codes that are considered successful. By
+// default all 2xx codes are successful.
+func WithStatusCodes(codes ...int) func(recorder.Constructor) error {
+	return func(e recorder.Constructor) error {
+		r, ok := e.(*Recorder)
+		if !ok {
+			return errIncompatible
+		}
+		if len(codes) == 0 {
+			return errors.New("no status codes")
+		}
+		for _, code := range codes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("invalid status code: %d", code)
+			}
+		}
+		r.statusCodes = codes
+		return nil
+	}
+}
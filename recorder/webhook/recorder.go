@@ -0,0 +1,222 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package webhook contains logic to send the jobs to any HTTP endpoint. The
+// body of each request is rendered with a text/template, which has access to
+// the ID, the TypeName, the IndexName and the Time of the job, and the
+// flattened payload. Please refer to the Data type for the details.
+//
+// The requests are sent with the POST method by default and the
+// "application/json" content type, unless it is set in the headers. The
+// recorder considers all 2xx responses as successful, unless the status codes
+// are specified.
+//
+// Collected metrics
+//
+// This list will grow in time:
+//
+//   +-----------------+---------------------+
+//   | Expipe var name |  Webhook Var Name   |
+//   +-----------------+---------------------+
+//   | webhookRecords  | Webhook Records     |
+//   +-----------------+---------------------+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+var webhookRecords = expvar.NewInt("Webhook Records")
+
+// ResponseError is returned when the server responds with a status code that
+// is not considered successful.
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e ResponseError) Error() string {
+	return fmt.Sprintf("unexpected response (%d): %s", e.StatusCode, e.Body)
+}
+
+// Recorder sends the payloads to an HTTP endpoint. It implements DataRecorder
+// interface.
+type Recorder struct {
+	name        string
+	endpoint    string
+	indexName   string
+	log         tools.FieldLogger
+	timeout     time.Duration
+	method      string
+	headers     http.Header
+	template    *template.Template
+	statusCodes []int
+
+	mu     sync.Mutex // guards pinged, as Ping can be called while recording
+	pinged bool
+}
+
+// New returns an error if any of the options are invalid.
+func New(options ...func(recorder.Constructor) error) (*Recorder, error) {
+	r := &Recorder{method: http.MethodPost}
+	for _, op := range options {
+		err := op(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "option creation")
+		}
+	}
+	if r.name == "" {
+		return nil, recorder.ErrEmptyName
+	}
+	if r.endpoint == "" {
+		return nil, recorder.ErrEmptyEndpoint
+	}
+	if r.log == nil {
+		r.log = tools.GetLogger("error")
+	}
+	r.log = r.log.WithField("engine", "webhook")
+	if r.indexName == "" {
+		r.indexName = r.name
+	}
+	if r.timeout == 0 {
+		r.timeout = 5 * time.Second
+	}
+	if r.template == nil {
+		r.template = template.Must(parseTemplate(DefaultTemplate))
+	}
+	if r.headers == nil {
+		r.headers = make(http.Header)
+	}
+	if r.headers.Get("Content-Type") == "" {
+		r.headers.Set("Content-Type", "application/json")
+	}
+	return r, nil
+}
+
+// Ping sends a HEAD request to the endpoint. As the endpoint might not support
+// the HEAD method, any responses are considered successful.
+func (r *Recorder) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	resp, err := ctxhttp.Head(ctx, nil, r.endpoint)
+	if err != nil {
+		return recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+	}
+	resp.Body.Close()
+	r.mu.Lock()
+	r.pinged = true
+	r.mu.Unlock()
+	return nil
+}
+
+// Record sends the rendered body to the endpoint. It returns an error if the
+// ping is not called.
+func (r *Recorder) Record(ctx context.Context, job recorder.Job) error {
+	r.mu.Lock()
+	pinged := r.pinged
+	r.mu.Unlock()
+	if !pinged {
+		return recorder.ErrPingNotCalled
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout())
+	defer cancel()
+	err := r.record(ctx, job)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*url.Error); ok {
+			err = recorder.EndpointNotAvailableError{Endpoint: r.endpoint, Err: err}
+		}
+		r.log.WithField("recorder", "webhook").
+			WithField("name", r.Name()).
+			WithField("ID", job.ID).
+			Debugf("%s: error making request: %v", r.name, err)
+		return err
+	}
+	return nil
+}
+
+func (r *Recorder) record(ctx context.Context, job recorder.Job) error {
+	indexName := job.IndexName
+	if indexName == "" {
+		indexName = r.indexName
+	}
+	data, err := newData(job, indexName)
+	if err != nil {
+		return errors.Wrap(err, "flattening payload")
+	}
+	buf := new(bytes.Buffer)
+	if err = r.template.Execute(buf, data); err != nil {
+		return errors.Wrap(err, "rendering body")
+	}
+	req, err := http.NewRequest(r.method, r.endpoint, buf)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	for k, v := range r.headers {
+		req.Header[k] = v
+	}
+	resp, err := ctxhttp.Do(ctx, nil, req)
+	if err != nil {
+		return errors.Wrap(err, "record payload")
+	}
+	defer resp.Body.Close()
+	if !r.successful(resp.StatusCode) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return ResponseError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+	}
+	webhookRecords.Add(1)
+	return ctx.Err()
+}
+
+func (r *Recorder) successful(code int) bool {
+	if len(r.statusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range r.statusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Name shows the name identifier for this recorder.
+func (r *Recorder) Name() string { return r.name }
+
+// SetName sets the name of the recorder.
+func (r *Recorder) SetName(name string) { r.name = name }
+
+// Endpoint returns the endpoint.
+func (r *Recorder) Endpoint() string { return r.endpoint }
+
+// SetEndpoint sets the endpoint of the recorder.
+func (r *Recorder) SetEndpoint(endpoint string) { r.endpoint = endpoint }
+
+// IndexName shows the indexName the recorder should record as.
+func (r *Recorder) IndexName() string { return r.indexName }
+
+// SetIndexName sets the index name of the recorder.
+func (r *Recorder) SetIndexName(indexName string) { r.indexName = indexName }
+
+// Timeout returns the time-out.
+func (r *Recorder) Timeout() time.Duration { return r.timeout }
+
+// SetTimeout sets the timeout of the recorder.
+func (r *Recorder) SetTimeout(timeout time.Duration) { r.timeout = timeout }
+
+// SetLogger sets the log of the recorder.
+func (r *Recorder) SetLogger(log tools.FieldLogger) { r.log = log }
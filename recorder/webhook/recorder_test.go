@@ -0,0 +1,247 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/recorder/webhook"
+	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/token"
+	"github.com/pkg/errors"
+)
+
+// request holds what the server has received.
+type request struct {
+	method string
+	header http.Header
+	body   string
+}
+
+func newServer(status int) (*httptest.Server, chan request) {
+	reqs := make(chan request, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		reqs <- request{method: r.Method, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+	return ts, reqs
+}
+
+func newRecorder(t *testing.T, url string, options ...func(recorder.Constructor) error) *webhook.Recorder {
+	options = append([]func(recorder.Constructor) error{
+		recorder.WithLogger(tools.DiscardLogger()),
+		recorder.WithName("name"),
+		recorder.WithEndpoint(url),
+		recorder.WithTimeout(time.Second),
+	}, options...)
+	rec, err := webhook.New(options...)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	return rec
+}
+
+func job() recorder.Job {
+	return recorder.Job{
+		ID: token.NewUID(),
+		Payload: datatype.New([]datatype.DataType{
+			datatype.NewFloatType("memstats.Alloc", 12.5),
+			datatype.NewStringType("version", "1.0"),
+			datatype.NewFloatListType("list", []float64{1, 2}),
+		}),
+		TypeName: "my_app",
+		Time:     time.Date(2017, 11, 5, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func receive(t *testing.T, reqs chan request) request {
+	select {
+	case r := <-reqs:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("no requests were received")
+	}
+	return request{}
+}
+
+func TestNewErrors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		options []func(recorder.Constructor) error
+	}{
+		{"no name", []func(recorder.Constructor) error{recorder.WithEndpoint("http://127.0.0.1")}},
+		{"no endpoint", []func(recorder.Constructor) error{recorder.WithName("a")}},
+		{"bad method", []func(recorder.Constructor) error{webhook.WithMethod("GET")}},
+		{"empty header", []func(recorder.Constructor) error{webhook.WithHeader("", "value")}},
+		{"bad template", []func(recorder.Constructor) error{webhook.WithTemplate("{{.ID")}},
+		{"no template file", []func(recorder.Constructor) error{webhook.WithTemplateFile("/does/not/exist")}},
+		{"no status codes", []func(recorder.Constructor) error{webhook.WithStatusCodes()}},
+		{"bad status code", []func(recorder.Constructor) error{webhook.WithStatusCodes(200, 42)}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := webhook.New(tc.options...)
+			if err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+			if rec != nil {
+				t.Errorf("rec = (%v); want (nil)", rec)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	ts, _ := newServer(http.StatusOK)
+	rec, err := webhook.New(
+		recorder.WithName("name"),
+		recorder.WithEndpoint(ts.URL),
+	)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	err = rec.Record(context.Background(), job())
+	if err != recorder.ErrPingNotCalled {
+		t.Errorf("err = (%v); want (%v)", err, recorder.ErrPingNotCalled)
+	}
+	if err = rec.Ping(); err != nil {
+		t.Errorf("err = (%v); want (nil)", err)
+	}
+	ts.Close()
+	err = rec.Ping()
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
+
+func TestRecordDefaultTemplate(t *testing.T) {
+	ts, reqs := newServer(http.StatusNoContent)
+	defer ts.Close()
+	rec := newRecorder(t, ts.URL)
+	j := job()
+	if err := rec.Record(context.Background(), j); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	r := receive(t, reqs)
+	if r.method != http.MethodPost {
+		t.Errorf("method = (%s); want (%s)", r.method, http.MethodPost)
+	}
+	if r.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = (%s); want (application/json)", r.header.Get("Content-Type"))
+	}
+	var body struct {
+		ID       string
+		TypeName string `json:"type_name"`
+		Time     time.Time
+		Payload  map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(r.body), &body); err != nil {
+		t.Fatalf("err = (%v); want (nil): %s", err, r.body)
+	}
+	if body.ID != j.ID.String() || body.TypeName != "my_app" || !body.Time.Equal(j.Time) {
+		t.Errorf("body = (%v); want the job's id, type name and time", body)
+	}
+	if body.Payload["memstats.Alloc"] != 12.5 || body.Payload["version"] != "1.0" {
+		t.Errorf("body.Payload = (%v); want the values", body.Payload)
+	}
+	if list, ok := body.Payload["list"].([]interface{}); !ok || len(list) != 2 {
+		t.Errorf(`body.Payload["list"] = (%v); want ([1 2])`, body.Payload["list"])
+	}
+}
+
+func TestRecordTemplate(t *testing.T) {
+	ts, reqs := newServer(http.StatusAccepted)
+	defer ts.Close()
+	tmpl := `{{.TypeName}} {{.IndexName}} {{.Time.Unix}}{{range $k, $v := .Payload}} {{$k}}={{$v}}{{end}}`
+	rec := newRecorder(t, ts.URL,
+		recorder.WithIndexName("expipe"),
+		webhook.WithMethod("put"),
+		webhook.WithHeader("Content-Type", "text/plain"),
+		webhook.WithHeader("X-Token", "secret"),
+		webhook.WithTemplate(tmpl),
+		webhook.WithStatusCodes(http.StatusAccepted),
+	)
+	if err := rec.Record(context.Background(), job()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	r := receive(t, reqs)
+	want := "my_app expipe 1509876000 list=[1 2] memstats.Alloc=12.5 version=1.0"
+	if r.body != want {
+		t.Errorf("body = (%s); want (%s)", r.body, want)
+	}
+	if r.method != http.MethodPut {
+		t.Errorf("method = (%s); want (%s)", r.method, http.MethodPut)
+	}
+	if r.header.Get("Content-Type") != "text/plain" || r.header.Get("X-Token") != "secret" {
+		t.Errorf("header = (%v); want (Content-Type and X-Token)", r.header)
+	}
+
+	// the template errors are returned.
+	rec = newRecorder(t, ts.URL, webhook.WithTemplate(`{{index .Payload "nothing" 0}}`))
+	if err := rec.Record(context.Background(), job()); err == nil {
+		t.Error("err = (nil); want (error)")
+	}
+}
+
+func TestRecordTemplateFile(t *testing.T) {
+	ts, reqs := newServer(http.StatusOK)
+	defer ts.Close()
+	f, err := ioutil.TempFile("", "webhook")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"alloc":{{json (index .Payload "memstats.Alloc")}}}`)
+	f.Close()
+
+	rec := newRecorder(t, ts.URL, webhook.WithTemplateFile(f.Name()))
+	if err = rec.Record(context.Background(), job()); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if r := receive(t, reqs); r.body != `{"alloc":12.5}` {
+		t.Errorf("body = (%s); want (%s)", r.body, `{"alloc":12.5}`)
+	}
+}
+
+func TestRecordStatusCodes(t *testing.T) {
+	ts, _ := newServer(http.StatusOK)
+	defer ts.Close()
+	rec := newRecorder(t, ts.URL, webhook.WithStatusCodes(http.StatusCreated))
+	err := rec.Record(context.Background(), job())
+	if e, ok := errors.Cause(err).(webhook.ResponseError); !ok || e.StatusCode != http.StatusOK {
+		t.Errorf("err = (%#v); want (webhook.ResponseError)", err)
+	}
+
+	ts500, _ := newServer(http.StatusInternalServerError)
+	defer ts500.Close()
+	rec = newRecorder(t, ts500.URL)
+	err = rec.Record(context.Background(), job())
+	if _, ok := errors.Cause(err).(webhook.ResponseError); !ok {
+		t.Errorf("err = (%#v); want (webhook.ResponseError)", err)
+	}
+
+	ts500.Close()
+	err = rec.Record(context.Background(), job())
+	if _, ok := errors.Cause(err).(recorder.EndpointNotAvailableError); !ok {
+		t.Errorf("err = (%#v); want (recorder.EndpointNotAvailableError)", err)
+	}
+}
@@ -7,15 +7,32 @@
 package config
 
 import (
+	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/reader"
 	"github.com/arsham/expipe/recorder"
 
 	"github.com/arsham/expipe/reader/expvar"
+	"github.com/arsham/expipe/reader/logfile"
+	"github.com/arsham/expipe/reader/prometheus"
 	"github.com/arsham/expipe/reader/self"
+	"github.com/arsham/expipe/reader/statsd"
 	"github.com/arsham/expipe/recorder/elasticsearch"
+	"github.com/arsham/expipe/recorder/file"
+	"github.com/arsham/expipe/recorder/graphite"
+	"github.com/arsham/expipe/recorder/influxdb"
+	"github.com/arsham/expipe/recorder/memory"
+	promrec "github.com/arsham/expipe/recorder/prometheus"
+	"github.com/arsham/expipe/recorder/spool"
+	"github.com/arsham/expipe/recorder/sql"
+	"github.com/arsham/expipe/recorder/webhook"
 	"github.com/arsham/expipe/tools"
+	"github.com/arsham/expipe/tools/retry"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -23,7 +40,17 @@ import (
 const (
 	selfReader            = "self"
 	expvarReader          = "expvar"
+	prometheusReader      = "prometheus"
+	logfileReader         = "logfile"
+	statsdReader          = "statsd"
 	elasticsearchRecorder = "elasticsearch"
+	influxdbRecorder      = "influxdb"
+	fileRecorder          = "file"
+	prometheusRecorder    = "prometheus"
+	graphiteRecorder      = "graphite"
+	webhookRecorder       = "webhook"
+	sqlRecorder           = "sql"
+	memoryRecorder        = "memory"
 )
 
 // routeMap looks like this:
@@ -45,39 +72,118 @@ type ConfMap struct {
 	// Recorders contains a map of recorder names to their instantiated objects.
 	Recorders map[string]recorder.DataRecorder
 
+	// Spools contains a map of recorder names to their spools. Only the
+	// recorders with a spool section have a spool.
+	Spools map[string]*spool.Spool
+
+	// SpoolSizes contains a map of recorder names to the max_size of their
+	// spool sections. The engines apply them to the spools that are reused by
+	// ReloadYAML when the conf is reloaded.
+	SpoolSizes map[string]int64
+
+	// Queues contains a map of recorder names to the settings of their queues
+	// in the engines. Only the recorders with a queue section are in it.
+	Queues map[string]Queue
+
+	// Retry is the retry policy of the reads and records, from the retry
+	// section of the settings. It is nil if the section is not set.
+	Retry *retry.Policy
+
+	// Breaker holds the settings of the circuit breakers of the endpoints,
+	// from the breaker section of the settings. It is nil if the section is
+	// not set.
+	Breaker *Breaker
+
+	// DrainTimeout is the time the engines ship the results that are already
+	// read when they are shutting down, from the drain_timeout of the
+	// settings.
+	DrainTimeout time.Duration
+
+	// AdminEndpoint is the address of the admin HTTP server, from the
+	// admin_endpoint of the settings. The server is not started if it is
+	// empty.
+	AdminEndpoint string
+
 	// Routes contains a map of reader names to a list of recorders.
 	// map["red1"][]string{"rec1", "rec2"}: means whatever is read
 	// from red1, will be shipped to rec1 and rec2.
 	Routes map[string][]string
+
+	// Processors contains the processors of the payloads that are read by a
+	// reader and shipped to a recorder, keyed by the reader and then the
+	// recorder names. Each one runs the processors of the route and then the
+	// ones of the recorder. Only the pairs with processors are in it.
+	Processors map[string]map[string]processor.Processor
+
+	// Fingerprints contains a summary of each reader and recorder section,
+	// keyed by "readers.<name>" and "recorders.<name>", the processors of
+	// the routes of each reader, keyed by "processors.<reader name>", and the
+	// settings section without the log_level and admin_endpoint, keyed by
+	// "settings". When reloading, the sections with the same fingerprints have
+	// not changed.
+	Fingerprints map[string]string
 }
 
-// Checks the application scope settings. Applies them if defined. If the log
-// level is defined, it will replace a new logger with the provided one.
-func checkSettingsSect(log *tools.Logger, v *viper.Viper) error {
-	if v.IsSet("settings.log_level") {
-		newLevel, ok := v.Get("settings.log_level").(string)
-		if !ok {
-			return &StructureErr{"log_level", "should be a string", nil}
-		}
-		*log = *tools.GetLogger(newLevel)
+// Breaker holds the settings of the circuit breakers. Zero values mean the
+// engine's defaults.
+type Breaker struct {
+	Threshold int           // Consecutive failures that open a breaker.
+	Cooldown  time.Duration // Time a breaker stays open before pinging the endpoint.
+}
+
+// Overflow policies of the queues.
+const (
+	OverflowBlock      = "block"       // The reader waits until there is room in the queue.
+	OverflowDropOldest = "drop_oldest" // The oldest job in the queue is dropped.
+	OverflowDropNewest = "drop_newest" // The new job is dropped.
+)
+
+// Queue holds the settings of the queue of a recorder in the engines. Zero
+// values mean the engine's defaults.
+type Queue struct {
+	Size     int    // Maximum number of the jobs waiting for the recorder.
+	Overflow string // What happens to the jobs when the queue is full.
+}
+
+// Checks the application scope settings. It returns the name of the log level
+// if it is defined, which is applied when the whole configuration is loaded.
+func checkSettingsSect(v *viper.Viper) (string, error) {
+	if !v.IsSet("settings.log_level") {
+		return "", nil
 	}
-	return nil
+	level, ok := v.Get("settings.log_level").(string)
+	if !ok {
+		return "", &StructureErr{"log_level", "should be a string", nil}
+	}
+	return level, nil
 }
 
 // LoadYAML loads the settings from the configuration file. It returns any
 // errors returned from readers/recorders. Please refer to their documentations.
+// The level of the log is set to the log_level setting only if the whole
+// configuration is valid.
 func LoadYAML(log *tools.Logger, v *viper.Viper) (*ConfMap, error) {
+	return ReloadYAML(log, v, nil)
+}
+
+// ReloadYAML is like LoadYAML, but the spools of the running conf are reused
+// for the same directories instead of opening them again, as only one spool
+// should work on a directory. The spools are not changed until the conf is
+// applied; the new max sizes are in the SpoolSizes of the conf. The running
+// conf can be nil.
+func ReloadYAML(log *tools.Logger, v *viper.Viper, running *ConfMap) (*ConfMap, error) {
 	var (
 		readerKeys   map[string]string
 		recorderKeys map[string]string
 		routes       routeMap
+		level        string
 		err          error
 	)
 	if len(v.AllSettings()) == 0 {
 		return nil, ErrEmptyConfig
 	}
 	if v.IsSet("settings") {
-		if err = checkSettingsSect(log, v); err != nil {
+		if level, err = checkSettingsSect(v); err != nil {
 			return nil, &StructureErr{"settings", "", err}
 		}
 	}
@@ -94,7 +200,81 @@ func LoadYAML(log *tools.Logger, v *viper.Viper) (*ConfMap, error) {
 	if err = checkAgainstReadRecorders(routes, readerKeys, recorderKeys); err != nil {
 		return nil, errors.WithMessage(err, "checkAgainstReadRecorders")
 	}
-	return loadConfiguration(v, log, routes, readerKeys, recorderKeys)
+	confMap, err := loadConfiguration(v, log, routes, readerKeys, recorderKeys, running)
+	if err != nil {
+		return nil, err
+	}
+	if err = loadSettings(v, confMap); err != nil {
+		closeSpools(confMap, running)
+		return nil, err
+	}
+	if level != "" {
+		// The running engines share the logger, therefore only its level is
+		// changed.
+		log.SetLevel(tools.ParseLevel(level))
+	}
+	return confMap, nil
+}
+
+// loadSettings applies the settings section to the confMap.
+func loadSettings(v *viper.Viper, confMap *ConfMap) error {
+	var err error
+	settings := make(map[string]interface{})
+	for key, value := range v.GetStringMap("settings") {
+		if key != "log_level" && key != "admin_endpoint" {
+			settings[key] = value
+		}
+	}
+	confMap.Fingerprints["settings"] = fingerprint(settings)
+	if v.IsSet("settings.retry") {
+		rc, err := retry.NewConfig(retry.WithViper(v, "settings.retry"))
+		if err != nil {
+			return &StructureErr{"retry", "", err}
+		}
+		confMap.Retry = rc.Policy()
+	}
+	if v.IsSet("settings.drain_timeout") {
+		d, err := time.ParseDuration(v.GetString("settings.drain_timeout"))
+		if err != nil {
+			return &StructureErr{"drain_timeout", "", err}
+		}
+		if d < 0 {
+			return &StructureErr{"drain_timeout", "cannot be negative", nil}
+		}
+		confMap.DrainTimeout = d
+	}
+	if v.IsSet("settings.admin_endpoint") {
+		confMap.AdminEndpoint = v.GetString("settings.admin_endpoint")
+	}
+	if v.IsSet("settings.breaker") {
+		if confMap.Breaker, err = readBreaker(v); err != nil {
+			return &StructureErr{"breaker", "", err}
+		}
+	}
+	return nil
+}
+
+func readBreaker(v *viper.Viper) (*Breaker, error) {
+	var (
+		b   = new(Breaker)
+		err error
+	)
+	if v.IsSet("settings.breaker.threshold") {
+		b.Threshold = v.GetInt("settings.breaker.threshold")
+		if b.Threshold <= 0 {
+			return nil, errors.Errorf("invalid threshold: %d", b.Threshold)
+		}
+	}
+	if v.IsSet("settings.breaker.cooldown") {
+		cooldown := v.GetString("settings.breaker.cooldown")
+		if b.Cooldown, err = time.ParseDuration(cooldown); err != nil {
+			return nil, errors.Wrap(err, "parsing cooldown")
+		}
+		if b.Cooldown <= 0 {
+			return nil, errors.Errorf("invalid cooldown: %s", cooldown)
+		}
+	}
+	return b, nil
 }
 
 // readers is a map of keyName:typeName
@@ -110,6 +290,12 @@ func getReaders(v *viper.Viper) (map[string]string, error) {
 			readers[reader] = rType
 		case expvarReader:
 			readers[reader] = rType
+		case prometheusReader:
+			readers[reader] = rType
+		case logfileReader:
+			readers[reader] = rType
+		case statsdReader:
+			readers[reader] = rType
 		case "":
 			fallthrough
 		default:
@@ -130,6 +316,20 @@ func getRecorders(v *viper.Viper) (map[string]string, error) {
 		switch rType := v.GetString("recorders." + recorder + ".type"); rType {
 		case elasticsearchRecorder:
 			recorders[recorder] = rType
+		case influxdbRecorder:
+			recorders[recorder] = rType
+		case fileRecorder:
+			recorders[recorder] = rType
+		case prometheusRecorder:
+			recorders[recorder] = rType
+		case graphiteRecorder:
+			recorders[recorder] = rType
+		case webhookRecorder:
+			recorders[recorder] = rType
+		case sqlRecorder:
+			recorders[recorder] = rType
+		case memoryRecorder:
+			recorders[recorder] = rType
 		case "":
 			fallthrough
 		default:
@@ -147,6 +347,9 @@ func getRoutes(v *viper.Viper) (routeMap, error) {
 	for name := range v.GetStringMap("routes") {
 		rt := route{}
 		for recRedType, list := range v.GetStringMapStringSlice("routes." + name) {
+			if recRedType != "readers" && recRedType != "recorders" {
+				continue // e.g. the processors.
+			}
 			for _, target := range list {
 				if strings.Contains(target, ",") {
 					return nil, NewRoutersError(recRedType, "not an array or single value", nil)
@@ -189,36 +392,198 @@ func checkAgainstReadRecorders(routes routeMap, readerKeys, recorderKeys map[str
 	return nil
 }
 
-func loadConfiguration(v *viper.Viper, log tools.FieldLogger, routes routeMap, readerKeys, recorderKeys map[string]string) (*ConfMap, error) {
+func loadConfiguration(v *viper.Viper, log tools.FieldLogger, routes routeMap, readerKeys, recorderKeys map[string]string, running *ConfMap) (*ConfMap, error) {
 	confMap := &ConfMap{
-		Readers:   make(map[string]reader.DataReader, len(readerKeys)),
-		Recorders: make(map[string]recorder.DataRecorder, len(recorderKeys)),
+		Readers:      make(map[string]reader.DataReader, len(readerKeys)),
+		Recorders:    make(map[string]recorder.DataRecorder, len(recorderKeys)),
+		Spools:       make(map[string]*spool.Spool),
+		SpoolSizes:   make(map[string]int64),
+		Queues:       make(map[string]Queue),
+		Processors:   make(map[string]map[string]processor.Processor),
+		Fingerprints: make(map[string]string),
 	}
+	recProcs := make(map[string]processor.Chain)
 	for name, reader := range readerKeys {
 		r, err := parseReader(v, log, reader, name)
 		if err != nil {
+			closeSpools(confMap, running)
 			return nil, errors.Wrap(err, "reader keys")
 		}
 		if !readerInRoutes(name, routes) {
 			continue
 		}
 		confMap.Readers[name] = r
+		confMap.Fingerprints["readers."+name] = fingerprint(v.Get("readers." + name))
 	}
 
 	for name, recorder := range recorderKeys {
 		r, err := readRecorders(v, log, recorder, name)
 		if err != nil {
+			closeSpools(confMap, running)
 			return nil, errors.Wrap(err, "recorder keys")
 		}
 		if !recorderInRoutes(name, routes) {
 			continue
 		}
 		confMap.Recorders[name] = r
+		confMap.Fingerprints["recorders."+name] = fingerprint(v.Get("recorders." + name))
+		if v.IsSet("recorders." + name + ".spool") {
+			sp, size, err := readSpool(v, log, name, running)
+			if err != nil {
+				closeSpools(confMap, running)
+				return nil, errors.Wrap(err, "recorder keys")
+			}
+			confMap.Spools[name] = sp
+			confMap.SpoolSizes[name] = size
+		}
+		if v.IsSet("recorders." + name + ".queue") {
+			q, err := readQueue(v, name)
+			if err != nil {
+				closeSpools(confMap, running)
+				return nil, errors.Wrap(err, "recorder keys")
+			}
+			confMap.Queues[name] = q
+		}
+		if v.IsSet("recorders." + name + ".processors") {
+			chain, err := readProcessors(v, "recorders."+name+".processors")
+			if err != nil {
+				closeSpools(confMap, running)
+				return nil, errors.Wrap(err, "recorder keys")
+			}
+			recProcs[name] = chain
+		}
+	}
+	if err := mapProcessors(v, confMap, routes, recProcs); err != nil {
+		closeSpools(confMap, running)
+		return nil, errors.Wrap(err, "routes")
 	}
 	confMap.Routes = mapReadersRecorders(routes)
 	return confMap, nil
 }
 
+// readProcessors returns the processors of a processors section.
+func readProcessors(v *viper.Viper, key string) (processor.Chain, error) {
+	pc, err := processor.NewConfig(processor.WithViper(v, key))
+	if err != nil {
+		return nil, errors.Wrap(err, key)
+	}
+	return pc.Chain(), nil
+}
+
+// mapProcessors sets up the processors of each reader and recorder pair of the
+// routes, and the fingerprints of the processors of the routes of the readers.
+// It returns an error if a pair is in more than one route and any of them has
+// processors, as the order would not be clear.
+func mapProcessors(v *viper.Viper, confMap *ConfMap, routes routeMap, recProcs map[string]processor.Chain) error {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	type pair struct{ reader, recorder string }
+	seen := make(map[pair]bool) // True if the route of the pair has processors.
+	for _, name := range names {
+		key := "routes." + name + ".processors"
+		var chain processor.Chain
+		if v.IsSet(key) {
+			var err error
+			if chain, err = readProcessors(v, key); err != nil {
+				return err
+			}
+		}
+		rt := routes[name]
+		for _, red := range rt.readers {
+			fp := "processors." + red
+			confMap.Fingerprints[fp] += name + fingerprint(v.Get(key)) + ";"
+			for _, rec := range rt.recorders {
+				p := pair{red, rec}
+				if withProcs, ok := seen[p]; ok && (withProcs || len(chain) > 0) {
+					return NewRoutersError(name, red+" and "+rec+" are in more than one route with processors", nil)
+				}
+				seen[p] = len(chain) > 0
+				procs := append(append(processor.Chain(nil), chain...), recProcs[rec]...)
+				if len(procs) == 0 {
+					continue
+				}
+				if confMap.Processors[red] == nil {
+					confMap.Processors[red] = make(map[string]processor.Processor)
+				}
+				confMap.Processors[red][rec] = procs
+			}
+		}
+	}
+	return nil
+}
+
+// fingerprint returns a summary of the value of a section. The keys of the
+// maps are printed in order, therefore the same sections have the same
+// fingerprints.
+func fingerprint(section interface{}) string {
+	return fmt.Sprintf("%v", section)
+}
+
+// closeSpools releases the spools of a confMap that is not going to be used,
+// therefore another spool can work on their directories. The spools of the
+// running conf are left open.
+func closeSpools(confMap, running *ConfMap) {
+	for _, sp := range confMap.Spools {
+		if runningSpool(running, sp.Dir()) != sp {
+			sp.Close()
+		}
+	}
+}
+
+// readSpool returns the spool of the recorder from its spool section, and its
+// max size. The spool of the running conf is returned if it works on the same
+// directory, as a new spool would clean up the files of the running one.
+func readSpool(v *viper.Viper, log tools.FieldLogger, name string, running *ConfMap) (*spool.Spool, int64, error) {
+	sc, err := spool.NewConfig(
+		spool.WithViper(v, "recorders."+name+".spool"),
+		spool.WithLogger(log),
+	)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "spool of "+name)
+	}
+	if sp := runningSpool(running, sc.SpoolDir); sp != nil {
+		return sp, sc.ConfMaxSize, nil
+	}
+	sp, err := sc.Spool()
+	return sp, sc.ConfMaxSize, err
+}
+
+// runningSpool returns the spool of the running conf that works on the dir, or
+// nil if there is none.
+func runningSpool(running *ConfMap, dir string) *spool.Spool {
+	if running == nil {
+		return nil
+	}
+	for _, sp := range running.Spools {
+		if filepath.Clean(sp.Dir()) == filepath.Clean(dir) {
+			return sp
+		}
+	}
+	return nil
+}
+
+// readQueue returns the settings of the queue of the recorder from its queue
+// section.
+func readQueue(v *viper.Viper, name string) (Queue, error) {
+	key := "recorders." + name + ".queue"
+	q := Queue{
+		Size:     v.GetInt(key + ".size"),
+		Overflow: v.GetString(key + ".overflow"),
+	}
+	if q.Size < 0 {
+		return Queue{}, errors.Errorf("queue of %s: invalid size: %d", name, q.Size)
+	}
+	switch q.Overflow {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return Queue{}, errors.Errorf("queue of %s: invalid overflow: %q", name, q.Overflow)
+	}
+	return q, nil
+}
+
 func readerInRoutes(name string, routes routeMap) bool {
 	for _, r := range routes {
 		if tools.StringInSlice(name, r.readers) {
@@ -248,6 +613,33 @@ func parseReader(v *viper.Viper, log tools.FieldLogger, readerType, name string)
 			return nil, errors.Wrap(err, "parsing reader")
 		}
 		return rc.Reader()
+	case prometheusReader:
+		rc, err := prometheus.NewConfig(
+			prometheus.WithLogger(log),
+			prometheus.WithViper(v, name, "readers."+name),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	case logfileReader:
+		rc, err := logfile.NewConfig(
+			logfile.WithLogger(log),
+			logfile.WithViper(v, name, "readers."+name),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
+	case statsdReader:
+		rc, err := statsd.NewConfig(
+			statsd.WithLogger(log),
+			statsd.WithViper(v, name, "readers."+name),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing reader")
+		}
+		return rc.Reader()
 	case selfReader:
 		rc, err := self.NewConfig(
 			self.WithLogger(log),
@@ -272,6 +664,69 @@ func readRecorders(v *viper.Viper, log tools.FieldLogger, recorderType, name str
 			return nil, errors.Wrap(err, "read-recorders loading from viper")
 		}
 		return rc.Recorder()
+	case influxdbRecorder:
+		rc, err := influxdb.NewConfig(
+			influxdb.WithViper(v, name, "recorders."+name),
+			influxdb.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case fileRecorder:
+		rc, err := file.NewConfig(
+			file.WithViper(v, name, "recorders."+name),
+			file.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case prometheusRecorder:
+		rc, err := promrec.NewConfig(
+			promrec.WithViper(v, name, "recorders."+name),
+			promrec.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case graphiteRecorder:
+		rc, err := graphite.NewConfig(
+			graphite.WithViper(v, name, "recorders."+name),
+			graphite.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case webhookRecorder:
+		rc, err := webhook.NewConfig(
+			webhook.WithViper(v, name, "recorders."+name),
+			webhook.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case sqlRecorder:
+		rc, err := sql.NewConfig(
+			sql.WithViper(v, name, "recorders."+name),
+			sql.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
+	case memoryRecorder:
+		rc, err := memory.NewConfig(
+			memory.WithViper(v, name, "recorders."+name),
+			memory.WithLogger(log),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "read-recorders loading from viper")
+		}
+		return rc.Recorder()
 	}
 	return nil, NotSupportedError(recorderType)
 }
@@ -35,28 +35,28 @@ func TestLoadConfiguration(t *testing.T) {
 		readers:   []string{"reader_1"},
 		recorders: []string{"recorder_1"},
 	}}
-	_, err = loadConfiguration(v, log, routeMap, readers, recorders)
+	_, err = loadConfiguration(v, log, routeMap, readers, recorders, nil)
 	if _, ok := errors.Cause(err).(NotSupportedError); !ok {
 		t.Errorf("err.(NotSupportedError) = (%T); want NotSupportedError", err)
 	}
 
 	readers = map[string]string{"reader_1": "expvar"}
 	recorders = map[string]string{"recorder_1": "not_exists"}
-	_, err = loadConfiguration(v, log, routeMap, readers, recorders)
+	_, err = loadConfiguration(v, log, routeMap, readers, recorders, nil)
 	if _, ok := errors.Cause(err).(NotSupportedError); !ok {
 		t.Errorf("err.(NotSupportedError) = (%T); want (NotSupportedError)", err)
 	}
 
 	readers = map[string]string{"reader_1": "expvar", "reader_2": "self"}
 	recorders = map[string]string{"recorder_2": "elasticsearch"}
-	_, err = loadConfiguration(v, log, routeMap, readers, recorders)
+	_, err = loadConfiguration(v, log, routeMap, readers, recorders, nil)
 	if err == nil {
 		t.Error("err = (nil);want (error)")
 	}
 
 	readers = map[string]string{"reader_1": "expvar", "reader_2": "self"}
 	recorders = map[string]string{"recorder_1": "elasticsearch"}
-	_, err = loadConfiguration(v, log, routeMap, readers, recorders)
+	_, err = loadConfiguration(v, log, routeMap, readers, recorders, nil)
 	if err != nil {
 		t.Errorf("err = (%v); want (nil)", err)
 	}
@@ -87,6 +87,21 @@ func TestParseReader(t *testing.T) {
 		t.Error("err = (nil); want (error)")
 	}
 
+	_, err = parseReader(v, log, "prometheus", "readers.reader1")
+	if errors.Cause(err) == nil {
+		t.Error("err = (nil); want (error)")
+	}
+
+	_, err = parseReader(v, log, "logfile", "readers.reader1")
+	if errors.Cause(err) == nil {
+		t.Error("err = (nil); want (error)")
+	}
+
+	_, err = parseReader(v, log, "statsd", "readers.reader1")
+	if errors.Cause(err) == nil {
+		t.Error("err = (nil); want (error)")
+	}
+
 	input, err := FixtureWithSection("various.txt", "ParseReader")
 	if err != nil {
 		t.Fatalf("error getting section: %v", err)
@@ -152,6 +167,30 @@ func TestGetReaders(t *testing.T) {
     `)),
 			value: "self",
 		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            type: prometheus
+    `)),
+			value: "prometheus",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            type: logfile
+    `)),
+			value: "logfile",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            type: statsd
+    `)),
+			value: "statsd",
+		},
 	}
 
 	for i, tc := range tcs {
@@ -209,6 +248,62 @@ func TestGetRecorders(t *testing.T) {
     `)),
 			value: "elasticsearch",
 		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: influxdb
+    `)),
+			value: "influxdb",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: file
+    `)),
+			value: "file",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: prometheus
+    `)),
+			value: "prometheus",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: graphite
+    `)),
+			value: "graphite",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: webhook
+    `)),
+			value: "webhook",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: sql
+    `)),
+			value: "sql",
+		},
+		{
+			input: bytes.NewBuffer([]byte(`
+    recorders:
+        recorder1:
+            type: memory
+    `)),
+			value: "memory",
+		},
 	}
 	for i, tc := range tcs {
 		name := fmt.Sprintf("case_%d", i)
@@ -7,13 +7,22 @@ package config_test
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/arsham/expipe/datatype"
+	"github.com/arsham/expipe/processor"
 	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/recorder"
 	"github.com/arsham/expipe/tools"
 	"github.com/arsham/expipe/tools/config"
+	"github.com/arsham/expipe/tools/retry"
+	"github.com/arsham/expipe/tools/token"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -87,6 +96,628 @@ func TestLoadYAMLSuccess(t *testing.T) {
 	}
 }
 
+func TestLoadYAMLSpool(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v := viper.New()
+	v.SetConfigType("yaml")
+	log := tools.DiscardLogger()
+	input := bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+            spool:
+                dir: ` + filepath.Join(dir, "recorder1") + `
+                max_size: 1MB
+        recorder2:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+                - recorder2
+    `))
+	v.ReadConfig(input)
+	confMap, err := config.LoadYAML(log, v)
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if len(confMap.Spools) != 1 {
+		t.Fatalf("len(confMap.Spools) = (%d); want (1)", len(confMap.Spools))
+	}
+	if sp := confMap.Spools["recorder1"]; sp == nil || sp.Dir() != filepath.Join(dir, "recorder1") {
+		t.Errorf("confMap.Spools[recorder1] = (%v); want (spool in %s)", sp, dir)
+	}
+
+	input = bytes.NewBuffer([]byte(`
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+            spool:
+                max_size: 1MB
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `))
+	v.ReadConfig(input)
+	if _, err = config.LoadYAML(log, v); err == nil {
+		t.Error("no dir: err = (nil); want (error)")
+	}
+}
+
+// A reload should not touch the files of the running spools, as they are
+// still in use.
+func TestReloadYAMLSpools(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := tools.DiscardLogger()
+	body := `
+    settings:
+        drain_timeout: %s
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+            spool:
+                dir: ` + dir + `
+                max_size: %s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	load := func(running *config.ConfMap, drain, maxSize string) (*config.ConfMap, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, drain, maxSize)))
+		return config.ReloadYAML(log, v, running)
+	}
+	running, err := load(nil, "2s", "1MB")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	sp := running.Spools["recorder1"]
+	for i := 0; i < 5; i++ {
+		job := recorder.Job{
+			ID:      token.NewUID(),
+			Payload: datatype.New([]datatype.DataType{datatype.NewFloatType("n", float64(i))}),
+		}
+		if err = sp.Push(job); err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+	}
+	inFlight := filepath.Join(dir, "00000000000000000005.tmp")
+	ioutil.WriteFile(inFlight, []byte("partial"), 0600)
+
+	conf, err := load(running, "2s", "1B")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if conf.Spools["recorder1"] != sp {
+		t.Error("the running spool is not reused")
+	}
+	if conf.SpoolSizes["recorder1"] != 1 {
+		t.Errorf("SpoolSizes[recorder1] = (%d); want (1)", conf.SpoolSizes["recorder1"])
+	}
+	if sp.Len() != 5 || sp.MaxSize() != 1<<20 {
+		t.Errorf("spool: (%d jobs, %d bytes); want (5 jobs, %d bytes)", sp.Len(), sp.MaxSize(), 1<<20)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 6 {
+		t.Errorf("len(files) = (%d); want (6)", len(files))
+	}
+	if _, err = os.Stat(inFlight); err != nil {
+		t.Errorf("err = (%v); the in-flight write should not be removed", err)
+	}
+
+	if _, err = load(running, "soon", "1MB"); err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
+	if sp.Len() != 5 {
+		t.Errorf("sp.Len() = (%d); want (5): the running spool is closed", sp.Len())
+	}
+}
+
+func TestLoadYAMLFingerprints(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    settings:
+        log_level: %s
+        drain_timeout: %s
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: %s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	load := func(level, drain, timeout string) *config.ConfMap {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, level, drain, timeout)))
+		confMap, err := config.LoadYAML(log, v)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return confMap
+	}
+	base := load("error", "2s", "8s")
+	for _, key := range []string{"settings", "readers.reader1", "recorders.recorder1"} {
+		if _, ok := base.Fingerprints[key]; !ok {
+			t.Errorf("Fingerprints[%s] is missing", key)
+		}
+	}
+	tcs := []struct {
+		name    string
+		conf    *config.ConfMap
+		changed []string
+	}{
+		{"same", load("error", "2s", "8s"), nil},
+		{"log level", load("info", "2s", "8s"), nil},
+		{"settings", load("error", "3s", "8s"), []string{"settings"}},
+		{"recorder", load("error", "2s", "9s"), []string{"recorders.recorder1"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, want := range base.Fingerprints {
+				got := tc.conf.Fingerprints[key]
+				if changed := tools.StringInSlice(key, tc.changed); changed != (got != want) {
+					t.Errorf("Fingerprints[%s] = (%s); changed: (%t), want (%t)", key, got, !changed, changed)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadYAMLQueue(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+            %s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	tcs := []struct {
+		name    string
+		queue   string
+		want    map[string]config.Queue
+		wantErr bool
+	}{
+		{"no queue", "", map[string]config.Queue{}, false},
+		{"defaults", "queue: {}", map[string]config.Queue{"recorder1": {}}, false},
+		{"values", "queue: {size: 10, overflow: drop_oldest}", map[string]config.Queue{
+			"recorder1": {Size: 10, Overflow: config.OverflowDropOldest},
+		}, false},
+		{"bad size", "queue: {size: -1}", nil, true},
+		{"bad overflow", "queue: {overflow: explode}", nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, tc.queue)))
+			confMap, err := config.LoadYAML(log, v)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if !reflect.DeepEqual(confMap.Queues, tc.want) {
+				t.Errorf("confMap.Queues = (%v); want (%v)", confMap.Queues, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLRetry(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	tcs := []struct {
+		name     string
+		settings string
+		want     *retry.Policy
+		wantErr  bool
+	}{
+		{"no retry", "", nil, false},
+		{"defaults", "retry:\n            max_attempts: 3", retry.New(), false},
+		{"invalid", "retry:\n            jitter: 3", nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			input := body
+			if tc.settings != "" {
+				input = "\n    settings:\n        " + tc.settings + body
+			}
+			v.ReadConfig(bytes.NewBufferString(input))
+			confMap, err := config.LoadYAML(log, v)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if !reflect.DeepEqual(confMap.Retry, tc.want) {
+				t.Errorf("confMap.Retry = (%v); want (%v)", confMap.Retry, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLBreaker(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	tcs := []struct {
+		name     string
+		settings string
+		want     *config.Breaker
+		wantErr  bool
+	}{
+		{"no breaker", "", nil, false},
+		{"defaults", "breaker: {}", &config.Breaker{}, false},
+		{"values", "breaker:\n            threshold: 3\n            cooldown: 1m", &config.Breaker{Threshold: 3, Cooldown: time.Minute}, false},
+		{"zero threshold", "breaker:\n            threshold: 0", nil, true},
+		{"bad cooldown", "breaker:\n            cooldown: soon", nil, true},
+		{"negative cooldown", "breaker:\n            cooldown: -1s", nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			input := body
+			if tc.settings != "" {
+				input = "\n    settings:\n        " + tc.settings + body
+			}
+			v.ReadConfig(bytes.NewBufferString(input))
+			confMap, err := config.LoadYAML(log, v)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if !reflect.DeepEqual(confMap.Breaker, tc.want) {
+				t.Errorf("confMap.Breaker = (%v); want (%v)", confMap.Breaker, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLAdminEndpoint(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    settings:
+        drain_timeout: 2s
+        %s
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	load := func(admin string) *config.ConfMap {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, admin)))
+		confMap, err := config.LoadYAML(log, v)
+		if err != nil {
+			t.Fatalf("err = (%v); want (nil)", err)
+		}
+		return confMap
+	}
+	without := load("")
+	if without.AdminEndpoint != "" {
+		t.Errorf("AdminEndpoint = (%s); want (empty)", without.AdminEndpoint)
+	}
+	with := load("admin_endpoint: localhost:9191")
+	if with.AdminEndpoint != "localhost:9191" {
+		t.Errorf("AdminEndpoint = (%s); want (localhost:9191)", with.AdminEndpoint)
+	}
+	if a, b := without.Fingerprints["settings"], with.Fingerprints["settings"]; a != b {
+		t.Errorf("settings fingerprint = (%s); want (%s)", b, a)
+	}
+}
+
+func TestLoadYAMLProcessors(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+            processors:
+                - type: drop
+                  keys: ["memstats.*"]
+        recorder2:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+                - recorder2
+            %s
+        %s
+    `
+	load := func(procs, route string) (*config.ConfMap, error) {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, procs, route)))
+		return config.LoadYAML(log, v)
+	}
+	confMap, err := load(`processors:
+                - type: rename
+                  keys: {memstats.Alloc: alloc}`, "")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := map[string]map[string]processor.Processor{
+		"reader1": {
+			"recorder1": processor.Chain{
+				processor.Rename{"memstats.Alloc": "alloc"},
+				processor.Drop{"memstats.*"},
+			},
+			"recorder2": processor.Chain{
+				processor.Rename{"memstats.Alloc": "alloc"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(confMap.Processors, want) {
+		t.Errorf("Processors = (%v); want (%v)", confMap.Processors, want)
+	}
+
+	without, err := load("", "")
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want = map[string]map[string]processor.Processor{
+		"reader1": {"recorder1": processor.Chain{processor.Drop{"memstats.*"}}},
+	}
+	if !reflect.DeepEqual(without.Processors, want) {
+		t.Errorf("Processors = (%v); want (%v)", without.Processors, want)
+	}
+	if a, b := without.Fingerprints["processors.reader1"], confMap.Fingerprints["processors.reader1"]; a == b {
+		t.Errorf("processors fingerprint = (%s); want a different one", b)
+	}
+
+	tcs := []struct {
+		name, procs, route string
+	}{
+		{"bad processor", "processors: [{type: unknown}]", ""},
+		{"duplicate pair", "processors: [{type: drop, keys: [alloc]}]", `route2:
+            readers: [reader1]
+            recorders: [recorder2]`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := load(tc.procs, tc.route); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
+
+func TestLoadYAMLDrainTimeout(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	tcs := []struct {
+		name     string
+		settings string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"not set", "", 0, false},
+		{"set", "drain_timeout: 10s", 10 * time.Second, false},
+		{"bad", "drain_timeout: soon", 0, true},
+		{"negative", "drain_timeout: -1s", 0, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := viper.New()
+			v.SetConfigType("yaml")
+			input := body
+			if tc.settings != "" {
+				input = "\n    settings:\n        " + tc.settings + body
+			}
+			v.ReadConfig(bytes.NewBufferString(input))
+			confMap, err := config.LoadYAML(log, v)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("err = (nil); want (error)")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = (%v); want (nil)", err)
+			}
+			if confMap.DrainTimeout != tc.want {
+				t.Errorf("confMap.DrainTimeout = (%v); want (%v)", confMap.DrainTimeout, tc.want)
+			}
+		})
+	}
+}
+
 func stringInMapKeys(niddle string, haystack map[string]reader.DataReader) bool {
 	for b := range haystack {
 		if b == niddle {
@@ -164,6 +795,55 @@ func TestLoadSettingsErrors(t *testing.T) {
     `))
 	v.ReadConfig(input)
 	config.LoadYAML(log, v)
+	if log.Level == tools.DebugLevel {
+		t.Error("log.Level = (debug); want the level of an invalid config not applied")
+	}
+}
+
+func TestLoadYAMLLogLevel(t *testing.T) {
+	t.Parallel()
+	log := tools.DiscardLogger()
+	body := `
+    settings:
+        log_level: %s
+        drain_timeout: %s
+    readers:
+        reader1:
+            type: expvar
+            endpoint: localhost:1234
+            type_name: my_app
+            interval: 2s
+            timeout: 3s
+    recorders:
+        recorder1:
+            type: elasticsearch
+            endpoint: http://127.0.0.1:9200
+            index_name: index
+            timeout: 8s
+    routes:
+        route1:
+            readers:
+                - reader1
+            recorders:
+                - recorder1
+    `
+	load := func(level, drain string) error {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.ReadConfig(bytes.NewBufferString(fmt.Sprintf(body, level, drain)))
+		_, err := config.LoadYAML(log, v)
+		return err
+	}
+	if err := load("debug", "1s"); err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if log.Level != tools.DebugLevel {
+		t.Errorf("log.Level = (%v); want (tools.DebugLevel)", log.Level)
+	}
+	// The level is not changed by an invalid config.
+	if err := load("warn", "-1s"); err == nil {
+		t.Fatal("err = (nil); want (error)")
+	}
 	if log.Level != tools.DebugLevel {
 		t.Errorf("log.Level = (%v); want (tools.DebugLevel)", log.Level)
 	}
@@ -39,25 +39,27 @@ const (
 
 // GetLogger returns the default logger with the given log level.
 func GetLogger(level string) *Logger {
-	logrus.SetLevel(logrus.ErrorLevel)
 	customFormatter := new(logrus.TextFormatter)
 	customFormatter.TimestampFormat = "2006-01-02 15:04:05"
 	logrus.SetFormatter(customFormatter)
 	customFormatter.FullTimestamp = true
+	logrus.SetLevel(ParseLevel(level))
+
+	return StandardLogger()
+}
+
+// ParseLevel returns the log level of the given name. Unknown names are the
+// error level.
+func ParseLevel(level string) logrus.Level {
 	switch strings.ToLower(level) {
 	case "debug":
-		logrus.SetLevel(logrus.DebugLevel)
+		return logrus.DebugLevel
 	case "info":
-		logrus.SetLevel(logrus.InfoLevel)
-	case "warn":
-		logrus.SetLevel(logrus.WarnLevel)
-	case "error":
-		logrus.SetLevel(logrus.ErrorLevel)
-	default:
-		logrus.SetLevel(logrus.ErrorLevel)
+		return logrus.InfoLevel
+	case "warn", "warning":
+		return logrus.WarnLevel
 	}
-
-	return StandardLogger()
+	return logrus.ErrorLevel
 }
 
 // DiscardLogger returns a dummy logger.
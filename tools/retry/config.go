@@ -0,0 +1,89 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package retry
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config holds the necessary configuration for setting up a Policy from the
+// retry section of the settings in a configuration file. All values are
+// optional and the defaults are used for the missing ones.
+type Config struct {
+	RetryMaxAttempts  int      `mapstructure:"max_attempts"`
+	RetryInitialDelay string   `mapstructure:"initial_delay"`
+	RetryMaxDelay     string   `mapstructure:"max_delay"`
+	RetryJitter       *float64 `mapstructure:"jitter"`
+	policy            *Policy
+}
+
+// Conf func is used for initializing a Config object.
+type Conf func(*Config) error
+
+// NewConfig is used for returning the values from config file. It returns any
+// errors that any of conf function return.
+func NewConfig(conf ...Conf) (*Config, error) {
+	obj := new(Config)
+	for _, c := range conf {
+		err := c(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Policy returns the policy of the configuration, or the default policy if
+// it is not loaded.
+func (c *Config) Policy() *Policy {
+	if c.policy == nil {
+		return New()
+	}
+	return c.policy
+}
+
+type unmarshaller interface {
+	UnmarshalKey(key string, rawVal interface{}) error
+}
+
+// WithViper produces an error if any of the values are invalid.
+func WithViper(v unmarshaller, key string) Conf {
+	return func(c *Config) error {
+		if key == "" {
+			return errors.New("key cannot be empty")
+		}
+		if v == nil {
+			return errors.New("no config file")
+		}
+		err := v.UnmarshalKey(key, &c)
+		if err != nil {
+			return errors.Wrap(err, "decoding config")
+		}
+		p := New()
+		if c.RetryMaxAttempts != 0 {
+			p.MaxAttempts = c.RetryMaxAttempts
+		}
+		if c.RetryInitialDelay != "" {
+			if p.InitialDelay, err = time.ParseDuration(c.RetryInitialDelay); err != nil {
+				return errors.Wrap(err, "parsing initial_delay")
+			}
+		}
+		if c.RetryMaxDelay != "" {
+			if p.MaxDelay, err = time.ParseDuration(c.RetryMaxDelay); err != nil {
+				return errors.Wrap(err, "parsing max_delay")
+			}
+		}
+		if c.RetryJitter != nil {
+			p.Jitter = *c.RetryJitter
+		}
+		if err = p.Validate(); err != nil {
+			return err
+		}
+		c.policy = p
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package retry_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/tools/retry"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type badMarshaller struct{}
+
+func (badMarshaller) UnmarshalKey(key string, rawVal interface{}) error { return errors.New("text") }
+
+func readConfig(section string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.ReadConfig(bytes.NewBuffer([]byte(`
+    settings:
+        retry:
+            ` + section + `
+    `)))
+	return v
+}
+
+func TestWithViperErrors(t *testing.T) {
+	c := new(retry.Config)
+	if err := retry.WithViper(viper.New(), "")(c); err == nil {
+		t.Error("no key: err = (nil); want (error)")
+	}
+	if err := retry.WithViper(nil, "key")(c); err == nil {
+		t.Error("no viper: err = (nil); want (error)")
+	}
+	if err := retry.WithViper(&badMarshaller{}, "key")(c); err == nil {
+		t.Error("bad marshaller: err = (nil); want (error)")
+	}
+	for _, section := range []string{
+		"initial_delay: soon",
+		"max_delay: later",
+		"max_attempts: -1",
+		"jitter: 2",
+		"max_delay: 1ms",
+	} {
+		c = new(retry.Config)
+		if err := retry.WithViper(readConfig(section), "settings.retry")(c); err == nil {
+			t.Errorf("err = (nil); want (error): %s", section)
+		}
+	}
+}
+
+func TestWithViperSuccess(t *testing.T) {
+	v := readConfig(`max_attempts: 5
+            initial_delay: 1s
+            max_delay: 1m
+            jitter: 0`)
+	c, err := retry.NewConfig(retry.WithViper(v, "settings.retry"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want := &retry.Policy{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: time.Minute}
+	if !reflect.DeepEqual(c.Policy(), want) {
+		t.Errorf("c.Policy() = (%v); want (%v)", c.Policy(), want)
+	}
+
+	c, err = retry.NewConfig(retry.WithViper(readConfig("max_attempts: 2"), "settings.retry"))
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	want = retry.New()
+	want.MaxAttempts = 2
+	if !reflect.DeepEqual(c.Policy(), want) {
+		t.Errorf("c.Policy() = (%v); want (%v)", c.Policy(), want)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	c, err := retry.NewConfig()
+	if err != nil {
+		t.Fatalf("err = (%v); want (nil)", err)
+	}
+	if !reflect.DeepEqual(c.Policy(), retry.New()) {
+		t.Errorf("c.Policy() = (%v); want (%v)", c.Policy(), retry.New())
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+// Package retry contains the retry policy that the Engine applies around the
+// Read and Record calls. Only the errors that are caused by an unavailable
+// endpoint are retried, with an exponential backoff between the attempts:
+//
+//    delay = min(initial_delay * 2^(attempt-1), max_delay) ± jitter
+//
+// The retries never go past the deadline of the job's context: if the next
+// attempt can not be made before the deadline, the last error is returned.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/recorder"
+	"github.com/pkg/errors"
+)
+
+// Default values of the policy.
+const (
+	DefaultMaxAttempts  = 3
+	DefaultInitialDelay = 100 * time.Millisecond
+	DefaultMaxDelay     = 5 * time.Second
+	DefaultJitter       = 0.2
+)
+
+// Policy defines how many times and how often a failed call is retried. A nil
+// Policy does not retry.
+type Policy struct {
+	// MaxAttempts is the number of the calls, including the first one.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the first retry, which doubles on each
+	// retry.
+	InitialDelay time.Duration
+
+	// MaxDelay is the maximum delay between the retries.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of the delay that is randomly added or removed,
+	// between 0 and 1.
+	Jitter float64
+}
+
+// New returns a Policy with the default values.
+func New() *Policy {
+	return &Policy{
+		MaxAttempts:  DefaultMaxAttempts,
+		InitialDelay: DefaultInitialDelay,
+		MaxDelay:     DefaultMaxDelay,
+		Jitter:       DefaultJitter,
+	}
+}
+
+// Validate returns an error if any of the values are out of range.
+func (p *Policy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("max_attempts should be at least 1: %d", p.MaxAttempts)
+	case p.InitialDelay <= 0:
+		return fmt.Errorf("initial_delay should be positive: %s", p.InitialDelay)
+	case p.MaxDelay < p.InitialDelay:
+		return fmt.Errorf("max_delay (%s) is less than initial_delay (%s)", p.MaxDelay, p.InitialDelay)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("jitter should be between 0 and 1: %v", p.Jitter)
+	}
+	return nil
+}
+
+// IsRetryable returns true if the error is caused by an unavailable endpoint
+// of a reader or a recorder.
+func IsRetryable(err error) bool {
+	switch errors.Cause(err).(type) {
+	case reader.EndpointNotAvailableError, *reader.EndpointNotAvailableError,
+		recorder.EndpointNotAvailableError, *recorder.EndpointNotAvailableError:
+		return true
+	}
+	return false
+}
+
+// Delay returns the delay before the retry that follows the attempt, without
+// the jitter.
+func (p *Policy) Delay(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (p *Policy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter == 0 {
+		return delay
+	}
+	return delay + time.Duration(float64(delay)*p.Jitter*(2*rand.Float64()-1))
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, or
+// the attempts are exhausted. It returns the number of the attempts and the
+// last error. It stops retrying when the ctx is done, or when the deadline of
+// the ctx is sooner than the next attempt.
+func (p *Policy) Do(ctx context.Context, fn func() error) (int, error) {
+	attempt := 1
+	err := fn()
+	if p == nil {
+		return attempt, err
+	}
+	for ; err != nil && attempt < p.MaxAttempts && IsRetryable(err); attempt++ {
+		delay := p.jitter(p.Delay(attempt))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return attempt, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		err = fn()
+	}
+	return attempt, err
+}
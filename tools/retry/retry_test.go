@@ -0,0 +1,174 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package retry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arsham/expipe/reader"
+	"github.com/arsham/expipe/recorder"
+	"github.com/arsham/expipe/tools/retry"
+	"github.com/pkg/errors"
+)
+
+var (
+	errExample     = errors.New("example")
+	errUnavailable = recorder.EndpointNotAvailableError{Endpoint: "http://127.0.0.1", Err: errExample}
+)
+
+func policy() *retry.Policy {
+	return &retry.Policy{
+		MaxAttempts:  4,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     4 * time.Millisecond,
+	}
+}
+
+// failing returns a function that fails n times with err.
+func failing(n int, err error) (func() error, *int) {
+	calls := new(int)
+	return func() error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}, calls
+}
+
+func TestIsRetryable(t *testing.T) {
+	tcs := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other", errExample, false},
+		{"context", context.DeadlineExceeded, false},
+		{"recorder", errUnavailable, true},
+		{"recorder pointer", &errUnavailable, true},
+		{"reader", reader.EndpointNotAvailableError{Endpoint: "a", Err: errExample}, true},
+		{"wrapped", errors.Wrap(errUnavailable, "recording"), true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := retry.IsRetryable(tc.err); got != tc.want {
+				t.Errorf("IsRetryable(%v) = (%t); want (%t)", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	tcs := []struct {
+		name     string
+		fails    int
+		err      error
+		attempts int
+		wantErr  bool
+	}{
+		{"success", 0, errUnavailable, 1, false},
+		{"not retryable", 1, errExample, 1, true},
+		{"recovers", 2, errUnavailable, 3, false},
+		{"exhausted", 10, errUnavailable, 4, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fn, calls := failing(tc.fails, tc.err)
+			attempts, err := policy().Do(ctx, fn)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = (%v); want error (%t)", err, tc.wantErr)
+			}
+			if attempts != tc.attempts || *calls != tc.attempts {
+				t.Errorf("attempts = (%d), calls = (%d); want (%d)", attempts, *calls, tc.attempts)
+			}
+		})
+	}
+}
+
+func TestDoNilPolicy(t *testing.T) {
+	var p *retry.Policy
+	fn, calls := failing(1, errUnavailable)
+	attempts, err := p.Do(context.Background(), fn)
+	if err != errUnavailable {
+		t.Errorf("err = (%v); want (%v)", err, errUnavailable)
+	}
+	if attempts != 1 || *calls != 1 {
+		t.Errorf("attempts = (%d), calls = (%d); want (1)", attempts, *calls)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	p := policy()
+	p.InitialDelay, p.MaxDelay = time.Hour, time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	fn, calls := failing(1, errUnavailable)
+	if _, err := p.Do(ctx, fn); err != errUnavailable {
+		t.Errorf("deadline: err = (%v); want (%v)", err, errUnavailable)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = (%d); want (1): the retry is after the deadline", *calls)
+	}
+
+	p.InitialDelay, p.MaxDelay = 10*time.Millisecond, 10*time.Millisecond
+	ctx, cancel = context.WithCancel(context.Background())
+	fn, calls = failing(10, errUnavailable)
+	go func() {
+		time.Sleep(15 * time.Millisecond)
+		cancel()
+	}()
+	done := make(chan struct{})
+	go func() {
+		p.Do(ctx, fn)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Do did not return when the context was cancelled")
+	}
+	if *calls >= p.MaxAttempts {
+		t.Errorf("calls = (%d); want (< %d)", *calls, p.MaxAttempts)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	p := &retry.Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w*time.Millisecond {
+			t.Errorf("p.Delay(%d) = (%s); want (%s)", i+1, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := retry.New().Validate(); err != nil {
+		t.Errorf("default: err = (%v); want (nil)", err)
+	}
+	tcs := []struct {
+		name   string
+		modify func(*retry.Policy)
+	}{
+		{"no attempts", func(p *retry.Policy) { p.MaxAttempts = 0 }},
+		{"no initial delay", func(p *retry.Policy) { p.InitialDelay = 0 }},
+		{"small max delay", func(p *retry.Policy) { p.MaxDelay = p.InitialDelay / 2 }},
+		{"negative jitter", func(p *retry.Policy) { p.Jitter = -0.1 }},
+		{"large jitter", func(p *retry.Policy) { p.Jitter = 1.1 }},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			p := retry.New()
+			tc.modify(p)
+			if err := p.Validate(); err == nil {
+				t.Error("err = (nil); want (error)")
+			}
+		})
+	}
+}
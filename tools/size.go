@@ -0,0 +1,41 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseSize returns the size in bytes of a value like "500", "10KB", "5 MB" or
+// "1GB". It returns zero if the size is empty, and an error if the size is
+// negative or does not fit in an int64.
+func ParseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if size == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(size, u.suffix) {
+			size, factor = strings.TrimSpace(strings.TrimSuffix(size, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	if n > math.MaxInt64/factor {
+		return 0, fmt.Errorf("size is too large: %s", size)
+	}
+	return n * factor, nil
+}
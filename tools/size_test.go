@@ -0,0 +1,42 @@
+// Copyright 2016 Arsham Shirvani <arshamshirvani@gmail.com>. All rights reserved.
+// Use of this source code is governed by the Apache 2.0 license
+// License that can be found in the LICENSE file.
+
+package tools
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+	tcs := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1024", 1024, false},
+		{"10B", 10, false},
+		{"2kb", 2048, false},
+		{"5 MB", 5 << 20, false},
+		{"1GB", 1 << 30, false},
+		{"8589934591GB", 8589934591 << 30, false},
+		{"8589934592GB", 0, true},
+		{"9223372036854775807", 9223372036854775807, false},
+		{"9223372036854775808", 0, true},
+		{"abc", 0, true},
+		{"-1", 0, true},
+		{"1TB", 0, true},
+		{"MB", 0, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.size, func(t *testing.T) {
+			got, err := ParseSize(tc.size)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseSize(%s): err = (%v); want error (%t)", tc.size, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ParseSize(%s) = (%d); want (%d)", tc.size, got, tc.want)
+			}
+		})
+	}
+}